@@ -0,0 +1,125 @@
+// backfill-images สร้างรูปย่อ (thumb, medium, large) ให้รูปสินค้าใน "Image" ที่ upload ไว้ก่อนมีรูปย่อ
+//
+//	go run ./cmd/backfill-images -env .env [-batch 100] [-dry-run]
+//
+// config อื่น ๆ อ่านจาก .env และ environment variable เหมือน server
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/databases"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/imaging"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/storage"
+)
+
+var errNotInStorage = errors.New("url does not belong to the configured storage")
+
+func main() {
+	envPath := flag.String("env", "", "path to .env file (optional)")
+	batch := flag.Int("batch", 100, "images per query")
+	dryRun := flag.Bool("dry-run", false, "list images that would be processed without writing anything")
+	flag.Parse()
+
+	args := make([]string, 0)
+	if *envPath != "" {
+		args = append(args, "--env", *envPath)
+	}
+	cfg, err := config.LoadConfig(args)
+	if err != nil {
+		log.Fatalf("load config failed:\n%v", err)
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewObjectStorage(ctx, cfg.Storage())
+	if err != nil {
+		log.Fatalf("init storage failed: %v", err)
+	}
+	defer store.Close()
+
+	db := databases.DbConnect(cfg.Db())
+	defer db.Close()
+
+	repo := productRepository.ProductRepository(db)
+	fileUsecase := filesUsecase.FilesUsecase(cfg, filesRepository.FilesRepository(db), store)
+	limits := &imaging.Limits{
+		MaxDimension: cfg.App().ImageMaxDimension(),
+		MaxPixels:    cfg.App().ImageMaxPixels(),
+	}
+
+	var done, failed int
+	afterId := ""
+	for {
+		images, err := repo.FindImagesWithoutVariants(afterId, *batch)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(images) == 0 {
+			break
+		}
+		afterId = images[len(images)-1].Id
+
+		for _, img := range images {
+			if *dryRun {
+				log.Printf("would process %s %s", img.Id, img.Url)
+				done++
+				continue
+			}
+			if err := backfill(ctx, store, fileUsecase, repo, limits, img); err != nil {
+				log.Printf("skip %s: %v", img.Id, err)
+				failed++
+				continue
+			}
+			log.Printf("processed %s", img.Id)
+			done++
+		}
+	}
+	log.Printf("done: %d processed, %d failed", done, failed)
+}
+
+func backfill(
+	ctx context.Context,
+	store storage.IObjectStorage,
+	fileUsecase filesUsecase.IFilesUsecase,
+	repo productRepository.IProductRepository,
+	limits *imaging.Limits,
+	img *entities.ImageRes,
+) error {
+	key, ok := store.Key(img.Url)
+	if !ok {
+		return errNotInStorage
+	}
+
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	decoded, err := imaging.Decode(data, limits)
+	if err != nil {
+		return err
+	}
+	variants, err := fileUsecase.CreateVariants(key, decoded)
+	if err != nil {
+		return err
+	}
+
+	img.Width = decoded.Width
+	img.Height = decoded.Height
+	img.Variants = variants
+	return repo.UpdateImageVariants(img)
+}
@@ -0,0 +1,69 @@
+// import-products นำเข้าสินค้าจากไฟล์ CSV, JSON หรือ NDJSON แบบเดียวกับ POST /product/import
+// ตรวจทุกแถวก่อน ถ้ามีแถวที่ผิดจะไม่บันทึกอะไรเลย ใช้ -dry-run เพื่อตรวจอย่างเดียว
+//
+//	go run ./cmd/import-products -env .env -file products.csv -dry-run
+//	go run ./cmd/import-products -env .env -file products.ndjson
+//
+// config อื่น ๆ อ่านจาก .env และ environment variable เหมือน server
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/databases"
+)
+
+func main() {
+	envPath := flag.String("env", "", "path to .env file (optional)")
+	filePath := flag.String("file", "", "file to import (.csv, .json or .ndjson)")
+	format := flag.String("format", "", "csv, json or ndjson (default: from file extension)")
+	dryRun := flag.Bool("dry-run", false, "validate every row without writing anything")
+	flag.Parse()
+
+	if *filePath == "" {
+		log.Fatalf("-file is required")
+	}
+	if *format == "" {
+		*format = product.DetectFormat(*filePath, "")
+	}
+
+	args := make([]string, 0)
+	if *envPath != "" {
+		args = append(args, "--env", *envPath)
+	}
+	cfg, err := config.LoadConfig(args)
+	if err != nil {
+		log.Fatalf("load config failed:\n%v", err)
+	}
+
+	f, err := os.Open(*filePath)
+	if err != nil {
+		log.Fatalf("open import file failed: %v", err)
+	}
+	defer f.Close()
+
+	db := databases.DbConnect(cfg.Db())
+	defer db.Close()
+
+	usecase := productUsecase.ProductUsecase(productRepository.ProductRepository(db), cfg)
+	report, err := usecase.ImportProducts(f, *format, *dryRun, "")
+	if err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("encode report failed: %v", err)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
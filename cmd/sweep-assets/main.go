@@ -0,0 +1,63 @@
+// sweep-assets ลบไฟล์ใน storage ที่ไม่มีสินค้าหรือผู้ใช้อ้างถึงนานกว่า grace period
+// ใช้ -dry-run เพื่อดูรายการที่จะถูกลบก่อน
+//
+//	go run ./cmd/sweep-assets -env .env -dry-run
+//	go run ./cmd/sweep-assets -env .env -grace 72h
+//
+// config อื่น ๆ อ่านจาก .env และ environment variable เหมือน server
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/databases"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/storage"
+)
+
+func main() {
+	envPath := flag.String("env", "", "path to .env file (optional)")
+	grace := flag.Duration("grace", 0, "override STORAGE_SWEEP_GRACE_PERIOD, e.g. 72h")
+	dryRun := flag.Bool("dry-run", false, "print files that would be deleted without deleting them")
+	flag.Parse()
+
+	args := make([]string, 0)
+	if *envPath != "" {
+		args = append(args, "--env", *envPath)
+	}
+	cfg, err := config.LoadConfig(args)
+	if err != nil {
+		log.Fatalf("load config failed:\n%v", err)
+	}
+	if *grace == 0 {
+		*grace = cfg.Storage().SweepGracePeriod()
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewObjectStorage(ctx, cfg.Storage())
+	if err != nil {
+		log.Fatalf("init storage failed: %v", err)
+	}
+	defer store.Close()
+
+	db := databases.DbConnect(cfg.Db())
+	defer db.Close()
+
+	usecase := filesUsecase.FilesUsecase(cfg, filesRepository.FilesRepository(db), store)
+	report, err := usecase.SweepAssets(ctx, *grace, *dryRun)
+	if err != nil {
+		log.Printf("sweep failed: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("encode report failed: %v", err)
+	}
+}
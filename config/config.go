@@ -2,147 +2,107 @@ package config
 
 import (
 	"fmt"
-	"log"
-	"math"
-	"strconv"
+	"io"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
-func LoadConfig(path string) IConfig {
-	envMap, err := godotenv.Read(path)
-	if err != nil {
-		log.Fatalf("load dotenv failed: %v", err)
-	}
-
-	return &config{
-		app: &app{
-			host: envMap["APP_HOST"],
-			port: func() int {
-				p, err := strconv.Atoi(envMap["APP_PORT"])
-				if err != nil {
-					log.Fatalf("load port failed: %v", err)
-				}
-				return p
-			}(),
-			name:    envMap["APP_NAME"],
-			version: envMap["APP_VERSION"],
-			readTimeout: func() time.Duration {
-				t, err := strconv.Atoi(envMap["APP_READ_TIMEOUT"])
-				if err != nil {
-					log.Fatalf("load read timeout failed: %v", err)
-				}
-				return time.Duration(int64(t) * int64(math.Pow10(9)))
-			}(),
-			writeTimeout: func() time.Duration {
-				t, err := strconv.Atoi(envMap["APP_WRITE_TIMEOUT"])
-				if err != nil {
-					log.Fatalf("load write timeout failed: %v", err)
-				}
-				return time.Duration(int64(t) * int64(math.Pow10(9)))
-			}(),
-			bodyLimit: func() int {
-				b, err := strconv.Atoi(envMap["APP_BODY_LIMIT"])
-				if err != nil {
-					log.Fatalf("load body limit failed: %v", err)
-				}
-				return b
-			}(),
-			fileLimit: func() int {
-				b, err := strconv.Atoi(envMap["APP_FILE_LIMIT"])
-				if err != nil {
-					log.Fatalf("load file limit failed: %v", err)
-				}
-				return b
-			}(),
-			gcpbucket: envMap["APP_GCP_BUCKET"],
-		},
-		db: &db{
-			host: envMap["DB_HOST"],
-			port: func() int {
-				p, err := strconv.Atoi(envMap["DB_PORT"])
-				if err != nil {
-					log.Fatalf("load db port failed: %v", err)
-				}
-				return p
-			}(),
-			protocol: envMap["DB_PROTOCOL"],
-			username: envMap["DB_USERNAME"],
-			password: envMap["DB_PASSWORD"],
-			database: envMap["DB_DATABASE"],
-			sslMode:  envMap["DB_SSL_MODE"],
-			maxConnections: func() int {
-				m, err := strconv.Atoi(envMap["DB_MAX_CONNECTIONS"])
-				if err != nil {
-					log.Fatalf("load db max connections failed: %v", err)
-				}
-				return m
-			}(),
-		},
-		jwt: &jwt{
-			secertKey: envMap["JWT_SECRET_KEY"],
-			accessExpiresAt: func() int {
-				t, err := strconv.Atoi(envMap["JWT_ACCESS_EXPIRES"])
-				if err != nil {
-					log.Fatalf("load access expires at failed: %v", err)
-				}
-				return t
-			}(),
-		},
-	}
-}
-
 type IConfig interface {
 	App() IAppConfig
 	Db() IDbConfig
 	Jwt() IJwtConfig
+	Cors() ICorsConfig
+	Storage() IStorageConfig
+	Inventory() IInventoryConfig
+	Notify() INotifyConfig
+	PrintConfig() bool
+	Dump(w io.Writer)
 }
 
 type config struct {
-	app *app
-	db  *db
-	jwt *jwt
+	app         *app
+	db          *db
+	jwt         *jwt
+	cors        *cors
+	storage     *storage
+	inventory   *inventory
+	notify      *notify
+	printConfig bool              // --print-config
+	values      map[string]string // raw values after layering, used by Dump
 }
 
+func (c *config) PrintConfig() bool { return c.printConfig }
+
 type IAppConfig interface {
 	Url() string // host:port
 	Name() string
 	Version() string
 	ReadTimeout() time.Duration
 	WriteTimeout() time.Duration
+	ShutdownTimeout() time.Duration
+	IdleTimeout() time.Duration
+	HeaderLimit() int
+	JsonLimit() int
+	TrustedProxies() []string
+	ProxyHeader() string
+	HstsMaxAge() int
+	Csp() string
 	BodyLimit() int
 	FileLimit() int
-	GCPBucket() string
+	ImageMaxDimension() int
+	ImageMaxPixels() int
 	Host() string
 	Port() int
+	LogLevel() string
+	SuggestRefresh() time.Duration
 }
 
 type app struct {
-	host         string
-	port         int
-	name         string
-	version      string
-	readTimeout  time.Duration
-	writeTimeout time.Duration
-	bodyLimit    int //bytes
-	fileLimit    int //bytes
-	gcpbucket    string
+	host            string
+	port            int
+	name            string
+	version         string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	shutdownTimeout time.Duration
+	idleTimeout     time.Duration
+	headerLimit     int //bytes
+	jsonLimit       int //bytes
+	trustedProxies  []string
+	proxyHeader     string
+	hstsMaxAge      int //sec
+	csp             string
+	bodyLimit       int           //bytes
+	fileLimit       int           //bytes
+	imageMaxDim     int           //px
+	imageMaxPixels  int           //px
+	logLevel        string        // debug, info, warn, error
+	suggestRefresh  time.Duration // 0 = สร้างใหม่เฉพาะตอนสินค้าเปลี่ยน
 }
 
 func (c *config) App() IAppConfig {
 	return c.app
 }
-func (a *app) Url() string                 { return fmt.Sprintf("%s:%d", a.host, a.port) } // host:port
-func (a *app) Name() string                { return a.name }
-func (a *app) Version() string             { return a.version }
-func (a *app) ReadTimeout() time.Duration  { return a.readTimeout }
-func (a *app) WriteTimeout() time.Duration { return a.writeTimeout }
-func (a *app) BodyLimit() int              { return a.bodyLimit }
-func (a *app) FileLimit() int              { return a.fileLimit }
-func (a *app) GCPBucket() string           { return a.gcpbucket }
-func (a *app) Host() string                { return a.host }
-func (a *app) Port() int                   { return a.port }
+func (a *app) Url() string                    { return fmt.Sprintf("%s:%d", a.host, a.port) } // host:port
+func (a *app) Name() string                   { return a.name }
+func (a *app) Version() string                { return a.version }
+func (a *app) ReadTimeout() time.Duration     { return a.readTimeout }
+func (a *app) WriteTimeout() time.Duration    { return a.writeTimeout }
+func (a *app) ShutdownTimeout() time.Duration { return a.shutdownTimeout }
+func (a *app) IdleTimeout() time.Duration     { return a.idleTimeout }
+func (a *app) HeaderLimit() int               { return a.headerLimit }
+func (a *app) JsonLimit() int                 { return a.jsonLimit }
+func (a *app) TrustedProxies() []string       { return a.trustedProxies }
+func (a *app) ProxyHeader() string            { return a.proxyHeader }
+func (a *app) HstsMaxAge() int                { return a.hstsMaxAge }
+func (a *app) Csp() string                    { return a.csp }
+func (a *app) BodyLimit() int                 { return a.bodyLimit }
+func (a *app) FileLimit() int                 { return a.fileLimit }
+func (a *app) ImageMaxDimension() int         { return a.imageMaxDim }
+func (a *app) ImageMaxPixels() int            { return a.imageMaxPixels }
+func (a *app) Host() string                   { return a.host }
+func (a *app) Port() int                      { return a.port }
+func (a *app) LogLevel() string               { return a.logLevel }
+func (a *app) SuggestRefresh() time.Duration  { return a.suggestRefresh }
 
 type IDbConfig interface {
 	Url() string
@@ -193,3 +153,149 @@ func (c *config) Jwt() IJwtConfig {
 func (j *jwt) SecretKey() []byte         { return []byte(j.secertKey) }
 func (j *jwt) AccessExpiresAt() int      { return j.accessExpiresAt }
 func (j *jwt) SetJwtAccessExpires(t int) { j.accessExpiresAt = t }
+
+type ICorsConfig interface {
+	Public() ICorsPolicy // storefront และ route ที่อ่านข้อมูลทั่วไป
+	Admin() ICorsPolicy  // route ของ admin
+}
+
+type ICorsPolicy interface {
+	AllowOrigins() []string
+	AllowHeaders() []string
+	ExposeHeaders() []string
+	AllowCredentials() bool
+	MaxAge() int
+}
+
+type cors struct {
+	public *corsPolicy
+	admin  *corsPolicy
+}
+
+type corsPolicy struct {
+	allowOrigins     []string
+	allowHeaders     []string
+	exposeHeaders    []string
+	allowCredentials bool
+	maxAge           int //sec
+}
+
+func (c *config) Cors() ICorsConfig {
+	return c.cors
+}
+func (c *cors) Public() ICorsPolicy { return c.public }
+func (c *cors) Admin() ICorsPolicy  { return c.admin }
+
+func (p *corsPolicy) AllowOrigins() []string  { return p.allowOrigins }
+func (p *corsPolicy) AllowHeaders() []string  { return p.allowHeaders }
+func (p *corsPolicy) ExposeHeaders() []string { return p.exposeHeaders }
+func (p *corsPolicy) AllowCredentials() bool  { return p.allowCredentials }
+func (p *corsPolicy) MaxAge() int             { return p.maxAge }
+
+type IStorageConfig interface {
+	Backend() string
+	Bucket() string
+	PublicUrl() string
+	LocalDir() string
+	SigningKey() []byte
+	S3Endpoint() string
+	S3Region() string
+	S3AccessKey() string
+	S3SecretKey() string
+	S3UseSSL() bool
+	UploadUrlExpires() time.Duration
+	UploadWorkers() int
+	SweepInterval() time.Duration
+	SweepGracePeriod() time.Duration
+	SweepBatch() int
+	SweepDryRun() bool
+}
+
+type storage struct {
+	backend          string // gcs, local, s3
+	bucket           string
+	publicUrl        string // without trailing slash
+	localDir         string
+	signingKey       string
+	s3Endpoint       string
+	s3Region         string
+	s3AccessKey      string
+	s3SecretKey      string
+	s3UseSSL         bool
+	uploadUrlExpires time.Duration
+	uploadWorkers    int
+	sweepInterval    time.Duration // 0 = ปิด sweeper
+	sweepGracePeriod time.Duration
+	sweepBatch       int
+	sweepDryRun      bool
+}
+
+func (c *config) Storage() IStorageConfig {
+	return c.storage
+}
+func (s *storage) Backend() string                 { return s.backend }
+func (s *storage) Bucket() string                  { return s.bucket }
+func (s *storage) PublicUrl() string               { return s.publicUrl }
+func (s *storage) LocalDir() string                { return s.localDir }
+func (s *storage) SigningKey() []byte              { return []byte(s.signingKey) }
+func (s *storage) S3Endpoint() string              { return s.s3Endpoint }
+func (s *storage) S3Region() string                { return s.s3Region }
+func (s *storage) S3AccessKey() string             { return s.s3AccessKey }
+func (s *storage) S3SecretKey() string             { return s.s3SecretKey }
+func (s *storage) S3UseSSL() bool                  { return s.s3UseSSL }
+func (s *storage) UploadUrlExpires() time.Duration { return s.uploadUrlExpires }
+func (s *storage) UploadWorkers() int              { return s.uploadWorkers }
+func (s *storage) SweepInterval() time.Duration    { return s.sweepInterval }
+func (s *storage) SweepGracePeriod() time.Duration { return s.sweepGracePeriod }
+func (s *storage) SweepBatch() int                 { return s.sweepBatch }
+func (s *storage) SweepDryRun() bool               { return s.sweepDryRun }
+
+type IInventoryConfig interface {
+	LowStockThreshold() int
+	CheckInterval() time.Duration
+}
+
+type inventory struct {
+	lowStockThreshold int           // ใช้กับสินค้าที่ไม่ได้ตั้ง threshold เอง
+	checkInterval     time.Duration // 0 = ปิดการเช็ค stock
+}
+
+func (c *config) Inventory() IInventoryConfig {
+	return c.inventory
+}
+func (i *inventory) LowStockThreshold() int       { return i.lowStockThreshold }
+func (i *inventory) CheckInterval() time.Duration { return i.checkInterval }
+
+type INotifyConfig interface {
+	Backend() string
+	File() string
+	AdminEmails() []string
+	SmtpHost() string
+	SmtpPort() int
+	SmtpUsername() string
+	SmtpPassword() string
+	SmtpFrom() string
+}
+
+type notify struct {
+	backend      string // log, file, email
+	file         string
+	adminEmails  []string // ว่าง = ส่งถึง admin ทุกคนใน "User"
+	smtpHost     string
+	smtpPort     int
+	smtpUsername string
+	smtpPassword string
+	smtpFrom     string
+}
+
+func (c *config) Notify() INotifyConfig {
+	return c.notify
+}
+func (n *notify) Backend() string       { return n.backend }
+func (n *notify) File() string          { return n.file }
+func (n *notify) AdminEmails() []string { return n.adminEmails }
+func (n *notify) SmtpHost() string      { return n.smtpHost }
+func (n *notify) SmtpPort() int         { return n.smtpPort }
+func (n *notify) SmtpUsername() string  { return n.smtpUsername }
+func (n *notify) SmtpPassword() string  { return n.smtpPassword }
+func (n *notify) SmtpFrom() string      { return n.smtpFrom }
@@ -0,0 +1,404 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// setting คือค่า config หนึ่งตัว ชื่อ key ตรงกับชื่อใน .env และ environment variable
+type setting struct {
+	key    string
+	def    string // ค่าเริ่มต้น ถ้าเป็น "" แปลว่าไม่มีค่าเริ่มต้น
+	secret bool   // ซ่อนค่าตอน --print-config
+	usage  string
+}
+
+// ลำดับใน slice นี้คือลำดับตอน --print-config
+var settings = []*setting{
+	{key: "APP_HOST", def: "0.0.0.0", usage: "host to listen on"},
+	{key: "APP_PORT", def: "3000", usage: "port to listen on (falls back to PORT)"},
+	{key: "APP_NAME", def: "cicero-api", usage: "application name"},
+	{key: "APP_VERSION", def: "v0.1.0", usage: "application version"},
+	{key: "APP_READ_TIMEOUT", def: "60", usage: "read timeout in seconds"},
+	{key: "APP_WRITE_TIMEOUT", def: "60", usage: "write timeout in seconds"},
+	{key: "APP_SHUTDOWN_TIMEOUT", def: "10", usage: "graceful shutdown drain timeout in seconds"},
+	{key: "APP_BODY_LIMIT", def: "10490000", usage: "request body limit in bytes"},
+	{key: "APP_FILE_LIMIT", def: "2097000", usage: "upload file limit in bytes"},
+	{key: "APP_IMAGE_MAX_DIMENSION", def: "8000", usage: "max width or height of uploaded images in pixels"},
+	{key: "APP_IMAGE_MAX_PIXELS", def: "40000000", usage: "max width*height of uploaded images, guards against decompression bombs"},
+	{key: "APP_IDLE_TIMEOUT", def: "60", usage: "keep-alive idle timeout in seconds"},
+	{key: "APP_HEADER_LIMIT", def: "8192", usage: "max request header size in bytes"},
+	{key: "APP_JSON_LIMIT", def: "1048576", usage: "max JSON request body size in bytes"},
+	{key: "APP_TRUSTED_PROXIES", usage: "comma separated IPs or CIDRs of load balancers allowed to set APP_PROXY_HEADER"},
+	{key: "APP_PROXY_HEADER", def: "X-Forwarded-For", usage: "header holding the client ip when behind a trusted proxy"},
+	{key: "APP_HSTS_MAX_AGE", def: "31536000", usage: "Strict-Transport-Security max-age in seconds, 0 to disable"},
+	{key: "APP_CSP", def: "default-src 'self'; frame-ancestors 'none'; base-uri 'self'; form-action 'self'", usage: "Content-Security-Policy for HTML responses"},
+	{key: "APP_GCP_BUCKET", usage: "deprecated, use STORAGE_BUCKET"},
+	{key: "APP_LOG_LEVEL", def: "info", usage: "debug (also prints response bodies), info, warn (4xx and 5xx requests only) or error (5xx only)"},
+	{key: "APP_SUGGEST_REFRESH", def: "300", usage: "how often to rebuild the product autocomplete index in seconds, 0 to rebuild only when products change"},
+	{key: "DB_HOST", def: "127.0.0.1", usage: "database host"},
+	{key: "DB_PORT", def: "5432", usage: "database port"},
+	{key: "DB_PROTOCOL", def: "tcp", usage: "database protocol"},
+	{key: "DB_USERNAME", usage: "database username"},
+	{key: "DB_PASSWORD", secret: true, usage: "database password"},
+	{key: "DB_DATABASE", usage: "database name"},
+	{key: "DB_SSL_MODE", def: "disable", usage: "database ssl mode"},
+	{key: "DB_MAX_CONNECTIONS", def: "25", usage: "database max open connections"},
+	{key: "JWT_SECRET_KEY", secret: true, usage: "secret for signing access tokens"},
+	{key: "JWT_ACCESS_EXPIRES", def: "86400", usage: "access token lifetime in seconds"},
+	{key: "CORS_ALLOW_ORIGINS", def: "*", usage: "comma separated list of allowed origins"},
+	{key: "CORS_ALLOW_HEADERS", def: "Origin,Content-Type,Accept,Authorization", usage: "comma separated list of allowed request headers"},
+	{key: "CORS_EXPOSE_HEADERS", usage: "comma separated list of response headers exposed to the browser"},
+	{key: "CORS_ALLOW_CREDENTIALS", def: "false", usage: "allow cookies and credentials, not allowed with origin *"},
+	{key: "CORS_MAX_AGE", def: "0", usage: "preflight cache time in seconds"},
+	{key: "CORS_ADMIN_ALLOW_ORIGINS", usage: "allowed origins for admin routes, defaults to CORS_ALLOW_ORIGINS"},
+	{key: "CORS_ADMIN_ALLOW_HEADERS", usage: "allowed headers for admin routes, defaults to CORS_ALLOW_HEADERS"},
+	{key: "CORS_ADMIN_EXPOSE_HEADERS", usage: "exposed headers for admin routes, defaults to CORS_EXPOSE_HEADERS"},
+	{key: "CORS_ADMIN_ALLOW_CREDENTIALS", usage: "allow credentials for admin routes, defaults to CORS_ALLOW_CREDENTIALS"},
+	{key: "CORS_ADMIN_MAX_AGE", usage: "preflight cache time for admin routes, defaults to CORS_MAX_AGE"},
+	{key: "STORAGE_BACKEND", def: "gcs", usage: "object storage backend: gcs, local or s3"},
+	{key: "STORAGE_BUCKET", usage: "bucket name for gcs and s3, defaults to APP_GCP_BUCKET"},
+	{key: "STORAGE_PUBLIC_URL", usage: "base url of public objects for local and s3, local defaults to http://localhost:APP_PORT/static"},
+	{key: "STORAGE_LOCAL_DIR", def: "./assets/uploads", usage: "directory for the local backend"},
+	{key: "STORAGE_SIGNING_KEY", secret: true, usage: "secret for local signed urls, defaults to JWT_SECRET_KEY"},
+	{key: "STORAGE_S3_ENDPOINT", def: "s3.amazonaws.com", usage: "s3 compatible endpoint host[:port], e.g. localhost:9000 for MinIO"},
+	{key: "STORAGE_S3_REGION", usage: "s3 region"},
+	{key: "STORAGE_S3_ACCESS_KEY", secret: true, usage: "s3 access key"},
+	{key: "STORAGE_S3_SECRET_KEY", secret: true, usage: "s3 secret key"},
+	{key: "STORAGE_S3_USE_SSL", def: "true", usage: "use https for the s3 endpoint"},
+	{key: "STORAGE_UPLOAD_URL_EXPIRES", def: "900", usage: "lifetime of signed direct upload urls in seconds"},
+	{key: "STORAGE_UPLOAD_WORKERS", def: "5", usage: "files uploaded to or deleted from storage concurrently per request"},
+	{key: "STORAGE_SWEEP_INTERVAL", def: "3600", usage: "how often to delete unreferenced files in seconds, 0 to disable"},
+	{key: "STORAGE_SWEEP_GRACE_PERIOD", def: "86400", usage: "how long a file stays unreferenced before it is deleted, in seconds"},
+	{key: "STORAGE_SWEEP_BATCH", def: "100", usage: "files deleted per query by the sweeper"},
+	{key: "STORAGE_SWEEP_DRY_RUN", def: "false", usage: "only log files the sweeper would delete"},
+	{key: "INVENTORY_LOW_STOCK_THRESHOLD", def: "5", usage: "default available quantity at or below which a variant is low on stock"},
+	{key: "INVENTORY_CHECK_INTERVAL", def: "300", usage: "how often to check for low stock and restocked variants in seconds, 0 to disable"},
+	{key: "NOTIFY_BACKEND", def: "log", usage: "where notifications are sent: log, file or email"},
+	{key: "NOTIFY_FILE", def: "./notifications.log", usage: "file the file backend appends notifications to"},
+	{key: "NOTIFY_ADMIN_EMAILS", usage: "comma separated recipients of admin alerts, defaults to every admin user"},
+	{key: "SMTP_HOST", usage: "smtp host for the email backend"},
+	{key: "SMTP_PORT", def: "587", usage: "smtp port"},
+	{key: "SMTP_USERNAME", usage: "smtp username, empty to send without auth"},
+	{key: "SMTP_PASSWORD", secret: true, usage: "smtp password"},
+	{key: "SMTP_FROM", usage: "sender address of notification emails"},
+}
+
+// LoadConfig อ่าน config เป็นชั้น ๆ โดยชั้นหลังทับชั้นก่อน:
+// ค่าเริ่มต้น -> ไฟล์ .env (ถ้ามี) -> environment variable -> flags
+//
+// path ของ .env ส่งมาได้ทั้งแบบ positional (myapp .env.prod) หรือ --env
+func LoadConfig(args []string) (IConfig, error) {
+	fs := flag.NewFlagSet("cicero", flag.ContinueOnError)
+	envPath := fs.String("env", "", "path to .env file (optional)")
+	printConfig := fs.Bool("print-config", false, "print the resolved config with secrets redacted and exit")
+	flagValues := make(map[string]*string)
+	for _, s := range settings {
+		flagValues[s.key] = fs.String(flagName(s.key), "", s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *envPath == "" && fs.NArg() > 0 {
+		*envPath = fs.Arg(0)
+	}
+
+	// 1. defaults
+	values := make(map[string]string)
+	for _, s := range settings {
+		values[s.key] = s.def
+	}
+
+	// 2. .env file
+	if *envPath != "" {
+		envMap, err := godotenv.Read(*envPath)
+		if err != nil {
+			return nil, fmt.Errorf("load dotenv failed: %v", err)
+		}
+		for k, v := range envMap {
+			values[k] = v
+		}
+	}
+
+	// 3. process environment
+	if port, ok := os.LookupEnv("PORT"); ok {
+		values["APP_PORT"] = port
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.key); ok {
+			values[s.key] = v
+		}
+	}
+
+	// 4. flags, only the ones that were passed
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if flagName(s.key) == f.Name {
+				values[s.key] = *flagValues[s.key]
+			}
+		}
+	})
+
+	p := &parser{values: values}
+	cfg := p.build()
+	cfg.printConfig = *printConfig
+	if err := errors.Join(p.errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// APP_PORT -> app-port
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// parser แปลงค่าแบบ string เป็น type ที่ต้องการ โดยเก็บ error ไว้ทั้งหมดแทนการหยุดที่ตัวแรก
+type parser struct {
+	values map[string]string
+	errs   []error
+}
+
+func (p *parser) fail(key, format string, args ...any) {
+	p.errs = append(p.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (p *parser) str(key string) string {
+	return strings.TrimSpace(p.values[key])
+}
+
+func (p *parser) required(key string) string {
+	v := p.str(key)
+	if v == "" {
+		p.fail(key, "is required")
+	}
+	return v
+}
+
+func (p *parser) int(key string, min int) int {
+	v := p.str(key)
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		p.fail(key, "%q is not an integer", v)
+		return 0
+	}
+	if n < min {
+		p.fail(key, "must be at least %d", min)
+	}
+	return n
+}
+
+func (p *parser) seconds(key string) time.Duration {
+	return time.Duration(p.int(key, 0)) * time.Second
+}
+
+func (p *parser) bool(key string) bool {
+	v := p.str(key)
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		p.fail(key, "%q is not a boolean", v)
+	}
+	return b
+}
+
+// ถ้า key ไม่ได้ตั้งค่าไว้ ให้ใช้ค่าของ fallback แทน
+func (p *parser) inherit(key, fallback string) string {
+	if p.str(key) == "" {
+		return fallback
+	}
+	return key
+}
+
+func (p *parser) list(key string) []string {
+	result := make([]string, 0)
+	for _, v := range strings.Split(p.str(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func (p *parser) oneOf(key string, options ...string) string {
+	v := strings.ToLower(p.str(key))
+	for _, o := range options {
+		if v == o {
+			return v
+		}
+	}
+	p.fail(key, "%q must be one of %s", v, strings.Join(options, ", "))
+	return v
+}
+
+func (p *parser) build() *config {
+	cfg := &config{
+		app: &app{
+			host:            p.str("APP_HOST"),
+			port:            p.int("APP_PORT", 1),
+			name:            p.str("APP_NAME"),
+			version:         p.str("APP_VERSION"),
+			readTimeout:     p.seconds("APP_READ_TIMEOUT"),
+			writeTimeout:    p.seconds("APP_WRITE_TIMEOUT"),
+			shutdownTimeout: p.seconds("APP_SHUTDOWN_TIMEOUT"),
+			idleTimeout:     p.seconds("APP_IDLE_TIMEOUT"),
+			headerLimit:     p.int("APP_HEADER_LIMIT", 1024),
+			jsonLimit:       p.int("APP_JSON_LIMIT", 1),
+			trustedProxies:  p.list("APP_TRUSTED_PROXIES"),
+			proxyHeader:     p.str("APP_PROXY_HEADER"),
+			hstsMaxAge:      p.int("APP_HSTS_MAX_AGE", 0),
+			csp:             p.str("APP_CSP"),
+			bodyLimit:       p.int("APP_BODY_LIMIT", 1),
+			fileLimit:       p.int("APP_FILE_LIMIT", 1),
+			imageMaxDim:     p.int("APP_IMAGE_MAX_DIMENSION", 1),
+			imageMaxPixels:  p.int("APP_IMAGE_MAX_PIXELS", 1),
+			logLevel:        p.oneOf("APP_LOG_LEVEL", "debug", "info", "warn", "error"),
+			suggestRefresh:  p.seconds("APP_SUGGEST_REFRESH"),
+		},
+		db: &db{
+			host:           p.required("DB_HOST"),
+			port:           p.int("DB_PORT", 1),
+			protocol:       p.str("DB_PROTOCOL"),
+			username:       p.required("DB_USERNAME"),
+			password:       p.str("DB_PASSWORD"),
+			database:       p.required("DB_DATABASE"),
+			sslMode:        p.str("DB_SSL_MODE"),
+			maxConnections: p.int("DB_MAX_CONNECTIONS", 1),
+		},
+		jwt: &jwt{
+			secertKey:       p.required("JWT_SECRET_KEY"),
+			accessExpiresAt: p.int("JWT_ACCESS_EXPIRES", 1),
+		},
+		cors: &cors{
+			public: p.corsPolicy("CORS_"),
+			admin:  p.corsPolicy("CORS_ADMIN_"),
+		},
+		storage: &storage{
+			backend:          p.oneOf("STORAGE_BACKEND", "gcs", "local", "s3"),
+			bucket:           p.str(p.inherit("STORAGE_BUCKET", "APP_GCP_BUCKET")),
+			publicUrl:        strings.TrimSuffix(p.str("STORAGE_PUBLIC_URL"), "/"),
+			localDir:         p.str("STORAGE_LOCAL_DIR"),
+			signingKey:       p.str(p.inherit("STORAGE_SIGNING_KEY", "JWT_SECRET_KEY")),
+			s3Endpoint:       p.str("STORAGE_S3_ENDPOINT"),
+			s3Region:         p.str("STORAGE_S3_REGION"),
+			s3AccessKey:      p.str("STORAGE_S3_ACCESS_KEY"),
+			s3SecretKey:      p.str("STORAGE_S3_SECRET_KEY"),
+			s3UseSSL:         p.bool("STORAGE_S3_USE_SSL"),
+			uploadUrlExpires: p.seconds("STORAGE_UPLOAD_URL_EXPIRES"),
+			uploadWorkers:    p.int("STORAGE_UPLOAD_WORKERS", 1),
+			sweepInterval:    p.seconds("STORAGE_SWEEP_INTERVAL"),
+			sweepGracePeriod: p.seconds("STORAGE_SWEEP_GRACE_PERIOD"),
+			sweepBatch:       p.int("STORAGE_SWEEP_BATCH", 1),
+			sweepDryRun:      p.bool("STORAGE_SWEEP_DRY_RUN"),
+		},
+		inventory: &inventory{
+			lowStockThreshold: p.int("INVENTORY_LOW_STOCK_THRESHOLD", 0),
+			checkInterval:     p.seconds("INVENTORY_CHECK_INTERVAL"),
+		},
+		notify: &notify{
+			backend:      p.oneOf("NOTIFY_BACKEND", "log", "file", "email"),
+			file:         p.str("NOTIFY_FILE"),
+			adminEmails:  p.list("NOTIFY_ADMIN_EMAILS"),
+			smtpHost:     p.str("SMTP_HOST"),
+			smtpPort:     p.int("SMTP_PORT", 1),
+			smtpUsername: p.str("SMTP_USERNAME"),
+			smtpPassword: p.str("SMTP_PASSWORD"),
+			smtpFrom:     p.str("SMTP_FROM"),
+		},
+		values: p.values,
+	}
+
+	if cfg.app.port > 65535 {
+		p.fail("APP_PORT", "must be at most 65535")
+	}
+	switch cfg.storage.backend {
+	case "gcs":
+		if cfg.storage.bucket == "" {
+			p.fail("STORAGE_BUCKET", "is required when STORAGE_BACKEND is gcs")
+		}
+	case "local":
+		if cfg.storage.localDir == "" {
+			p.fail("STORAGE_LOCAL_DIR", "is required when STORAGE_BACKEND is local")
+		}
+		if cfg.storage.publicUrl == "" {
+			cfg.storage.publicUrl = fmt.Sprintf("http://localhost:%d/static", cfg.app.port)
+		}
+	case "s3":
+		if cfg.storage.bucket == "" {
+			p.fail("STORAGE_BUCKET", "is required when STORAGE_BACKEND is s3")
+		}
+		if cfg.storage.s3AccessKey == "" || cfg.storage.s3SecretKey == "" {
+			p.fail("STORAGE_S3_ACCESS_KEY", "and STORAGE_S3_SECRET_KEY are required when STORAGE_BACKEND is s3")
+		}
+	}
+	switch cfg.notify.backend {
+	case "file":
+		if cfg.notify.file == "" {
+			p.fail("NOTIFY_FILE", "is required when NOTIFY_BACKEND is file")
+		}
+	case "email":
+		if cfg.notify.smtpHost == "" || cfg.notify.smtpFrom == "" {
+			p.fail("SMTP_HOST", "and SMTP_FROM are required when NOTIFY_BACKEND is email")
+		}
+	}
+	for _, c := range []struct {
+		prefix string
+		policy *corsPolicy
+	}{{"CORS_", cfg.cors.public}, {"CORS_ADMIN_", cfg.cors.admin}} {
+		if len(c.policy.allowOrigins) == 0 {
+			p.fail(c.prefix+"ALLOW_ORIGINS", "must not be empty")
+		}
+		for _, o := range c.policy.allowOrigins {
+			if o == "*" && c.policy.allowCredentials {
+				p.fail(c.prefix+"ALLOW_CREDENTIALS", "cannot be used with origin *")
+			}
+		}
+	}
+	for _, proxy := range cfg.app.trustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				p.fail("APP_TRUSTED_PROXIES", "%q is not an ip or cidr", proxy)
+			}
+		}
+	}
+	if len(cfg.app.trustedProxies) > 0 && cfg.app.proxyHeader == "" {
+		p.fail("APP_PROXY_HEADER", "is required when APP_TRUSTED_PROXIES is set")
+	}
+	if cfg.app.fileLimit > cfg.app.bodyLimit {
+		p.fail("APP_FILE_LIMIT", "must not be greater than APP_BODY_LIMIT")
+	}
+	return cfg
+}
+
+// prefix "CORS_" คือ policy สำหรับ route ทั่วไป ส่วน "CORS_ADMIN_" ที่ไม่ได้ตั้งค่าจะใช้ค่าของ "CORS_"
+func (p *parser) corsPolicy(prefix string) *corsPolicy {
+	key := func(name string) string {
+		return p.inherit(prefix+name, "CORS_"+name)
+	}
+	return &corsPolicy{
+		allowOrigins:     p.list(key("ALLOW_ORIGINS")),
+		allowHeaders:     p.list(key("ALLOW_HEADERS")),
+		exposeHeaders:    p.list(key("EXPOSE_HEADERS")),
+		allowCredentials: p.bool(key("ALLOW_CREDENTIALS")),
+		maxAge:           p.int(key("MAX_AGE"), 0),
+	}
+}
+
+// Dump เขียน config ที่ใช้งานจริงในรูป KEY=value โดยซ่อนค่าที่เป็นความลับ
+func (c *config) Dump(w io.Writer) {
+	for _, s := range settings {
+		v := c.values[s.key]
+		if s.secret && v != "" {
+			v = "******"
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.key, v)
+	}
+}
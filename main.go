@@ -1,26 +1,46 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
 	"github.com/deeptech-kmitl/Cicero-Backend/pkg/databases"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/logger"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/notify"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/storage"
 	"github.com/deeptech-kmitl/Cicero-Backend/servers"
 )
 
 func main() {
-	// Initialize config
-	cfg := config.LoadConfig(func() string {
-		if len(os.Args) < 2 {
-			log.Fatal("Error: .env path is required")
-		}
-		return os.Args[1]
-	}())
+	// Initialize config: defaults -> .env (optional) -> environment -> flags
+	cfg, err := config.LoadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("load config failed:\n%v", err)
+	}
+	if cfg.PrintConfig() {
+		cfg.Dump(os.Stdout)
+		return
+	}
+	logger.SetLevel(cfg.App().LogLevel())
 
-	// Initialize database
+	// Initialize object storage, selected by STORAGE_BACKEND
+	store, err := storage.NewObjectStorage(context.Background(), cfg.Storage())
+	if err != nil {
+		log.Fatalf("init storage failed: %v", err)
+	}
+
+	// Initialize notifier, selected by NOTIFY_BACKEND
+	notifier, err := notify.NewNotifier(cfg.Notify())
+	if err != nil {
+		log.Fatalf("init notifier failed: %v", err)
+	}
+
+	// Initialize database, the pool, storage and notifier are closed by the server on shutdown
 	db := databases.DbConnect(cfg.Db())
-	defer db.Close()
 
-	servers.NewServer(cfg, db).Start()
+	if err := servers.NewServer(cfg, db, store, notifier).Start(); err != nil {
+		log.Fatalf("server stopped: %v", err)
+	}
 }
@@ -0,0 +1,82 @@
+package category
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Category struct {
+	Id        int         `db:"id" json:"id"`
+	ParentId  *int        `db:"parent_id" json:"parent_id"`
+	Name      string      `db:"name" json:"name"`
+	Slug      string      `db:"slug" json:"slug"`
+	SortOrder int         `db:"sort_order" json:"sort_order"`
+	IsActive  bool        `db:"is_active" json:"is_active"`
+	Children  []*Category `db:"-" json:"children,omitempty"`
+}
+
+type CategoryReq struct {
+	Id        int    `json:"-"`
+	ParentId  *int   `json:"parent_id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"` // ว่างได้ จะสร้างจากชื่อ
+	SortOrder int    `json:"sort_order"`
+	IsActive  *bool  `json:"is_active"` // ไม่ส่งมา = TRUE
+}
+
+var (
+	slugInvalidRe = regexp.MustCompile(`[^\p{L}\p{M}\p{N}]+`)
+	slugRe        = regexp.MustCompile(`^[\p{L}\p{M}\p{N}]+(-[\p{L}\p{M}\p{N}]+)*$`)
+)
+
+// Slugify แปลงชื่อเป็น slug เช่น "Men's T-Shirts" -> "men-s-t-shirts" ตัวอักษรไทยยังคงอยู่
+func Slugify(name string) string {
+	return strings.Trim(slugInvalidRe.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-"), "-")
+}
+
+func (r *CategoryReq) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	r.Slug = strings.ToLower(strings.TrimSpace(r.Slug))
+	if r.Slug == "" {
+		r.Slug = Slugify(r.Name)
+	}
+	if !slugRe.MatchString(r.Slug) {
+		return fmt.Errorf("invalid slug %q", r.Slug)
+	}
+
+	if r.ParentId != nil && *r.ParentId == r.Id {
+		return fmt.Errorf("category cannot be its own parent")
+	}
+	if r.IsActive == nil {
+		active := true
+		r.IsActive = &active
+	}
+	return nil
+}
+
+// BuildTree จัด category แบบ flat (เรียงตาม sort_order แล้ว) เป็น tree
+// category ที่ parent ไม่อยู่ใน list (เช่น parent ถูกปิด) จะไม่อยู่ใน tree
+func BuildTree(categories []*Category) []*Category {
+	byId := make(map[int]*Category, len(categories))
+	for _, c := range categories {
+		c.Children = make([]*Category, 0)
+		byId[c.Id] = c
+	}
+
+	roots := make([]*Category, 0)
+	for _, c := range categories {
+		if c.ParentId == nil {
+			roots = append(roots, c)
+			continue
+		}
+		if parent, ok := byId[*c.ParentId]; ok {
+			parent.Children = append(parent.Children, c)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,134 @@
+package categoryHandler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category/categoryUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/gofiber/fiber/v2"
+)
+
+type categoryHandlerErrCode = string
+
+const (
+	getCategoryTreeErr categoryHandlerErrCode = "category-001"
+	findCategoriesErr  categoryHandlerErrCode = "category-002"
+	addCategoryErr     categoryHandlerErrCode = "category-003"
+	updateCategoryErr  categoryHandlerErrCode = "category-004"
+	deleteCategoryErr  categoryHandlerErrCode = "category-005"
+)
+
+type ICategoryHandler interface {
+	GetCategoryTree(c *fiber.Ctx) error
+	FindCategories(c *fiber.Ctx) error
+	AddCategory(c *fiber.Ctx) error
+	UpdateCategory(c *fiber.Ctx) error
+	DeleteCategory(c *fiber.Ctx) error
+}
+
+type categoryHandler struct {
+	categoryUsecase categoryUsecase.ICategoryUsecase
+}
+
+func CategoryHandler(categoryUsecase categoryUsecase.ICategoryUsecase) ICategoryHandler {
+	return &categoryHandler{categoryUsecase}
+}
+
+func (h *categoryHandler) GetCategoryTree(c *fiber.Ctx) error {
+	result, err := h.categoryUsecase.GetCategoryTree()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(getCategoryTreeErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *categoryHandler) FindCategories(c *fiber.Ctx) error {
+	result, err := h.categoryUsecase.FindCategories()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findCategoriesErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *categoryHandler) AddCategory(c *fiber.Ctx) error {
+	req := new(category.CategoryReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(addCategoryErr),
+			err.Error(),
+		).Res()
+	}
+
+	result, err := h.categoryUsecase.AddCategory(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(addCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusCreated, result).Res()
+}
+
+func (h *categoryHandler) UpdateCategory(c *fiber.Ctx) error {
+	categoryId, err := strconv.Atoi(strings.TrimSpace(c.Params("category_id")))
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateCategoryErr),
+			"invalid category id",
+		).Res()
+	}
+
+	req := new(category.CategoryReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	req.Id = categoryId
+
+	result, err := h.categoryUsecase.UpdateCategory(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *categoryHandler) DeleteCategory(c *fiber.Ctx) error {
+	categoryId, err := strconv.Atoi(strings.TrimSpace(c.Params("category_id")))
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(deleteCategoryErr),
+			"invalid category id",
+		).Res()
+	}
+
+	result, err := h.categoryUsecase.DeleteCategory(categoryId)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(deleteCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
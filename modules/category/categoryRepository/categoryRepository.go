@@ -0,0 +1,183 @@
+package categoryRepository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category"
+	"github.com/jmoiron/sqlx"
+)
+
+type ICategoryRepository interface {
+	FindCategories(activeOnly bool) ([]*category.Category, error)
+	FindOneCategory(categoryId int) (*category.Category, error)
+	InsertCategory(req *category.CategoryReq) (*category.Category, error)
+	UpdateCategory(req *category.CategoryReq) (*category.Category, error)
+	DeleteCategory(categoryId int) error
+}
+
+type categoryRepository struct {
+	db *sqlx.DB
+}
+
+func CategoryRepository(db *sqlx.DB) ICategoryRepository {
+	return &categoryRepository{
+		db: db,
+	}
+}
+
+// FindCategories คืน category แบบ flat เรียงตาม sort_order
+// activeOnly จะตัดหมวดที่ปิดอยู่และหมวดย่อยทั้งหมดข้างใต้ออก
+func (r *categoryRepository) FindCategories(activeOnly bool) ([]*category.Category, error) {
+	query := `
+	WITH RECURSIVE "tree" AS (
+		SELECT
+			"c".*
+		FROM "Category" "c"
+		WHERE "c"."parent_id" IS NULL
+		AND ("c"."is_active" OR NOT $1)
+		UNION ALL
+		SELECT
+			"c".*
+		FROM "Category" "c"
+		JOIN "tree" "t" ON "c"."parent_id" = "t"."id"
+		WHERE ("c"."is_active" OR NOT $1)
+	)
+	SELECT
+		"id",
+		"parent_id",
+		"name",
+		"slug",
+		"sort_order",
+		"is_active"
+	FROM "tree"
+	ORDER BY "sort_order", "name";`
+
+	categories := make([]*category.Category, 0)
+	if err := r.db.Select(&categories, query, activeOnly); err != nil {
+		return nil, fmt.Errorf("find categories failed: %v", err)
+	}
+	return categories, nil
+}
+
+func (r *categoryRepository) FindOneCategory(categoryId int) (*category.Category, error) {
+	query := `
+	SELECT
+		"id",
+		"parent_id",
+		"name",
+		"slug",
+		"sort_order",
+		"is_active"
+	FROM "Category"
+	WHERE "id" = $1;`
+
+	c := new(category.Category)
+	if err := r.db.Get(c, query, categoryId); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return nil, fmt.Errorf("category not found")
+		default:
+			return nil, fmt.Errorf("get category failed: %v", err)
+		}
+	}
+	return c, nil
+}
+
+func (r *categoryRepository) InsertCategory(req *category.CategoryReq) (*category.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+	INSERT INTO "Category" (
+		"parent_id",
+		"name",
+		"slug",
+		"sort_order",
+		"is_active"
+	)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING "id";`
+
+	if err := r.db.QueryRowxContext(ctx, query, req.ParentId, req.Name, req.Slug, req.SortOrder, *req.IsActive).Scan(&req.Id); err != nil {
+		return nil, categoryErr("insert category failed", err)
+	}
+	return r.FindOneCategory(req.Id)
+}
+
+func (r *categoryRepository) UpdateCategory(req *category.CategoryReq) (*category.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// ห้ามย้ายไปอยู่ใต้หมวดย่อยของตัวเอง จะทำให้ tree วน
+	if req.ParentId != nil {
+		queryCycle := `
+		WITH RECURSIVE "descendants" AS (
+			SELECT "id" FROM "Category" WHERE "id" = $1
+			UNION ALL
+			SELECT "c"."id" FROM "Category" "c"
+			JOIN "descendants" "d" ON "c"."parent_id" = "d"."id"
+		)
+		SELECT EXISTS (SELECT 1 FROM "descendants" WHERE "id" = $2);`
+
+		var cycle bool
+		if err := r.db.GetContext(ctx, &cycle, queryCycle, req.Id, *req.ParentId); err != nil {
+			return nil, fmt.Errorf("check category parent failed: %v", err)
+		}
+		if cycle {
+			return nil, fmt.Errorf("category cannot be moved under its own subcategory")
+		}
+	}
+
+	query := `
+	UPDATE "Category" SET
+		"parent_id" = $1,
+		"name" = $2,
+		"slug" = $3,
+		"sort_order" = $4,
+		"is_active" = $5
+	WHERE "id" = $6;`
+
+	res, err := r.db.ExecContext(ctx, query, req.ParentId, req.Name, req.Slug, req.SortOrder, *req.IsActive, req.Id)
+	if err != nil {
+		return nil, categoryErr("update category failed", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("category not found")
+	}
+	return r.FindOneCategory(req.Id)
+}
+
+// DeleteCategory ลบได้เฉพาะหมวดที่ไม่มีหมวดย่อยและไม่มีสินค้า
+func (r *categoryRepository) DeleteCategory(categoryId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM "Category" WHERE "id" = $1;`
+
+	res, err := r.db.ExecContext(ctx, query, categoryId)
+	if err != nil {
+		return categoryErr("delete category failed", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("category not found")
+	}
+	return nil
+}
+
+func categoryErr(msg string, err error) error {
+	switch {
+	case strings.Contains(err.Error(), "Category_slug_key"):
+		return fmt.Errorf("slug already exists")
+	case strings.Contains(err.Error(), "Category_parent_id_fkey") && strings.Contains(err.Error(), "insert or update"):
+		return fmt.Errorf("parent category not found")
+	case strings.Contains(err.Error(), "Category_parent_id_fkey"):
+		return fmt.Errorf("category has subcategories")
+	case strings.Contains(err.Error(), "Product_category_id_fkey"):
+		return fmt.Errorf("category has products")
+	default:
+		return fmt.Errorf("%s: %v", msg, err)
+	}
+}
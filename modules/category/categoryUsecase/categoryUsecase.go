@@ -0,0 +1,59 @@
+package categoryUsecase
+
+import (
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category/categoryRepository"
+)
+
+type ICategoryUsecase interface {
+	GetCategoryTree() ([]*category.Category, error)
+	FindCategories() ([]*category.Category, error)
+	AddCategory(req *category.CategoryReq) (*category.Category, error)
+	UpdateCategory(req *category.CategoryReq) (*category.Category, error)
+	DeleteCategory(categoryId int) (string, error)
+}
+
+type categoryUsecase struct {
+	categoryRepository categoryRepository.ICategoryRepository
+}
+
+func CategoryUsecase(categoryRepository categoryRepository.ICategoryRepository) ICategoryUsecase {
+	return &categoryUsecase{
+		categoryRepository: categoryRepository,
+	}
+}
+
+// GetCategoryTree คืน tree ของหมวดที่เปิดอยู่สำหรับหน้าร้าน
+func (u *categoryUsecase) GetCategoryTree() ([]*category.Category, error) {
+	categories, err := u.categoryRepository.FindCategories(true)
+	if err != nil {
+		return nil, err
+	}
+	return category.BuildTree(categories), nil
+}
+
+// FindCategories คืนทุกหมวดรวมที่ปิดอยู่ แบบ flat สำหรับ admin
+func (u *categoryUsecase) FindCategories() ([]*category.Category, error) {
+	return u.categoryRepository.FindCategories(false)
+}
+
+func (u *categoryUsecase) AddCategory(req *category.CategoryReq) (*category.Category, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.categoryRepository.InsertCategory(req)
+}
+
+func (u *categoryUsecase) UpdateCategory(req *category.CategoryReq) (*category.Category, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.categoryRepository.UpdateCategory(req)
+}
+
+func (u *categoryUsecase) DeleteCategory(categoryId int) (string, error) {
+	if err := u.categoryRepository.DeleteCategory(categoryId); err != nil {
+		return "", err
+	}
+	return "Category deleted", nil
+}
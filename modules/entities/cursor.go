@@ -0,0 +1,181 @@
+package entities
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor ตำแหน่งในรายการแบบ keyset ส่งให้ client เป็น string ที่อ่านไม่ออก
+// Key คือ sort ที่ใช้ตอนสร้าง cursor ถ้าเปลี่ยน sort แล้วใช้ cursor เดิมจะไม่ผ่าน
+type Cursor struct {
+	Key    string   `json:"k"`
+	Values []string `json:"v"`           // ค่าของ sort key ของแถวที่ต่อจากนี้
+	Prev   bool     `json:"p,omitempty"` // ย้อนไปหน้าก่อนหน้า
+}
+
+func (c *Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := new(Cursor)
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// KeysetColumn sort key หนึ่งตัว Cast ใช้แปลงค่าจาก cursor กลับเป็น type ของ column
+type KeysetColumn struct {
+	Expr string
+	Cast string
+}
+
+// Keyset แบ่งหน้าด้วยค่าของ sort key แทน OFFSET
+// column สุดท้ายต้องไม่ซ้ำกัน (เช่น id) ลำดับถึงจะคงที่
+type Keyset struct {
+	Key     string
+	Columns []*KeysetColumn
+	Desc    bool
+	Cursor  *Cursor // nil = หน้าแรก
+}
+
+// NewKeyset ตรวจ cursor ที่ client ส่งมาว่าสร้างจาก sort เดียวกัน
+func NewKeyset(key string, desc bool, cursor string, columns ...*KeysetColumn) (*Keyset, error) {
+	k := &Keyset{
+		Key:     key,
+		Columns: columns,
+		Desc:    desc,
+	}
+	if cursor == "" {
+		return k, nil
+	}
+
+	c, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if c.Key != key || len(c.Values) != len(columns) {
+		return nil, ErrInvalidCursor
+	}
+	k.Cursor = c
+	return k, nil
+}
+
+// SortKeyset keyset จาก order_by ที่อยู่ใน keys โดยมี keys["id"] ต่อท้ายเป็นตัวตัดสินลำดับ
+// name แยก cursor ของแต่ละรายการออกจากกัน
+func SortKeyset(name string, keys map[string]*KeysetColumn, orderBy string, desc bool, cursor string) (*Keyset, error) {
+	key, ok := keys[orderBy]
+	if !ok {
+		return nil, fmt.Errorf("order_by %q is not supported", orderBy)
+	}
+
+	columns := []*KeysetColumn{key}
+	if orderBy != "id" {
+		columns = append(columns, keys["id"])
+	}
+	return NewKeyset(fmt.Sprintf("%s:%s:%t", name, orderBy, desc), desc, cursor, columns...)
+}
+
+// backward เรียงกลับด้านตอนย้อนหน้า แล้วค่อยกลับลำดับผลลัพธ์ทีหลัง
+func (k *Keyset) backward() bool {
+	return k.Cursor != nil && k.Cursor.Prev
+}
+
+// Select ค่าของ sort key เป็น text array ใช้สร้าง cursor ของแต่ละแถว
+func (k *Keyset) Select() string {
+	exprs := make([]string, 0, len(k.Columns))
+	for _, c := range k.Columns {
+		exprs = append(exprs, fmt.Sprintf("(%s)::TEXT", c.Expr))
+	}
+	return "ARRAY[" + strings.Join(exprs, ", ") + "]"
+}
+
+// Condition เงื่อนไขหาแถวถัดจาก cursor คืนค่าว่างถ้าเป็นหน้าแรก
+func (k *Keyset) Condition(b *sqlbuilder.Builder) string {
+	if k.Cursor == nil {
+		return ""
+	}
+
+	exprs := make([]string, 0, len(k.Columns))
+	params := make([]string, 0, len(k.Columns))
+	for i, c := range k.Columns {
+		exprs = append(exprs, c.Expr)
+		params = append(params, b.Arg(k.Cursor.Values[i])+"::"+c.Cast)
+	}
+
+	op := ">"
+	if k.Desc != k.backward() {
+		op = "<"
+	}
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(exprs, ", "), op, strings.Join(params, ", "))
+}
+
+// OrderBy ทุก column เรียงทิศเดียวกันเพื่อให้เทียบแบบ row comparison ได้
+func (k *Keyset) OrderBy() string {
+	dir := "ASC"
+	if k.Desc != k.backward() {
+		dir = "DESC"
+	}
+	orders := make([]string, 0, len(k.Columns))
+	for _, c := range k.Columns {
+		orders = append(orders, c.Expr+" "+dir)
+	}
+	return strings.Join(orders, ", ")
+}
+
+// Limit ดึงเกินมาหนึ่งแถวเพื่อรู้ว่ายังมีหน้าถัดไป มี cursor แล้วไม่ใช้ OFFSET
+func (k *Keyset) Limit(b *sqlbuilder.Builder, page, limit int) string {
+	if k.Cursor != nil {
+		return b.Limit(limit + 1)
+	}
+	return fmt.Sprintf("\n\tOFFSET %s LIMIT %s", b.Arg((page-1)*limit), b.Arg(limit+1))
+}
+
+// Cursors cursor ของหน้าถัดไปและหน้าก่อนหน้า ว่างถ้าไม่มี
+type Cursors struct {
+	Next string
+	Prev string
+}
+
+// KeysetPage ตัดแถวที่ query เกินมาหนึ่งแถว (limit+1) เพื่อรู้ว่ายังมีหน้าถัดไป
+// เรียงลำดับกลับถ้าย้อนหน้า และสร้าง cursor จากแถวแรกและแถวสุดท้าย
+// offset > 0 แปลว่าแบ่งหน้าแบบเดิมและไม่ใช่หน้าแรก จึงมีหน้าก่อนหน้า
+func KeysetPage[T any](k *Keyset, rows []T, limit, offset int, values func(T) []string) ([]T, *Cursors) {
+	cursors := new(Cursors)
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+
+	hasNext, hasPrev := more, k.Cursor != nil || offset > 0
+	if k.backward() {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+		hasNext, hasPrev = true, more
+	}
+
+	if len(rows) == 0 {
+		return rows, cursors
+	}
+	if hasNext {
+		cursors.Next = (&Cursor{Key: k.Key, Values: values(rows[len(rows)-1])}).Encode()
+	}
+	if hasPrev {
+		cursors.Prev = (&Cursor{Key: k.Key, Values: values(rows[0]), Prev: true}).Encode()
+	}
+	return rows, cursors
+}
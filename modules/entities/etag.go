@@ -0,0 +1,53 @@
+package entities
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrPreconditionFailed ข้อมูลถูกแก้ไปแล้วหลังจากที่ client อ่าน (If-Match ไม่ตรงกับ version ปัจจุบัน)
+var ErrPreconditionFailed = errors.New("resource has been modified, reload and try again")
+
+// ETag ของ version ของ row เช่น "3"
+func ETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// Precondition เงื่อนไขจาก header If-Match nil = ไม่มีเงื่อนไข แก้ได้เสมอ
+type Precondition struct {
+	versions []int
+}
+
+// IfMatch อ่าน If-Match ไม่ส่งมาหรือเป็น * ได้ nil
+// weak ETag (W/"3") หรือค่าที่อ่านไม่ได้ไม่ตรงกับ version ไหนเลย ตาม strong comparison
+func IfMatch(c *fiber.Ctx) *Precondition {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	p := &Precondition{versions: make([]int, 0)}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		raw, err := strconv.Unquote(tag)
+		if err != nil {
+			continue
+		}
+		if v, err := strconv.Atoi(raw); err == nil {
+			p.versions = append(p.versions, v)
+		}
+	}
+	return p
+}
+
+// Match version ปัจจุบันตรงกับ If-Match หรือไม่
+func (p *Precondition) Match(version int) bool {
+	return p == nil || slices.Contains(p.versions, version)
+}
@@ -1,7 +1,53 @@
 package entities
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
 type ImageRes struct {
-	Id       string `db:"id" json:"id"`
-	Url      string `db:"url" json:"url"`
-	Filename string `db:"filename" json:"filename"`
+	Id       string        `db:"id" json:"id"`
+	Url      string        `db:"url" json:"url"`
+	Filename string        `db:"filename" json:"filename"`
+	Width    int           `db:"width" json:"width"`
+	Height   int           `db:"height" json:"height"`
+	Variants ImageVariants `db:"variants" json:"variants"`
+}
+
+// ขนาดของรูปย่อที่สร้างตอน upload รูปสินค้า key คือชื่อ variant ค่าคือความยาวด้านที่ยาวที่สุด
+var ImageVariantSizes = map[string]int{
+	"thumb":  200,
+	"medium": 600,
+	"large":  1200,
+}
+
+type ImageVariant struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ImageVariants เก็บเป็น jsonb ในคอลัมน์ "variants" ของตาราง "Image"
+type ImageVariants map[string]*ImageVariant
+
+func (v ImageVariants) Value() (driver.Value, error) {
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+func (v *ImageVariants) Scan(src any) error {
+	switch s := src.(type) {
+	case nil:
+		*v = ImageVariants{}
+		return nil
+	case []byte:
+		return json.Unmarshal(s, v)
+	case string:
+		return json.Unmarshal([]byte(s), v)
+	default:
+		return fmt.Errorf("unsupported variants type: %T", src)
+	}
 }
@@ -1,10 +1,20 @@
 package entities
 
 type PaginationReq struct {
-	Page      int `json:"page" query:"page"`
-	Limit     int `json:"limit" query:"limit"`
-	TotalPage int `json:"total_page" query:"total_page"`
-	TotalItem int `json:"total_item" query:"total_item"`
+	Page      int    `json:"page" query:"page"`
+	Limit     int    `json:"limit" query:"limit"`
+	TotalPage int    `json:"total_page" query:"total_page"`
+	TotalItem int    `json:"total_item" query:"total_item"`
+	Cursor    string `json:"cursor" query:"cursor"`         // มี cursor แล้วจะไม่ใช้ page
+	WithTotal *bool  `json:"with_total" query:"with_total"` // ค่าเริ่มต้น นับเมื่อใช้ page ไม่นับเมื่อใช้ cursor
+}
+
+// CountTotal นับจำนวนทั้งหมดหรือไม่ การนับช้าเมื่อรายการเยอะจึงปิดได้
+func (p *PaginationReq) CountTotal() bool {
+	if p.WithTotal != nil {
+		return *p.WithTotal
+	}
+	return p.Cursor == ""
 }
 
 type SortReq struct {
@@ -13,9 +23,13 @@ type SortReq struct {
 }
 
 type PaginateRes struct {
-	Data      any `json:"data"`
-	Page      int `json:"page"`
-	Limit     int `json:"limit"`
-	TotalPage int `json:"total_page"`
-	TotalItem int `json:"total_item"`
+	Data       any    `json:"data"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	TotalPage  int    `json:"total_page"`
+	TotalItem  int    `json:"total_item"`
+	Facets     any    `json:"facets,omitempty"`
+	Suggestion string `json:"suggestion,omitempty"` // "did you mean" เมื่อค้นหาแล้วไม่เจอ
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
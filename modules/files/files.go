@@ -1,19 +1,135 @@
 package files
 
-import "mime/multipart"
+import (
+	"fmt"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/imaging"
+)
 
 type FileReq struct {
 	File        *multipart.FileHeader `form:"file"`
 	Destination string                `form:"destination"`
 	Extension   string
 	FileName    string
+	ContentType string
+	Data        []byte         // เนื้อไฟล์ที่ตรวจแล้ว ถ้ามีจะ upload ค่านี้แทนการเปิด File
+	Image       *imaging.Image // รูปที่ decode แล้ว ใช้สร้างรูปย่อ
 }
 
 type FileRes struct {
-	FileName string `json:"filename"`
-	Url      string `json:"url"`
+	FileName string                 `json:"filename"`
+	Url      string                 `json:"url"`
+	Width    int                    `json:"width,omitempty"`
+	Height   int                    `json:"height,omitempty"`
+	Variants entities.ImageVariants `json:"variants,omitempty"`
 }
 
-type DeleteFileReq struct {
+// สถานะของแต่ละไฟล์ใน batch ที่ upload
+const (
+	UploadStatusUploaded   = "uploaded"
+	UploadStatusFailed     = "failed"
+	UploadStatusCanceled   = "canceled"    // ไม่ได้ upload เพราะไฟล์อื่นใน batch error ก่อน
+	UploadStatusRolledBack = "rolled_back" // upload แล้วแต่ถูกลบทิ้งเพราะไฟล์อื่นใน batch error
+)
+
+type UploadResult struct {
+	FileName    string `json:"filename"`
 	Destination string `json:"destination"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// UploadError คือ error ของ batch ที่ upload ไม่สำเร็จ พร้อมผลของแต่ละไฟล์
+type UploadError struct {
+	Results []*UploadResult
+}
+
+func (e *UploadError) Error() string {
+	msgs := make([]string, 0)
+	for _, r := range e.Results {
+		if r.Error != "" {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", r.FileName, r.Error))
+		}
+	}
+	return fmt.Sprintf("upload file failed: %s", strings.Join(msgs, "; "))
+}
+
+type DeleteFileReq struct {
+	Destination string `json:"destination"` // key ของไฟล์ใน storage ต้องอยู่ใน "Asset"
+}
+
+// สถานะของ "Upload"
+const (
+	UploadPending   = "pending"
+	UploadConfirmed = "confirmed"
+	UploadAttached  = "attached"
+	UploadExpired   = "expired" // sweeper ลบไฟล์ไปแล้วเพราะไม่ถูกใช้ภายใน grace period
+)
+
+type UploadUrlReq struct {
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"` // ขนาดไฟล์จริง s3 รับเฉพาะไฟล์ที่มีขนาดเท่านี้พอดี
+	Namespace   Namespace `json:"namespace"`
+	Destination string    `json:"destination"` // folder ย่อยใน namespace (ไม่บังคับ)
+}
+
+type UploadUrlRes struct {
+	UploadId  string            `json:"upload_id"`
+	Key       string            `json:"key"`
+	Url       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+type ConfirmUploadReq struct {
+	UploadId string `json:"upload_id"`
+}
+
+type Upload struct {
+	Id          string    `db:"id" json:"id"`
+	UserId      string    `db:"user_id" json:"user_id"`
+	Key         string    `db:"key" json:"key"`
+	Url         string    `db:"-" json:"url"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	MaxSize     int64     `db:"max_size" json:"max_size"`
+	Size        int64     `db:"size" json:"size"`
+	Width       int       `db:"width" json:"width"`
+	Height      int       `db:"height" json:"height"`
+	Status      string    `db:"status" json:"status"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expires_at"`
+}
+
+// AttachOptions บอกว่าต้องทำอะไรกับไฟล์ก่อนผูกกับสินค้าหรือ avatar
+type AttachOptions struct {
+	Variants      bool // สร้างรูปย่อ (รูปสินค้า)
+	StripMetadata bool // ลบ EXIF (avatar)
+}
+
+// เจ้าของไฟล์ใน "Asset"
+const (
+	AssetOwnerProduct = "product"
+	AssetOwnerUser    = "user"
+	AssetOwnerManual  = "manual" // upload ผ่าน /files/upload ไม่รู้ว่าถูกใช้ที่ไหน จึงไม่ถูกลบอัตโนมัติ
+)
+
+type Asset struct {
+	Key        string     `db:"key" json:"key"`
+	Url        string     `db:"url" json:"url"`
+	OwnerType  *string    `db:"owner_type" json:"owner_type"`
+	OwnerId    *string    `db:"owner_id" json:"owner_id"`
+	OrphanedAt *time.Time `db:"orphaned_at" json:"orphaned_at"`
+}
+
+// SweepReport คือผลของการลบไฟล์ที่ไม่มีใครใช้ ถ้า DryRun จะมีแค่รายการที่จะถูกลบ
+type SweepReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Cutoff  time.Time         `json:"cutoff"`
+	Assets  []*Asset          `json:"assets"`
+	Deleted int               `json:"deleted"`
+	Failed  map[string]string `json:"failed"`
 }
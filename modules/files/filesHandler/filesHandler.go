@@ -1,16 +1,15 @@
 package filesHandler
 
 import (
-	"fmt"
-	"math"
-	"path/filepath"
-	"strings"
+	"bytes"
+	"errors"
+	"net/url"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
-	"github.com/deeptech-kmitl/Cicero-Backend/pkg/utils"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/storage"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -19,11 +18,17 @@ type FileHandlerErrCode string
 const (
 	uploadFilesErr FileHandlerErrCode = "files-001"
 	deleteFileErr  FileHandlerErrCode = "files-002"
+	uploadUrlErr   FileHandlerErrCode = "files-003"
+	confirmErr     FileHandlerErrCode = "files-004"
+	signedPutErr   FileHandlerErrCode = "files-005"
 )
 
 type IFileHandler interface {
 	UploadFiles(c *fiber.Ctx) error
 	DeleteFile(c *fiber.Ctx) error
+	CreateUploadUrl(c *fiber.Ctx) error
+	ConfirmUpload(c *fiber.Ctx) error
+	ReceiveSignedUpload(c *fiber.Ctx) error
 }
 
 type fileHandler struct {
@@ -51,44 +56,38 @@ func (h *fileHandler) UploadFiles(c *fiber.Ctx) error {
 	}
 
 	filesReq := form.File["files"]
-	destination := form.Value["destination"]
+	namespace, destination := "", ""
+	if values, exists := form.Value["namespace"]; exists && len(values) > 0 {
+		namespace = values[0]
+	}
+	if values, exists := form.Value["destination"]; exists && len(values) > 0 {
+		destination = values[0]
+	}
 
-	// files ext validation
-	extMap := map[string]string{
-		"png":  "png",
-		"jpg":  "jpg",
-		"jpeg": "jpeg",
+	// client เลือกได้แค่ namespace กับ folder ย่อย prefix จริงใน storage server เป็นคนกำหนด
+	dir, err := files.UploadDir(files.Namespace(namespace), destination)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadFilesErr),
+			err.Error(),
+		).Res()
 	}
 
 	for _, file := range filesReq {
-		// check file extension
-		ext := strings.TrimPrefix(filepath.Ext(file.Filename), ".")
-		if extMap[ext] != ext || extMap[ext] == "" {
+		// ตรวจชนิดไฟล์จากเนื้อหาจริง และขนาดของรูป
+		fileReq, err := files.NewImageReq(h.cfg.App(), file, dir, false)
+		if err != nil {
 			return entities.NewResponse(c).Error(
 				fiber.ErrBadRequest.Code,
 				string(uploadFilesErr),
-				"invalid file extension",
+				err.Error(),
 			).Res()
 		}
-		// check file size
-		if file.Size > int64(h.cfg.App().FileLimit()) {
-			return entities.NewResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(uploadFilesErr),
-				fmt.Sprintf("file size must less than %d MB", int(math.Ceil(float64(h.cfg.App().FileLimit())/math.Pow(1024, 2)))),
-			).Res()
-		}
-
-		filename := utils.RandFileName(ext)
-		req = append(req, &files.FileReq{
-			File:        file,
-			Destination: fmt.Sprintf("%s/%s", destination, filename),
-			FileName:    filename,
-			Extension:   ext,
-		})
+		req = append(req, fileReq)
 	}
 
-	res, err := h.fileUsecase.UploadToGCP(req)
+	res, err := h.fileUsecase.UploadFiles(req)
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
@@ -97,6 +96,16 @@ func (h *fileHandler) UploadFiles(c *fiber.Ctx) error {
 		).Res()
 	}
 
+	// ไม่รู้ว่าไฟล์จะถูกใช้ที่ไหน จึงผูกไว้กับคน upload ไม่ให้ sweeper ลบ จนกว่าจะลบผ่าน /files/delete
+	userId, _ := c.Locals("userId").(string)
+	if err := h.fileUsecase.ClaimFiles(files.AssetOwnerManual, userId, res); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(uploadFilesErr),
+			err.Error(),
+		).Res()
+	}
+
 	return entities.NewResponse(c).Success(fiber.StatusOK, res).Res()
 }
 
@@ -111,7 +120,14 @@ func (h *fileHandler) DeleteFile(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	if err := h.fileUsecase.DeleteFileOnGCP(req); err != nil {
+	if err := h.fileUsecase.DeleteFiles(req); err != nil {
+		if errors.Is(err, files.ErrAssetNotFound) {
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(deleteFileErr),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(deleteFileErr),
@@ -121,3 +137,90 @@ func (h *fileHandler) DeleteFile(c *fiber.Ctx) error {
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
 }
+
+func (h *fileHandler) CreateUploadUrl(c *fiber.Ctx) error {
+	req := new(files.UploadUrlReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadUrlErr),
+			err.Error(),
+		).Res()
+	}
+
+	// ลูกค้า upload ได้แค่ avatar ใน folder ของตัวเอง
+	userId, _ := c.Locals("userId").(string)
+	if roleId, _ := c.Locals("userRoleId").(int); roleId != 2 {
+		req.Namespace = files.NamespaceAvatars
+		req.Destination = userId
+	}
+
+	res, err := h.fileUsecase.CreateUploadUrl(userId, req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadUrlErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusCreated, res).Res()
+}
+
+func (h *fileHandler) ConfirmUpload(c *fiber.Ctx) error {
+	req := new(files.ConfirmUploadReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(confirmErr),
+			err.Error(),
+		).Res()
+	}
+
+	userId, _ := c.Locals("userId").(string)
+	res, err := h.fileUsecase.ConfirmUpload(userId, req.UploadId)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(confirmErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, res).Res()
+}
+
+// ReceiveSignedUpload รับ PUT ตาม signed url ของ local storage
+func (h *fileHandler) ReceiveSignedUpload(c *fiber.Ctx) error {
+	query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(signedPutErr),
+			err.Error(),
+		).Res()
+	}
+
+	body := c.Body()
+	err = h.fileUsecase.ReceiveSignedUpload(c.Params("*"), c.Get(fiber.HeaderContentType), query, bytes.NewReader(body), int64(len(body)))
+	switch {
+	case err == nil:
+		return c.SendStatus(fiber.StatusOK)
+	case errors.Is(err, storage.ErrInvalidSignature), errors.Is(err, storage.ErrSignatureExpired):
+		return entities.NewResponse(c).Error(
+			fiber.ErrForbidden.Code,
+			string(signedPutErr),
+			err.Error(),
+		).Res()
+	case errors.Is(err, storage.ErrTooLarge):
+		return entities.NewResponse(c).Error(
+			fiber.ErrRequestEntityTooLarge.Code,
+			string(signedPutErr),
+			err.Error(),
+		).Res()
+	default:
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(signedPutErr),
+			err.Error(),
+		).Res()
+	}
+}
@@ -0,0 +1,348 @@
+package filesRepository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
+	"github.com/jmoiron/sqlx"
+)
+
+type IFilesRepository interface {
+	InsertUpload(req *files.Upload) error
+	FindUpload(uploadId string) (*files.Upload, error)
+	ConfirmUpload(req *files.Upload) error
+	UpdateUploadKey(uploadId, key, contentType string) error
+	DeleteUpload(uploadId string) error
+	RegisterAssets(assets []*files.Asset) error
+	OrphanAssetAt(key string, at time.Time) error
+	ClaimAssets(ownerType, ownerId string, urls []string) error
+	FindOrphanedAssets(cutoff time.Time, after *files.Asset, limit int) ([]*files.Asset, error)
+	DeleteOrphanedAsset(key string, cutoff time.Time) (bool, error)
+	FindAssets(keys []string) ([]*files.Asset, error)
+	DeleteAssets(keys []string) error
+}
+
+type filesRepository struct {
+	db *sqlx.DB
+}
+
+func FilesRepository(db *sqlx.DB) IFilesRepository {
+	return &filesRepository{
+		db: db,
+	}
+}
+
+func (r *filesRepository) InsertUpload(req *files.Upload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+	INSERT INTO "Upload" (
+		"user_id",
+		"key",
+		"content_type",
+		"max_size",
+		"expires_at"
+	)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING "id", "status";`
+
+	if err := r.db.QueryRowxContext(
+		ctx,
+		query,
+		req.UserId,
+		req.Key,
+		req.ContentType,
+		req.MaxSize,
+		req.ExpiresAt,
+	).Scan(&req.Id, &req.Status); err != nil {
+		return fmt.Errorf("insert upload failed: %v", err)
+	}
+	return nil
+}
+
+func (r *filesRepository) FindUpload(uploadId string) (*files.Upload, error) {
+	query := `
+	SELECT
+		"id",
+		"user_id",
+		"key",
+		"content_type",
+		"max_size",
+		"size",
+		"width",
+		"height",
+		"status",
+		"expires_at"
+	FROM "Upload"
+	WHERE "id"::TEXT = $1;`
+
+	upload := new(files.Upload)
+	if err := r.db.Get(upload, query, uploadId); err != nil {
+		return nil, fmt.Errorf("upload not found: %v", err)
+	}
+	return upload, nil
+}
+
+// ConfirmUpload บันทึก key ใหม่ที่ server copy ไฟล์ไปไว้ ได้ error ถ้า upload ไม่ได้ pending แล้ว
+func (r *filesRepository) ConfirmUpload(req *files.Upload) error {
+	query := `
+	UPDATE "Upload" SET
+		"key" = $1,
+		"size" = $2,
+		"width" = $3,
+		"height" = $4,
+		"status" = 'confirmed'
+	WHERE "id" = $5
+	AND "status" = 'pending';`
+
+	res, err := r.db.ExecContext(context.Background(), query, req.Key, req.Size, req.Width, req.Height, req.Id)
+	if err != nil {
+		return fmt.Errorf("confirm upload failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("upload is not pending")
+	}
+	req.Status = files.UploadConfirmed
+	return nil
+}
+
+// ใช้ตอนไฟล์ถูก encode ใหม่แล้วเปลี่ยนนามสกุล เช่น avatar webp -> png
+func (r *filesRepository) UpdateUploadKey(uploadId, key, contentType string) error {
+	query := `
+	UPDATE "Upload" SET
+		"key" = $1,
+		"content_type" = $2
+	WHERE "id" = $3;`
+
+	if _, err := r.db.ExecContext(context.Background(), query, key, contentType, uploadId); err != nil {
+		return fmt.Errorf("update upload failed: %v", err)
+	}
+	return nil
+}
+
+func (r *filesRepository) DeleteUpload(uploadId string) error {
+	query := `DELETE FROM "Upload" WHERE "id" = $1;`
+
+	if _, err := r.db.ExecContext(context.Background(), query, uploadId); err != nil {
+		return fmt.Errorf("delete upload failed: %v", err)
+	}
+	return nil
+}
+
+// RegisterAssets บันทึกไฟล์ก่อน upload เข้า storage ให้อยู่ในสถานะ orphaned
+// ถ้าไม่มีใคร claim ภายใน grace period sweeper จะลบทิ้ง
+func (r *filesRepository) RegisterAssets(assets []*files.Asset) error {
+	if len(assets) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys := make([]string, 0, len(assets))
+	urls := make([]string, 0, len(assets))
+	for _, a := range assets {
+		keys = append(keys, a.Key)
+		urls = append(urls, a.Url)
+	}
+
+	query := `
+	INSERT INTO "Asset" ("key", "url")
+	SELECT * FROM unnest($1::VARCHAR[], $2::VARCHAR[])
+	ON CONFLICT ("key") DO UPDATE SET "url" = EXCLUDED."url";`
+
+	if _, err := r.db.ExecContext(ctx, query, keys, urls); err != nil {
+		return fmt.Errorf("register assets failed: %v", err)
+	}
+	return nil
+}
+
+// OrphanAssetAt ตั้งเวลาที่ไฟล์เริ่ม orphaned ใหม่ sweeper จะลบหลัง at + grace period
+func (r *filesRepository) OrphanAssetAt(key string, at time.Time) error {
+	query := `
+	UPDATE "Asset" SET
+		"owner_type" = NULL,
+		"owner_id" = NULL,
+		"orphaned_at" = $2
+	WHERE "key" = $1;`
+
+	if _, err := r.db.ExecContext(context.Background(), query, key, at); err != nil {
+		return fmt.Errorf("orphan asset failed: %v", err)
+	}
+	return nil
+}
+
+func (r *filesRepository) ClaimAssets(ownerType, ownerId string, urls []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return ClaimAssets(ctx, r.db, ownerType, ownerId, urls)
+}
+
+// FindOrphanedAssets ไฟล์ที่ orphaned ก่อน cutoff ถัดจาก after (nil = เริ่มต้น) เรียงตาม orphaned_at แล้ว key
+// ไล่ด้วย after ทำให้ไฟล์ที่ลบไม่สำเร็จไม่วนกลับมาใน batch ถัดไปของรอบเดียวกัน
+func (r *filesRepository) FindOrphanedAssets(cutoff time.Time, after *files.Asset, limit int) ([]*files.Asset, error) {
+	query := `
+	SELECT
+		"key",
+		"url",
+		"owner_type",
+		"owner_id",
+		"orphaned_at"
+	FROM "Asset"
+	WHERE "orphaned_at" < $1
+	AND ("orphaned_at", "key") > ($2, $3)
+	ORDER BY "orphaned_at", "key"
+	LIMIT $4;`
+
+	afterAt, afterKey := time.Time{}, ""
+	if after != nil && after.OrphanedAt != nil {
+		afterAt, afterKey = *after.OrphanedAt, after.Key
+	}
+
+	assets := make([]*files.Asset, 0)
+	if err := r.db.Select(&assets, query, cutoff, afterAt, afterKey, limit); err != nil {
+		return nil, fmt.Errorf("find orphaned assets failed: %v", err)
+	}
+	return assets, nil
+}
+
+// DeleteOrphanedAsset ลบออกจากทะเบียนเฉพาะเมื่อยัง orphaned อยู่ คืน false ถ้าถูก claim ไปแล้ว
+// "Upload" ที่ยังไม่ถูกใช้ของไฟล์นี้จะกลายเป็น expired ใน statement เดียวกัน
+func (r *filesRepository) DeleteOrphanedAsset(key string, cutoff time.Time) (bool, error) {
+	query := `
+	WITH "deleted" AS (
+		DELETE FROM "Asset"
+		WHERE "key" = $1
+		AND "orphaned_at" < $2
+		RETURNING "key"
+	), "expired" AS (
+		UPDATE "Upload" SET
+			"status" = 'expired'
+		WHERE "key" IN (SELECT "key" FROM "deleted")
+		AND "status" IN ('pending', 'confirmed')
+	)
+	SELECT COUNT(*) FROM "deleted";`
+
+	var n int
+	if err := r.db.QueryRowxContext(context.Background(), query, key, cutoff).Scan(&n); err != nil {
+		return false, fmt.Errorf("delete asset failed: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (r *filesRepository) FindAssets(keys []string) ([]*files.Asset, error) {
+	query := `
+	SELECT
+		"key",
+		"url",
+		"owner_type",
+		"owner_id",
+		"orphaned_at"
+	FROM "Asset"
+	WHERE "key" = ANY($1);`
+
+	assets := make([]*files.Asset, 0)
+	if err := r.db.Select(&assets, query, keys); err != nil {
+		return nil, fmt.Errorf("find assets failed: %v", err)
+	}
+	return assets, nil
+}
+
+func (r *filesRepository) DeleteAssets(keys []string) error {
+	query := `DELETE FROM "Asset" WHERE "key" = ANY($1);`
+
+	if _, err := r.db.ExecContext(context.Background(), query, keys); err != nil {
+		return fmt.Errorf("delete assets failed: %v", err)
+	}
+	return nil
+}
+
+// ฟังก์ชันด้านล่างรับ sqlx.ExtContext เพื่อให้ module อื่นเรียกใน transaction ของตัวเองได้
+// การผูกหรือปล่อยไฟล์จะ commit หรือ rollback พร้อมกับข้อมูลที่อ้างถึงไฟล์
+
+// ClaimAssets ผูกไฟล์กับเจ้าของ ไฟล์ที่ claim แล้วจะไม่ถูก sweeper ลบ
+func ClaimAssets(ctx context.Context, db sqlx.ExtContext, ownerType, ownerId string, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	query := `
+	UPDATE "Asset" SET
+		"owner_type" = $1,
+		"owner_id" = $2,
+		"orphaned_at" = NULL
+	WHERE "url" = ANY($3);`
+
+	if _, err := db.ExecContext(ctx, query, ownerType, ownerId, urls); err != nil {
+		return fmt.Errorf("claim assets failed: %v", err)
+	}
+	return nil
+}
+
+// AttachUploads mark upload ว่าถูกใช้แล้ว เรียกใน transaction ที่บันทึกข้อมูลที่อ้างถึงไฟล์
+// ถ้า transaction ไม่สำเร็จ upload ยังเป็น confirmed ให้ client ส่งมาใหม่ได้
+// upload ที่ไม่ได้เป็น confirmed แล้ว (เช่นถูกใช้ไปพร้อมกันโดยอีก request) ได้ error
+func AttachUploads(ctx context.Context, db sqlx.ExtContext, uploadIds []string) error {
+	if len(uploadIds) == 0 {
+		return nil
+	}
+	query := `
+	UPDATE "Upload" SET
+		"status" = 'attached'
+	WHERE "id"::TEXT = ANY($1)
+	AND "status" = 'confirmed';`
+
+	unique := make(map[string]struct{}, len(uploadIds))
+	for _, id := range uploadIds {
+		unique[id] = struct{}{}
+	}
+
+	res, err := db.ExecContext(ctx, query, uploadIds)
+	if err != nil {
+		return fmt.Errorf("attach uploads failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != int64(len(unique)) {
+		return fmt.Errorf("uploads must be confirmed and not used yet")
+	}
+	return nil
+}
+
+// ClaimProductImages ผูกรูปสินค้าและรูปย่อทั้งหมดใน "Image" ของสินค้ากับสินค้านั้น
+func ClaimProductImages(ctx context.Context, db sqlx.ExtContext, productId string) error {
+	query := `
+	UPDATE "Asset" SET
+		"owner_type" = 'product',
+		"owner_id" = $1,
+		"orphaned_at" = NULL
+	WHERE "url" IN (
+		SELECT "i"."url" FROM "Image" "i" WHERE "i"."product_id" = $1
+		UNION
+		SELECT "v"."value"->>'url' FROM "Image" "i", jsonb_each("i"."variants") "v" WHERE "i"."product_id" = $1
+	);`
+
+	if _, err := db.ExecContext(ctx, query, productId); err != nil {
+		return fmt.Errorf("claim product images failed: %v", err)
+	}
+	return nil
+}
+
+// ReleaseAssets ปล่อยไฟล์ทั้งหมดของเจ้าของ ยกเว้น url ใน keep ให้ sweeper ลบหลัง grace period
+func ReleaseAssets(ctx context.Context, db sqlx.ExtContext, ownerType, ownerId string, keep ...string) error {
+	query := `
+	UPDATE "Asset" SET
+		"orphaned_at" = now()
+	WHERE "owner_type" = $1
+	AND "owner_id" = $2
+	AND "orphaned_at" IS NULL
+	AND NOT ("url" = ANY($3));`
+
+	if keep == nil {
+		keep = make([]string, 0)
+	}
+	if _, err := db.ExecContext(ctx, query, ownerType, ownerId, keep); err != nil {
+		return fmt.Errorf("release assets failed: %v", err)
+	}
+	return nil
+}
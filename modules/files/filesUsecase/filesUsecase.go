@@ -3,188 +3,695 @@ package filesUsecase
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/imaging"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/storage"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/utils"
 )
 
 type IFilesUsecase interface {
-	UploadToGCP(req []*files.FileReq) ([]*files.FileRes, error)
-	DeleteFileOnGCP(req []*files.DeleteFileReq) error
+	UploadFiles(req []*files.FileReq) ([]*files.FileRes, error)
+	UploadImages(req []*files.FileReq) ([]*files.FileRes, error)
+	CreateVariants(key string, img *imaging.Image) (entities.ImageVariants, error)
+	DeleteFiles(req []*files.DeleteFileReq) error
+	CreateUploadUrl(userId string, req *files.UploadUrlReq) (*files.UploadUrlRes, error)
+	ConfirmUpload(userId, uploadId string) (*files.Upload, error)
+	PrepareUploads(userId string, uploadIds []string, opts *files.AttachOptions) ([]*files.FileRes, error)
+	ReceiveSignedUpload(key, contentType string, query url.Values, body io.Reader, size int64) error
+	ClaimFiles(ownerType, ownerId string, res []*files.FileRes) error
+	SweepAssets(ctx context.Context, grace time.Duration, dryRun bool) (*files.SweepReport, error)
 }
 
 type filesUsecase struct {
-	cfg config.IConfig
+	cfg             config.IConfig
+	filesRepository filesRepository.IFilesRepository
+	storage         storage.IObjectStorage
 }
 
-func FilesUsecase(cfg config.IConfig) IFilesUsecase {
+func FilesUsecase(cfg config.IConfig, filesRepository filesRepository.IFilesRepository, storage storage.IObjectStorage) IFilesUsecase {
 	return &filesUsecase{
-		cfg: cfg,
+		cfg:             cfg,
+		filesRepository: filesRepository,
+		storage:         storage,
 	}
 }
 
-type filesPub struct {
-	bucket      string
-	destination string
-	file        *files.FileRes
+var (
+	errSkipped       = errors.New("skipped because another file in the batch failed")
+	errUploadExpired = errors.New("upload expired, please upload the file again")
+)
+
+// runJobs เรียก fn กับ job 0..n-1 พร้อมกันไม่เกิน workers ตัว
+// job แรกที่ error จะ cancel ctx ของ job ที่เหลือ job ที่ยังไม่เริ่มจะได้ errSkipped
+// คืน error ของแต่ละ job ตามลำดับ และ index ของ job ที่ error ก่อน (-1 ถ้าไม่มี)
+func runJobs(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) ([]error, int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int, n)
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	errs := make([]error, n)
+	first := -1
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					errs[i] = errSkipped
+					continue
+				}
+				if err := fn(ctx, i); err != nil {
+					errs[i] = err
+					mu.Lock()
+					if first == -1 {
+						first = i
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errs, first
 }
 
-func (f *filesPub) makePublic(ctx context.Context, client *storage.Client) error {
-	acl := client.Bucket(f.bucket).Object(f.destination).ACL()
-	if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		return fmt.Errorf("ACLHandle.Set: %w", err)
+func (u *filesUsecase) putFile(ctx context.Context, req *files.FileReq) error {
+	var body io.ReadCloser
+	if req.Data != nil {
+		body = io.NopCloser(bytes.NewReader(req.Data))
+	} else {
+		container, err := req.File.Open()
+		if err != nil {
+			return fmt.Errorf("open file failed: %v", err)
+		}
+		body = container
+	}
+	defer body.Close()
+
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension("." + req.Extension)
 	}
-	fmt.Printf("Blob %v is now publicly accessible.\n", f.destination)
+
+	if err := u.storage.Put(ctx, req.Destination, body, contentType); err != nil {
+		return fmt.Errorf("put file failed: %w", err)
+	}
+	fmt.Printf("%v uploaded to %v.\n", req.FileName, req.Destination)
 	return nil
 }
 
-func (u *filesUsecase) uploadWorkers(ctx context.Context, client *storage.Client, jobs <-chan *files.FileReq, result chan<- *files.FileRes, errs chan<- error) {
-	//jobs <-chan คือการรับค่าจาก channel แบบ receive only
-	//result chan<- คือการส่งค่าไปที่ channel แบบ send only
-	//errs chan<- คือการส่งค่าไปที่ channel แบบ send only
+// UploadFiles upload ทั้ง batch แบบทั้งหมดหรือไม่เลย ถ้ามีไฟล์ไหน error จะหยุดไฟล์ที่เหลือ
+// แล้วลบไฟล์ที่ upload ไปแล้วทิ้ง error ที่คืนเป็น *files.UploadError ซึ่งมีผลของแต่ละไฟล์
+// res เรียงตามลำดับของ req
+func (u *filesUsecase) UploadFiles(req []*files.FileReq) ([]*files.FileRes, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
 
-	for job := range jobs {
-		container, err := job.File.Open()
-		if err != nil {
-			errs <- fmt.Errorf("open file failed: %v", err)
-			return
+	// ลงทะเบียนก่อน upload ถ้า upload สำเร็จแต่ไม่มีใครใช้ไฟล์ sweeper จะตามลบให้
+	assets := make([]*files.Asset, 0, len(req))
+	for _, r := range req {
+		assets = append(assets, &files.Asset{
+			Key: r.Destination,
+			Url: u.storage.PublicUrl(r.Destination),
+		})
+	}
+	if err := u.filesRepository.RegisterAssets(assets); err != nil {
+		return nil, err
+	}
+
+	errs, first := runJobs(ctx, len(req), u.cfg.Storage().UploadWorkers(), func(ctx context.Context, i int) error {
+		return u.putFile(ctx, req[i])
+	})
+
+	if first == -1 {
+		res := make([]*files.FileRes, 0, len(req))
+		for _, r := range req {
+			res = append(res, &files.FileRes{
+				FileName: r.FileName,
+				Url:      u.storage.PublicUrl(r.Destination),
+			})
+		}
+		return res, nil
+	}
+
+	results := make([]*files.UploadResult, 0, len(req))
+	for i, r := range req {
+		result := &files.UploadResult{
+			FileName:    r.FileName,
+			Destination: r.Destination,
+			Status:      files.UploadStatusUploaded,
+		}
+		switch {
+		case errs[i] == nil:
+		case i != first && (errors.Is(errs[i], errSkipped) || errors.Is(errs[i], context.Canceled)):
+			result.Status = files.UploadStatusCanceled
+		default:
+			result.Status = files.UploadStatusFailed
+			result.Error = errs[i].Error()
+		}
+		results = append(results, result)
+	}
+	u.rollbackUploads(results)
+	return nil, &files.UploadError{Results: results}
+}
+
+// rollbackUploads ลบไฟล์ที่ upload สำเร็จไปแล้วใน batch ที่ล้มเหลว
+// เอาออกจาก "Asset" เฉพาะไฟล์ที่ลบสำเร็จ ไฟล์อื่นให้ sweeper ตามลบภายหลัง
+func (u *filesUsecase) rollbackUploads(results []*files.UploadResult) {
+	// ctx ของ batch ถูก cancel ไปแล้ว จึงต้องใช้ ctx ใหม่
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	uploaded := make([]*files.UploadResult, 0)
+	for _, r := range results {
+		if r.Status == files.UploadStatusUploaded {
+			uploaded = append(uploaded, r)
+		}
+	}
+	// ลบไม่สำเร็จไฟล์หนึ่งไม่ควรหยุดการลบไฟล์อื่น จึงเก็บ error ไว้เองแทนการคืนให้ runJobs
+	errs := make([]error, len(uploaded))
+	runJobs(ctx, len(uploaded), u.cfg.Storage().UploadWorkers(), func(ctx context.Context, i int) error {
+		errs[i] = u.storage.Delete(ctx, uploaded[i].Destination)
+		return nil
+	})
+
+	// ไฟล์ที่ failed หรือ canceled อาจถูกเขียนไปบางส่วนหรือยังเขียนอยู่ จึงเก็บไว้ใน "Asset" ให้ sweeper ลบ
+	keys := make([]string, 0, len(uploaded))
+	for i, r := range uploaded {
+		if errs[i] != nil {
+			r.Error = fmt.Sprintf("rollback failed: %v", errs[i])
+			continue
+		}
+		r.Status = files.UploadStatusRolledBack
+		keys = append(keys, r.Destination)
+	}
+	if err := u.filesRepository.DeleteAssets(keys); err != nil {
+		log.Printf("unregister rolled back files failed: %v", err)
+	}
+}
+
+// UploadImages upload รูปต้นฉบับพร้อมรูปย่อตาม entities.ImageVariantSizes
+// req ต้องสร้างจาก files.NewImageReq เพื่อให้มีรูปที่ decode แล้ว
+func (u *filesUsecase) UploadImages(req []*files.FileReq) ([]*files.FileRes, error) {
+	uploads := make([]*files.FileReq, 0)
+	res := make([]*files.FileRes, 0)
+
+	for _, r := range req {
+		if r.Image == nil {
+			return nil, fmt.Errorf("%s is not a decoded image", r.FileName)
 		}
-		b, err := io.ReadAll(container)
+		variantReqs, variants, err := u.variantReqs(r.Destination, r.Image)
 		if err != nil {
-			errs <- fmt.Errorf("read file failed: %v", err)
-			return
+			return nil, err
 		}
-		buf := bytes.NewBuffer(b)
+		uploads = append(uploads, r)
+		uploads = append(uploads, variantReqs...)
+
+		res = append(res, &files.FileRes{
+			FileName: r.FileName,
+			Url:      u.storage.PublicUrl(r.Destination),
+			Width:    r.Image.Width,
+			Height:   r.Image.Height,
+			Variants: variants,
+		})
+	}
 
-		// Upload an object with storage.Writer.
-		wc := client.Bucket(u.cfg.App().GCPBucket()).Object(job.Destination).NewWriter(ctx)
+	if _, err := u.UploadFiles(uploads); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CreateVariants สร้างรูปย่อของรูปที่อยู่ใน storage อยู่แล้วที่ key ใช้ตอน backfill รูปเก่า
+func (u *filesUsecase) CreateVariants(key string, img *imaging.Image) (entities.ImageVariants, error) {
+	variantReqs, variants, err := u.variantReqs(key, img)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.UploadFiles(variantReqs); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
 
-		if _, err = io.Copy(wc, buf); err != nil {
-			errs <- fmt.Errorf("io.Copy: %w", err)
-			return
+// รูปย่อเก็บไว้ข้างรูปต้นฉบับ เช่น P000001/abc_123.png -> P000001/abc_123_thumb.jpg
+func (u *filesUsecase) variantReqs(key string, img *imaging.Image) ([]*files.FileReq, entities.ImageVariants, error) {
+	base := strings.TrimSuffix(key, path.Ext(key))
+	reqs := make([]*files.FileReq, 0, len(entities.ImageVariantSizes))
+	variants := make(entities.ImageVariants)
+
+	for name, size := range entities.ImageVariantSizes {
+		v, err := imaging.Resize(img, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("resize %s to %s failed: %v", key, name, err)
 		}
-		// Data can continue to be added to the file until the writer is closed.
-		if err := wc.Close(); err != nil {
-			errs <- fmt.Errorf("Writer.Close: %w", err)
-			return
+
+		destination := fmt.Sprintf("%s_%s.%s", base, name, v.Ext())
+		reqs = append(reqs, &files.FileReq{
+			Destination: destination,
+			FileName:    path.Base(destination),
+			Extension:   v.Ext(),
+			ContentType: v.ContentType(),
+			Data:        v.Data,
+		})
+		variants[name] = &entities.ImageVariant{
+			Url:    u.storage.PublicUrl(destination),
+			Width:  v.Width,
+			Height: v.Height,
 		}
-		fmt.Printf("%v uploaded to %v.\n", job.FileName, job.Destination)
+	}
+	return reqs, variants, nil
+}
 
-		newFile := &filesPub{
-			file: &files.FileRes{
-				FileName: job.FileName,
-				Url:      fmt.Sprintf("https://storage.googleapis.com/%s/%s", u.cfg.App().GCPBucket(), job.Destination),
-			},
-			bucket:      u.cfg.App().GCPBucket(),
-			destination: job.Destination,
+func (u *filesUsecase) DeleteFiles(req []*files.DeleteFileReq) error {
+	// ลบได้เฉพาะไฟล์ที่ระบบเราเป็นคน upload (มีใน "Asset") ไม่ใช่ทุก key ใน bucket
+	keys := make([]string, 0, len(req))
+	for _, r := range req {
+		keys = append(keys, r.Destination)
+	}
+	assets, err := u.filesRepository.FindAssets(keys)
+	if err != nil {
+		return err
+	}
+	registered := make(map[string]bool, len(assets))
+	for _, a := range assets {
+		registered[a.Key] = true
+	}
+	for _, key := range keys {
+		if !registered[key] {
+			return fmt.Errorf("%w: %s", files.ErrAssetNotFound, key)
 		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
 
-		if err := newFile.makePublic(ctx, client); err != nil {
-			errs <- fmt.Errorf("make file public failed: %v", err)
-			return
+	// ลบไม่ได้ย้อนกลับไม่ได้ จึงหยุดไฟล์ที่ยังไม่เริ่มเมื่อเจอ error แรก
+	// ไฟล์ที่ลบไปแล้วยังต้องเอาออกจาก "Asset" แม้ batch จะล้มเหลว
+	errs, first := runJobs(ctx, len(req), u.cfg.Storage().UploadWorkers(), func(ctx context.Context, i int) error {
+		if err := u.storage.Delete(ctx, req[i].Destination); err != nil {
+			return err
+		}
+		fmt.Printf("Blob %v deleted.\n", req[i].Destination)
+		return nil
+	})
+	if first != -1 {
+		deleted := make([]string, 0, len(req))
+		for i, r := range req {
+			if errs[i] == nil {
+				deleted = append(deleted, r.Destination)
+			}
 		}
+		if err := u.filesRepository.DeleteAssets(deleted); err != nil {
+			return fmt.Errorf("delete file %s failed: %v (%v)", req[first].Destination, errs[first], err)
+		}
+		return fmt.Errorf("delete file %s failed: %v", req[first].Destination, errs[first])
+	}
+
+	return u.filesRepository.DeleteAssets(keys)
+}
+
+// upload ตรงเข้า storage มี 3 ขั้น:
+// 1. CreateUploadUrl ออก signed PUT url ที่จำกัด content type และขนาดไฟล์
+// 2. client PUT ไฟล์เข้า storage เอง แล้วเรียก ConfirmUpload ให้ server ตรวจไฟล์และ copy ไป key ใหม่
+// 3. PrepareUploads ตอนสร้าง/แก้สินค้าหรือ avatar ใช้ได้เฉพาะไฟล์ที่ confirm แล้ว
+//    แล้ว filesRepository.AttachUploads ใน transaction เดียวกับที่บันทึกสินค้าหรือ profile
+
+func (u *filesUsecase) CreateUploadUrl(userId string, req *files.UploadUrlReq) (*files.UploadUrlRes, error) {
+	format, ok := imaging.FormatOf(req.ContentType)
+	if !ok {
+		return nil, imaging.ErrUnsupported
+	}
+	if req.Size <= 0 {
+		return nil, fmt.Errorf("size is required")
+	}
+	if req.Size > int64(u.cfg.App().FileLimit()) {
+		return nil, fmt.Errorf("file size must less than %d bytes", u.cfg.App().FileLimit())
+	}
 
-		errs <- nil
-		result <- newFile.file
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	dir, err := files.UploadDir(req.Namespace, req.Destination)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/%s", dir, utils.RandFileName(imaging.Ext(format)))
+	signed, err := u.storage.SignedUrl(ctx, key, &storage.SignOptions{
+		Method:      "PUT",
+		Expires:     u.cfg.Storage().UploadUrlExpires(),
+		ContentType: req.ContentType,
+		MaxSize:     req.Size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sign upload url failed: %v", err)
 	}
 
+	upload := &files.Upload{
+		UserId:      userId,
+		Key:         key,
+		ContentType: req.ContentType,
+		MaxSize:     req.Size,
+		ExpiresAt:   signed.ExpiresAt,
+	}
+	if err := u.filesRepository.RegisterAssets([]*files.Asset{{
+		Key: key,
+		Url: u.storage.PublicUrl(key),
+	}}); err != nil {
+		return nil, err
+	}
+	if err := u.filesRepository.InsertUpload(upload); err != nil {
+		return nil, err
+	}
+
+	return &files.UploadUrlRes{
+		UploadId:  upload.Id,
+		Key:       key,
+		Url:       signed.Url,
+		Method:    signed.Method,
+		Headers:   signed.Headers,
+		ExpiresAt: signed.ExpiresAt,
+	}, nil
 }
 
-func (u *filesUsecase) UploadToGCP(req []*files.FileReq) ([]*files.FileRes, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+// ConfirmUpload ตรวจว่าไฟล์อยู่ใน storage จริง ขนาดไม่เกินที่ขอไว้ และ decode เป็นรูปตาม content type ได้
+// ไฟล์ที่ผ่านจะถูก copy ไป key ใหม่ที่ client ไม่รู้ เพราะ signed url ยัง PUT ทับ key เดิมได้จนหมดอายุ
+// ไฟล์ที่ไม่ผ่านจะถูกลบทิ้งทั้งใน storage และ "Upload"
+func (u *filesUsecase) ConfirmUpload(userId, uploadId string) (*files.Upload, error) {
+	upload, err := u.ownedUpload(userId, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	upload.Url = u.storage.PublicUrl(upload.Key)
+	if upload.Status == files.UploadExpired {
+		return nil, errUploadExpired
+	}
+	if upload.Status != files.UploadPending {
+		return upload, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
 
-	client, err := storage.NewClient(ctx)
+	info, err := u.storage.Stat(ctx, upload.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("file has not been uploaded")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := u.inspectUpload(ctx, upload, info)
 	if err != nil {
-		return nil, fmt.Errorf("storage.NewClient: %w", err)
+		// ไฟล์นี้ใช้ไม่ได้แล้ว ลบทิ้งเพื่อไม่ให้ค้างใน storage
+		if delErr := u.storage.Delete(ctx, upload.Key); delErr != nil {
+			return nil, fmt.Errorf("%v (delete rejected file failed: %v)", err, delErr)
+		}
+		if delErr := u.filesRepository.DeleteUpload(upload.Id); delErr != nil {
+			return nil, fmt.Errorf("%v (%v)", err, delErr)
+		}
+		return nil, err
 	}
-	defer client.Close()
 
-	jobsCh := make(chan *files.FileReq, len(req))
-	resultsCh := make(chan *files.FileRes, len(req))
-	errorsCh := make(chan error, len(req))
+	key := fmt.Sprintf("%s/%s", path.Dir(upload.Key), utils.RandFileName(img.Ext()))
+	if _, err := u.UploadFiles([]*files.FileReq{{
+		Destination: key,
+		FileName:    path.Base(key),
+		Extension:   img.Ext(),
+		ContentType: img.ContentType(),
+		Data:        img.Data,
+	}}); err != nil {
+		return nil, err
+	}
 
-	res := make([]*files.FileRes, 0)
+	// key เดิมยังถูก PUT ซ้ำได้จนกว่า url หมดอายุ จึงให้ sweeper ลบอีกครั้งหลังจากนั้น
+	if err := u.filesRepository.OrphanAssetAt(upload.Key, upload.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if err := u.storage.Delete(ctx, upload.Key); err != nil {
+		log.Printf("delete confirmed upload %s failed: %v", upload.Key, err)
+	}
 
-	for _, r := range req {
-		jobsCh <- r
+	upload.Key = key
+	upload.Url = u.storage.PublicUrl(key)
+	upload.Size = int64(len(img.Data))
+	upload.Width = img.Width
+	upload.Height = img.Height
+	if err := u.filesRepository.ConfirmUpload(upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// inspectUpload โหลดไฟล์ทั้งไฟล์มา decode ขนาดไฟล์ถูกจำกัดด้วย MaxSize ของ upload
+func (u *filesUsecase) inspectUpload(ctx context.Context, upload *files.Upload, info *storage.ObjectInfo) (*imaging.Image, error) {
+	if info.Size > upload.MaxSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", upload.MaxSize)
+	}
+	if info.ContentType != "" && info.ContentType != upload.ContentType {
+		return nil, fmt.Errorf("content type must be %s", upload.ContentType)
+	}
+
+	rc, err := u.storage.Get(ctx, upload.Key)
+	if err != nil {
+		return nil, err
 	}
-	close(jobsCh)
+	defer rc.Close()
 
-	numWorkers := 5
-	for i := 0; i < numWorkers; i++ {
-		go u.uploadWorkers(ctx, client, jobsCh, resultsCh, errorsCh)
+	// ไฟล์อาจถูก PUT ทับหลัง Stat จึงอ่านไม่เกิน MaxSize+1 แล้วเช็คขนาดอีกครั้ง
+	data, err := io.ReadAll(io.LimitReader(rc, upload.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read upload failed: %v", err)
+	}
+	if int64(len(data)) > upload.MaxSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", upload.MaxSize)
+	}
+
+	img, err := imaging.Decode(data, u.imageLimits())
+	if err != nil {
+		return nil, err
 	}
+	if img.ContentType() != upload.ContentType {
+		return nil, fmt.Errorf("file content is %s, not %s", img.ContentType(), upload.ContentType)
+	}
+	return img, nil
+}
+
+// PrepareUploads คืนไฟล์ที่ confirm แล้วในรูป FileRes สำหรับผูกกับสินค้าหรือ avatar
+// ยังไม่ mark ว่า attached ผู้เรียกต้องเรียก filesRepository.AttachUploads ใน transaction ของตัวเอง
+func (u *filesUsecase) PrepareUploads(userId string, uploadIds []string, opts *files.AttachOptions) ([]*files.FileRes, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
 
-	for a := 0; a < len(req); a++ {
-		err := <-errorsCh
+	res := make([]*files.FileRes, 0, len(uploadIds))
+	for _, id := range uploadIds {
+		upload, err := u.ownedUpload(userId, id)
 		if err != nil {
-			return nil, fmt.Errorf("upload file failed: %v", err)
+			return nil, err
+		}
+		if upload.Status == files.UploadExpired {
+			return nil, fmt.Errorf("upload %s: %w", upload.Id, errUploadExpired)
+		}
+		if upload.Status != files.UploadConfirmed {
+			return nil, fmt.Errorf("upload %s is %s, must be confirmed", upload.Id, upload.Status)
 		}
-		result := <-resultsCh
-		res = append(res, result)
-	}
 
+		fileRes := &files.FileRes{
+			FileName: path.Base(upload.Key),
+			Url:      u.storage.PublicUrl(upload.Key),
+			Width:    upload.Width,
+			Height:   upload.Height,
+		}
+		if opts.Variants || opts.StripMetadata {
+			if fileRes, err = u.processUpload(ctx, upload, opts); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, fileRes)
+	}
 	return res, nil
 }
 
-func (u *filesUsecase) deleteFileWorkers(ctx context.Context, client *storage.Client, jobs <-chan *files.DeleteFileReq, errs chan<- error) {
+// processUpload โหลดไฟล์มา decode เพื่อลบ EXIF หรือสร้างรูปย่อ
+// ขนาดไฟล์ถูกจำกัดไว้ตั้งแต่ตอน confirm แล้ว
+func (u *filesUsecase) processUpload(ctx context.Context, upload *files.Upload, opts *files.AttachOptions) (*files.FileRes, error) {
+	rc, err := u.storage.Get(ctx, upload.Key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, upload.MaxSize+1))
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read upload failed: %v", err)
+	}
 
-	for job := range jobs {
-		o := client.Bucket(u.cfg.App().GCPBucket()).Object(job.Destination)
+	img, err := imaging.Decode(data, u.imageLimits())
+	if err != nil {
+		return nil, err
+	}
 
-		// Optional: set a generation-match precondition to avoid potential race
-		// conditions and data corruptions. The request to delete the file is aborted
-		// if the object's generation number does not match your precondition.
-		attrs, err := o.Attrs(ctx)
-		if err != nil {
-			errs <- fmt.Errorf("object.Attrs: %v", err)
-			return
+	key := upload.Key
+	if opts.StripMetadata {
+		if img, err = imaging.StripMetadata(img); err != nil {
+			return nil, err
+		}
+		// webp ถูกแปลงเป็น png จึงอาจได้นามสกุลใหม่
+		key = fmt.Sprintf("%s.%s", strings.TrimSuffix(upload.Key, path.Ext(upload.Key)), img.Ext())
+		if _, err := u.UploadFiles([]*files.FileReq{{
+			Destination: key,
+			FileName:    path.Base(key),
+			Extension:   img.Ext(),
+			ContentType: img.ContentType(),
+			Data:        img.Data,
+		}}); err != nil {
+			return nil, err
+		}
+		if key != upload.Key {
+			if err := u.storage.Delete(ctx, upload.Key); err != nil {
+				return nil, err
+			}
+			if err := u.filesRepository.UpdateUploadKey(upload.Id, key, img.ContentType()); err != nil {
+				return nil, err
+			}
 		}
-		o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
+	}
 
-		if err := o.Delete(ctx); err != nil {
-			errs <- fmt.Errorf("Object(%q).Delete: %v", job.Destination, err)
-			return
+	res := &files.FileRes{
+		FileName: path.Base(key),
+		Url:      u.storage.PublicUrl(key),
+		Width:    img.Width,
+		Height:   img.Height,
+	}
+	if opts.Variants {
+		if res.Variants, err = u.CreateVariants(key, img); err != nil {
+			return nil, err
 		}
-		fmt.Printf("Blob %v deleted.\n", job.Destination)
-		errs <- nil
 	}
+	return res, nil
+}
+
+func (u *filesUsecase) ownedUpload(userId, uploadId string) (*files.Upload, error) {
+	upload, err := u.filesRepository.FindUpload(uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UserId != userId {
+		return nil, fmt.Errorf("upload not found")
+	}
+	return upload, nil
+}
 
+func (u *filesUsecase) imageLimits() *imaging.Limits {
+	return &imaging.Limits{
+		MaxDimension: u.cfg.App().ImageMaxDimension(),
+		MaxPixels:    u.cfg.App().ImageMaxPixels(),
+	}
 }
 
-func (u *filesUsecase) DeleteFileOnGCP(req []*files.DeleteFileReq) error {
+// ReceiveSignedUpload รับไฟล์ที่ PUT มาตาม signed url ของ local storage
+func (u *filesUsecase) ReceiveSignedUpload(key, contentType string, query url.Values, body io.Reader, size int64) error {
+	receiver, ok := u.storage.(storage.ISignedUploadReceiver)
+	if !ok {
+		return fmt.Errorf("storage backend does not accept direct uploads")
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
 
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return fmt.Errorf("storage.NewClient: %v", err)
+	return receiver.ReceiveSignedUpload(ctx, key, contentType, query, body, size)
+}
+
+// ClaimFiles ผูกไฟล์ที่ upload แล้วกับเจ้าของนอก transaction ใช้กับไฟล์ที่ไม่มีข้อมูลอื่นอ้างถึง
+func (u *filesUsecase) ClaimFiles(ownerType, ownerId string, res []*files.FileRes) error {
+	urls := make([]string, 0, len(res))
+	for _, r := range res {
+		urls = append(urls, r.Url)
+		for _, v := range r.Variants {
+			urls = append(urls, v.Url)
+		}
 	}
-	defer client.Close()
+	return u.filesRepository.ClaimAssets(ownerType, ownerId, urls)
+}
 
-	jobsCh := make(chan *files.DeleteFileReq, len(req))
-	errsCh := make(chan error, len(req))
+// SweepAssets ลบไฟล์ที่ orphaned นานกว่า grace ทีละ batch จนหมด ไฟล์ที่ลบไม่สำเร็จจะถูกลองใหม่ในรอบถัดไป
+// dryRun จะคืนรายการที่จะถูกลบ (batch แรก) โดยไม่ลบอะไร
+func (u *filesUsecase) SweepAssets(ctx context.Context, grace time.Duration, dryRun bool) (*files.SweepReport, error) {
+	report := &files.SweepReport{
+		DryRun: dryRun,
+		Cutoff: time.Now().Add(-grace),
+		Assets: make([]*files.Asset, 0),
+		Failed: make(map[string]string),
+	}
 
-	for _, r := range req {
-		jobsCh <- r
+	var after *files.Asset
+	for ctx.Err() == nil {
+		assets, err := u.filesRepository.FindOrphanedAssets(report.Cutoff, after, u.cfg.Storage().SweepBatch())
+		if err != nil {
+			return report, err
+		}
+		if dryRun {
+			report.Assets = append(report.Assets, assets...)
+			return report, nil
+		}
+
+		if len(assets) == 0 {
+			break
+		}
+		after = assets[len(assets)-1]
+		for _, a := range assets {
+			report.Assets = append(report.Assets, a)
+			deleted, err := u.sweepAsset(ctx, a, report.Cutoff)
+			if err != nil {
+				report.Failed[a.Key] = err.Error()
+				continue
+			}
+			if deleted {
+				report.Deleted++
+			}
+		}
 	}
-	close(jobsCh)
+	return report, nil
+}
 
-	numWorkers := 5
-	for i := 0; i < numWorkers; i++ {
-		go u.deleteFileWorkers(ctx, client, jobsCh, errsCh)
+// ลบออกจากทะเบียนก่อน (ถ้าถูก claim ระหว่างนี้จะไม่ลบ) แล้วค่อยลบไฟล์
+// ถ้าลบไฟล์ไม่สำเร็จ ลงทะเบียนกลับเป็น orphaned ใหม่ ซึ่งจะถูกลองลบอีกครั้งหลังครบ grace period
+func (u *filesUsecase) sweepAsset(ctx context.Context, a *files.Asset, cutoff time.Time) (bool, error) {
+	ok, err := u.filesRepository.DeleteOrphanedAsset(a.Key, cutoff)
+	if err != nil || !ok {
+		return false, err
 	}
 
-	for range req {
-		err := <-errsCh
-		if err != nil {
-			return fmt.Errorf("delete file failed: %v", err)
+	if err := u.storage.Delete(ctx, a.Key); err != nil {
+		if _, statErr := u.storage.Stat(ctx, a.Key); errors.Is(statErr, storage.ErrNotFound) {
+			return true, nil
 		}
+		if regErr := u.filesRepository.RegisterAssets([]*files.Asset{a}); regErr != nil {
+			return false, fmt.Errorf("%v (re-register failed: %v)", err, regErr)
+		}
+		return false, err
 	}
-	return nil
+	return true, nil
 }
@@ -0,0 +1,60 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/imaging"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/utils"
+)
+
+// NewImageReq ตรวจว่าไฟล์เป็นรูปจริงจากเนื้อหาไฟล์ (ไม่เชื่อนามสกุลที่ client ส่งมา)
+// แล้วสร้าง FileReq ที่ตั้งชื่อไฟล์ตามชนิดจริงไว้ใน dir
+// error ที่คืนมาทั้งหมดเป็นความผิดของไฟล์ที่ส่งมา ใช้ตอบ 400 ได้เลย
+func NewImageReq(cfg config.IAppConfig, file *multipart.FileHeader, dir string, stripMetadata bool) (*FileReq, error) {
+	if file.Size > int64(cfg.FileLimit()) {
+		return nil, fmt.Errorf("file size must less than %d MB", int(math.Ceil(float64(cfg.FileLimit())/math.Pow(1024, 2))))
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open file failed: %v", err)
+	}
+	defer f.Close()
+
+	// header ของ multipart โกหกขนาดได้ จึงอ่านไม่เกิน limit อีกชั้น
+	data, err := io.ReadAll(io.LimitReader(f, int64(cfg.FileLimit())+1))
+	if err != nil {
+		return nil, fmt.Errorf("read file failed: %v", err)
+	}
+	if len(data) > cfg.FileLimit() {
+		return nil, fmt.Errorf("file size must less than %d MB", int(math.Ceil(float64(cfg.FileLimit())/math.Pow(1024, 2))))
+	}
+
+	img, err := imaging.Decode(data, &imaging.Limits{
+		MaxDimension: cfg.ImageMaxDimension(),
+		MaxPixels:    cfg.ImageMaxPixels(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stripMetadata {
+		if img, err = imaging.StripMetadata(img); err != nil {
+			return nil, err
+		}
+	}
+
+	filename := utils.RandFileName(img.Ext())
+	return &FileReq{
+		File:        file,
+		Destination: fmt.Sprintf("%s/%s", dir, filename),
+		Extension:   img.Ext(),
+		FileName:    filename,
+		ContentType: img.ContentType(),
+		Data:        img.Data,
+		Image:       img,
+	}, nil
+}
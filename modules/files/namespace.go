@@ -0,0 +1,52 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Namespace คือกลุ่มไฟล์ที่ client เลือกได้ แต่ prefix จริงใน storage server เป็นคนกำหนด
+type Namespace string
+
+const (
+	NamespaceProducts Namespace = "products"
+	NamespaceAvatars  Namespace = "avatars"
+	NamespaceBanners  Namespace = "banners"
+)
+
+var namespacePrefixes = map[Namespace]string{
+	NamespaceProducts: "products",
+	NamespaceAvatars:  "avatars",
+	NamespaceBanners:  "banners",
+}
+
+var (
+	ErrInvalidNamespace   = errors.New("invalid upload namespace")
+	ErrInvalidDestination = errors.New("invalid upload destination")
+	ErrAssetNotFound      = errors.New("file is not registered")
+)
+
+var pathSegmentRe = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_.-]+$`)
+
+// UploadDir คืน folder ใน storage ของ namespace โดยต่อ subdir (ถ้ามี) ไว้ข้างใต้
+// subdir ต้องเป็น path แบบ relative ที่ไม่มี "..", "." หรือ segment ว่าง
+func UploadDir(namespace Namespace, subdir string) (string, error) {
+	prefix, ok := namespacePrefixes[namespace]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidNamespace, namespace)
+	}
+	if subdir == "" {
+		return prefix, nil
+	}
+	if strings.HasPrefix(subdir, "/") {
+		return "", fmt.Errorf("%w: must be a relative path", ErrInvalidDestination)
+	}
+	for _, segment := range strings.Split(subdir, "/") {
+		if segment == "." || segment == ".." || !pathSegmentRe.MatchString(segment) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidDestination, subdir)
+		}
+	}
+	return prefix + "/" + subdir, nil
+}
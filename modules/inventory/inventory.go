@@ -0,0 +1,221 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+)
+
+// ชนิดของการเคลื่อนไหวของ stock
+const (
+	MovementReceipt    = "receipt"    // รับของเข้า
+	MovementSale       = "sale"       // ส่งของตาม order ตัดทั้ง stock และที่จองไว้
+	MovementReturn     = "return"     // ลูกค้าคืนของ
+	MovementAdjustment = "adjustment" // admin แก้ยอด เช่น นับ stock แล้วไม่ตรง
+	MovementReserve    = "reserve"    // จองตอนสั่งซื้อ
+	MovementRelease    = "release"    // คืนที่จองเมื่อยกเลิก order
+)
+
+// Movement หนึ่งแถวใน ledger Qty คือจำนวนที่ on hand เปลี่ยน ReservedQty คือจำนวนที่จองเปลี่ยน
+type Movement struct {
+	Id            int64   `db:"id" json:"id"`
+	VariantId     string  `db:"variant_id" json:"variant_id"`
+	Sku           *string `db:"sku" json:"sku"` // null ถ้า variant ถูกลบไปแล้ว
+	Type          string  `db:"type" json:"type"`
+	Qty           int     `db:"qty" json:"qty"`
+	ReservedQty   int     `db:"reserved_qty" json:"reserved_qty"`
+	OnHandAfter   int     `db:"on_hand_after" json:"on_hand_after"`
+	ReservedAfter int     `db:"reserved_after" json:"reserved_after"`
+	OrderId       *string `db:"order_id" json:"order_id"`
+	UserId        *string `db:"user_id" json:"user_id"`
+	Note          string  `db:"note" json:"note"`
+	CreatedAt     string  `db:"created_at" json:"created_at"`
+}
+
+// MovementReq การเปลี่ยน stock หนึ่งครั้ง OrderId และ UserId ว่างได้
+type MovementReq struct {
+	VariantId   string
+	Type        string
+	Qty         int
+	ReservedQty int
+	OrderId     string
+	UserId      string
+	Note        string
+}
+
+// StockLevel ยอดของ variant Available = OnHand - Reserved คือจำนวนที่ขายได้
+type StockLevel struct {
+	VariantId    string `db:"variant_id" json:"variant_id"`
+	ProductId    string `db:"product_id" json:"product_id"`
+	ProductTitle string `db:"product_title" json:"product_title"`
+	Sku          string `db:"sku" json:"sku"`
+	Size         string `db:"size" json:"size"`
+	Color        string `db:"color" json:"color"`
+	OnHand       int    `db:"on_hand" json:"on_hand"`
+	Reserved     int    `db:"reserved" json:"reserved"`
+	Available    int    `db:"available" json:"available"`
+	Threshold    int    `db:"threshold" json:"threshold"` // แจ้งเตือนเมื่อ Available ไม่เกินค่านี้
+}
+
+// ReceiveReq รับของเข้า qty ต้องมากกว่า 0
+type ReceiveReq struct {
+	VariantId string `json:"variant_id" form:"variant_id"`
+	Qty       int    `json:"qty" form:"qty"`
+	Note      string `json:"note" form:"note"` // เช่น เลขที่ใบส่งของ
+	UserId    string `json:"-" form:"-"`
+}
+
+func (r *ReceiveReq) Validate() error {
+	r.VariantId = strings.TrimSpace(r.VariantId)
+	r.Note = strings.TrimSpace(r.Note)
+	if r.VariantId == "" {
+		return fmt.Errorf("variant_id is required")
+	}
+	if r.Qty <= 0 {
+		return fmt.Errorf("qty must be greater than 0")
+	}
+	return nil
+}
+
+// AdjustReq แก้ยอด on hand ด้วยมือ qty ติดลบได้ ต้องบอกเหตุผล
+type AdjustReq struct {
+	VariantId string `json:"variant_id" form:"variant_id"`
+	Qty       int    `json:"qty" form:"qty"`
+	Reason    string `json:"reason" form:"reason"`
+	UserId    string `json:"-" form:"-"`
+}
+
+func (r *AdjustReq) Validate() error {
+	r.VariantId = strings.TrimSpace(r.VariantId)
+	r.Reason = strings.TrimSpace(r.Reason)
+	if r.VariantId == "" {
+		return fmt.Errorf("variant_id is required")
+	}
+	if r.Qty == 0 {
+		return fmt.Errorf("qty must not be 0")
+	}
+	if r.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	return nil
+}
+
+// OrderItem จำนวนของ variant หนึ่งใน order Sku ใช้แสดงใน error
+type OrderItem struct {
+	VariantId string
+	Sku       string
+	Qty       int
+}
+
+func (i *OrderItem) Label() string {
+	if i.Sku != "" {
+		return "sku " + i.Sku
+	}
+	return "variant " + i.VariantId
+}
+
+// MovementFilter ประวัติการเคลื่อนไหว ใหม่สุดก่อน
+type MovementFilter struct {
+	VariantId string `json:"variant_id" query:"variant_id"`
+	OrderId   string `json:"order_id" query:"order_id"`
+	Type      string `json:"type" query:"type"`
+	*entities.PaginationReq
+}
+
+// ReconciliationReport เทียบผลรวมของ ledger กับค่าใน "ProductVariant"
+// Rows มีเฉพาะ variant ที่ไม่ตรงกัน
+type ReconciliationReport struct {
+	Checked    int                  `json:"checked"`
+	Mismatched int                  `json:"mismatched"`
+	Rows       []*ReconciliationRow `json:"rows"`
+}
+
+type ReconciliationRow struct {
+	VariantId      string `db:"variant_id" json:"variant_id"`
+	Sku            string `db:"sku" json:"sku"`
+	ProductTitle   string `db:"product_title" json:"product_title"`
+	OnHand         int    `db:"on_hand" json:"on_hand"`
+	LedgerOnHand   int    `db:"ledger_on_hand" json:"ledger_on_hand"`
+	Reserved       int    `db:"reserved" json:"reserved"`
+	LedgerReserved int    `db:"ledger_reserved" json:"ledger_reserved"`
+}
+
+// ชนิดของ alert
+const (
+	AlertLowStock   = "low_stock"    // ขายได้ไม่เกิน threshold
+	AlertOutOfStock = "out_of_stock" // ขายได้ 0 เมื่อ stock กลับมาจะแจ้งคนที่ wishlist หรือขอให้แจ้งไว้
+)
+
+// StockAlert แจ้งเตือน admin ข้อมูลสินค้าเป็น null ถ้า variant ถูกลบไปแล้ว
+// Threshold และ Available เป็นค่าตอนที่เกิด alert
+type StockAlert struct {
+	Id           int64   `json:"id"`
+	VariantId    string  `json:"variant_id"`
+	Sku          *string `json:"sku"`
+	ProductId    *string `json:"product_id"`
+	ProductTitle *string `json:"product_title"`
+	Type         string  `json:"type"`
+	Threshold    int     `json:"threshold"`
+	Available    int     `json:"available"`
+	CreatedAt    string  `json:"created_at"`
+	ResolvedAt   *string `json:"resolved_at"` // null = ยังเปิดอยู่
+}
+
+// AlertFilter status: open, resolved ว่าง = ทั้งหมด ใหม่สุดก่อน
+type AlertFilter struct {
+	Status string `json:"status" query:"status"`
+	Type   string `json:"type" query:"type"`
+	*entities.PaginationReq
+}
+
+// Threshold ของสินค้า Default = true ถ้าสินค้าไม่ได้ตั้งเองและใช้ค่าจาก config
+type Threshold struct {
+	ProductId string `db:"product_id" json:"product_id"`
+	Threshold int    `db:"threshold" json:"threshold"`
+	Default   bool   `db:"default" json:"default"`
+}
+
+// ThresholdReq ตั้ง threshold ของสินค้า threshold เป็น null = กลับไปใช้ค่าจาก config
+type ThresholdReq struct {
+	ProductId string `json:"-" form:"-"`
+	Threshold *int   `json:"threshold" form:"threshold"`
+}
+
+func (r *ThresholdReq) Validate() error {
+	if r.Threshold != nil && *r.Threshold < 0 {
+		return fmt.Errorf("threshold must not be negative")
+	}
+	return nil
+}
+
+// RestockMaxAttempts จำนวนครั้งที่ลองส่งแจ้งของกลับมาให้ลูกค้าหนึ่งคน ก่อนเลิกส่ง
+const RestockMaxAttempts = 5
+
+// RestockedVariant variant ที่กลับมามีของ AlertId คือ out_of_stock alert ล่าสุดที่รอแจ้ง
+// Recipients คือคนที่ wishlist หรือขอให้แจ้งไว้และยังไม่ได้รับแจ้ง
+type RestockedVariant struct {
+	AlertId      int64               `db:"alert_id" json:"alert_id"`
+	VariantId    string              `db:"variant_id" json:"variant_id"`
+	ProductId    string              `db:"product_id" json:"product_id"`
+	ProductTitle string              `db:"product_title" json:"product_title"`
+	Sku          string              `db:"sku" json:"sku"`
+	Size         string              `db:"size" json:"size"`
+	Color        string              `db:"color" json:"color"`
+	Available    int                 `db:"available" json:"available"`
+	Recipients   []*RestockRecipient `db:"-" json:"recipients"`
+}
+
+type RestockRecipient struct {
+	UserId string `db:"user_id" json:"user_id"`
+	Email  string `db:"email" json:"email"`
+}
+
+// StockCheckReport ผลการเช็ค stock หนึ่งรอบ
+type StockCheckReport struct {
+	Raised    []*StockAlert       `json:"raised"`
+	Resolved  []*StockAlert       `json:"resolved"`
+	Restocked []*RestockedVariant `json:"restocked"`
+	Notified  int                 `json:"notified"` // จำนวนคนที่ได้รับแจ้งว่าสินค้ากลับมา
+	Errors    []string            `json:"errors"`   // ส่งแจ้งเตือนไม่สำเร็จ
+}
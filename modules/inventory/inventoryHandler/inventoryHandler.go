@@ -0,0 +1,245 @@
+package inventoryHandler
+
+import (
+	"strings"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryUsecase"
+	"github.com/gofiber/fiber/v2"
+)
+
+type inventoryHandlerErrCode = string
+
+const (
+	findStockLevelErr inventoryHandlerErrCode = "inventory-001"
+	findMovementsErr  inventoryHandlerErrCode = "inventory-002"
+	receiveStockErr   inventoryHandlerErrCode = "inventory-003"
+	adjustStockErr    inventoryHandlerErrCode = "inventory-004"
+	reconcileStockErr inventoryHandlerErrCode = "inventory-005"
+	findThresholdErr  inventoryHandlerErrCode = "inventory-006"
+	setThresholdErr   inventoryHandlerErrCode = "inventory-007"
+	findAlertsErr     inventoryHandlerErrCode = "inventory-008"
+	checkStockErr     inventoryHandlerErrCode = "inventory-009"
+)
+
+type IInventoryHandler interface {
+	FindStockLevel(c *fiber.Ctx) error
+	FindMovements(c *fiber.Ctx) error
+	Receive(c *fiber.Ctx) error
+	Adjust(c *fiber.Ctx) error
+	Reconcile(c *fiber.Ctx) error
+	FindThreshold(c *fiber.Ctx) error
+	SetThreshold(c *fiber.Ctx) error
+	FindAlerts(c *fiber.Ctx) error
+	CheckStock(c *fiber.Ctx) error
+}
+
+type inventoryHandler struct {
+	inventoryUsecase inventoryUsecase.IInventoryUsecase
+}
+
+func InventoryHandler(inventoryUsecase inventoryUsecase.IInventoryUsecase) IInventoryHandler {
+	return &inventoryHandler{inventoryUsecase}
+}
+
+func (h *inventoryHandler) FindStockLevel(c *fiber.Ctx) error {
+	variantId := strings.TrimSpace(c.Params("variant_id"))
+
+	result, err := h.inventoryUsecase.FindStockLevel(variantId)
+	if err != nil {
+		if err.Error() == "variant not found" {
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(findStockLevelErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findStockLevelErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *inventoryHandler) FindMovements(c *fiber.Ctx) error {
+	req := &inventory.MovementFilter{
+		PaginationReq: &entities.PaginationReq{},
+	}
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findMovementsErr),
+			err.Error(),
+		).Res()
+	}
+
+	result, err := h.inventoryUsecase.FindMovements(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findMovementsErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *inventoryHandler) Receive(c *fiber.Ctx) error {
+	req := new(inventory.ReceiveReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(receiveStockErr),
+			err.Error(),
+		).Res()
+	}
+	req.UserId = actorId(c)
+
+	result, err := h.inventoryUsecase.Receive(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			stockErrStatus(err),
+			string(receiveStockErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusCreated, result).Res()
+}
+
+func (h *inventoryHandler) Adjust(c *fiber.Ctx) error {
+	req := new(inventory.AdjustReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(adjustStockErr),
+			err.Error(),
+		).Res()
+	}
+	req.UserId = actorId(c)
+
+	result, err := h.inventoryUsecase.Adjust(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			stockErrStatus(err),
+			string(adjustStockErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusCreated, result).Res()
+}
+
+// Reconcile variant ที่ยอดไม่ตรงกับ ledger
+func (h *inventoryHandler) Reconcile(c *fiber.Ctx) error {
+	result, err := h.inventoryUsecase.Reconcile()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(reconcileStockErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *inventoryHandler) FindThreshold(c *fiber.Ctx) error {
+	productId := strings.TrimSpace(c.Params("product_id"))
+
+	result, err := h.inventoryUsecase.FindThreshold(productId)
+	if err != nil {
+		if err.Error() == "product not found" {
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(findThresholdErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findThresholdErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// SetThreshold threshold เป็น null กลับไปใช้ค่าเริ่มต้น
+func (h *inventoryHandler) SetThreshold(c *fiber.Ctx) error {
+	req := new(inventory.ThresholdReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(setThresholdErr),
+			err.Error(),
+		).Res()
+	}
+	req.ProductId = strings.TrimSpace(c.Params("product_id"))
+
+	result, err := h.inventoryUsecase.SetThreshold(req)
+	if err != nil {
+		code := fiber.ErrBadRequest.Code
+		if err.Error() == "product not found" {
+			code = fiber.ErrNotFound.Code
+		}
+		return entities.NewResponse(c).Error(
+			code,
+			string(setThresholdErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *inventoryHandler) FindAlerts(c *fiber.Ctx) error {
+	req := &inventory.AlertFilter{
+		PaginationReq: &entities.PaginationReq{},
+	}
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findAlertsErr),
+			err.Error(),
+		).Res()
+	}
+
+	result, err := h.inventoryUsecase.FindAlerts(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findAlertsErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// CheckStock เช็ค stock ทันทีโดยไม่ต้องรอรอบของ worker
+func (h *inventoryHandler) CheckStock(c *fiber.Ctx) error {
+	result, err := h.inventoryUsecase.CheckStock(c.UserContext())
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(checkStockErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func actorId(c *fiber.Ctx) string {
+	userId, _ := c.Locals("userId").(string)
+	return userId
+}
+
+func stockErrStatus(err error) int {
+	switch err.Error() {
+	case "variant not found":
+		return fiber.ErrNotFound.Code
+	case "not enough stock available":
+		return fiber.ErrConflict.Code
+	default:
+		return fiber.ErrBadRequest.Code
+	}
+}
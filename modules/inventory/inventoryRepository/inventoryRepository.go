@@ -0,0 +1,867 @@
+package inventoryRepository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
+	"github.com/jmoiron/sqlx"
+)
+
+type IInventoryRepository interface {
+	FindStockLevel(variantId string) (*inventory.StockLevel, error)
+	Receive(req *inventory.ReceiveReq) (*inventory.Movement, error)
+	Adjust(req *inventory.AdjustReq) (*inventory.Movement, error)
+	FindMovements(req *inventory.MovementFilter) ([]*inventory.Movement, *entities.Cursors, error)
+	CountMovements(req *inventory.MovementFilter) int
+	Reconcile() (*inventory.ReconciliationReport, error)
+	FindThreshold(productId string) (*inventory.Threshold, error)
+	SetThreshold(req *inventory.ThresholdReq) (*inventory.Threshold, error)
+	FindAlerts(req *inventory.AlertFilter) ([]*inventory.StockAlert, *entities.Cursors, error)
+	CountAlerts(req *inventory.AlertFilter) int
+	ResolveAlerts(ctx context.Context) ([]*inventory.StockAlert, error)
+	RaiseAlerts(ctx context.Context) ([]*inventory.StockAlert, error)
+	FindRestocked(ctx context.Context) ([]*inventory.RestockedVariant, error)
+	RecordRestockDelivery(ctx context.Context, alertId int64, userId string, delivered bool) error
+	MarkRestockNotified(ctx context.Context, variantIds []string) error
+	FindAdminEmails(ctx context.Context) ([]string, error)
+}
+
+type inventoryRepository struct {
+	db  *sqlx.DB
+	cfg config.IConfig
+}
+
+func InventoryRepository(db *sqlx.DB, cfg config.IConfig) IInventoryRepository {
+	return &inventoryRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// ApplyMovement เปลี่ยน stock และ reserved ของ variant แล้วบันทึกลง ledger ใน statement เดียว
+// ทุกการเปลี่ยน stock ต้องผ่านที่นี่ ไม่งั้น ledger จะไม่ตรงกับ "ProductVariant"
+func ApplyMovement(ctx context.Context, db sqlx.ExtContext, req *inventory.MovementReq) (*inventory.Movement, error) {
+	query := `
+	WITH "v" AS (
+		UPDATE "ProductVariant" SET
+			"stock" = "stock" + $2,
+			"reserved" = "reserved" + $3
+		WHERE "id" = $1
+		RETURNING "id", "sku", "stock", "reserved"
+	), "m" AS (
+		INSERT INTO "StockMovement" (
+			"variant_id",
+			"type",
+			"qty",
+			"reserved_qty",
+			"on_hand_after",
+			"reserved_after",
+			"order_id",
+			"user_id",
+			"note"
+		)
+		SELECT
+			"v"."id",
+			$4,
+			$2,
+			$3,
+			"v"."stock",
+			"v"."reserved",
+			NULLIF($5, ''),
+			NULLIF($6, ''),
+			$7
+		FROM "v"
+		RETURNING *
+	)
+	SELECT
+		"m"."id",
+		"m"."variant_id",
+		"v"."sku",
+		"m"."type",
+		"m"."qty",
+		"m"."reserved_qty",
+		"m"."on_hand_after",
+		"m"."reserved_after",
+		"m"."order_id",
+		"m"."user_id",
+		"m"."note",
+		"m"."created_at"
+	FROM "m"
+	JOIN "v" ON "v"."id" = "m"."variant_id";`
+
+	movement := new(inventory.Movement)
+	if err := sqlx.GetContext(ctx, db, movement, query, req.VariantId, req.Qty, req.ReservedQty, req.Type, req.OrderId, req.UserId, req.Note); err != nil {
+		return nil, movementErr(err)
+	}
+	return movement, nil
+}
+
+func movementErr(err error) error {
+	switch {
+	case err.Error() == "sql: no rows in result set":
+		return fmt.Errorf("variant not found")
+	case strings.Contains(err.Error(), "ProductVariant_stock_check"),
+		strings.Contains(err.Error(), "product_variant_reserved_check"):
+		return fmt.Errorf("not enough stock available")
+	case strings.Contains(err.Error(), "ProductVariant_reserved_check"):
+		return fmt.Errorf("reserved quantity cannot be negative")
+	default:
+		return fmt.Errorf("apply stock movement failed: %v", err)
+	}
+}
+
+// SetStock แก้ on hand ให้เท่ากับ stock โดยบันทึกส่วนต่างเป็น adjustment ใช้กับการแก้ stock ตรง ๆ จากหน้าสินค้าและ import
+// ต้องเรียกใน transaction เพราะ lock variant ไว้ก่อนคำนวณส่วนต่าง
+func SetStock(ctx context.Context, db sqlx.ExtContext, variantId string, stock int, userId, note string) error {
+	query := `
+	SELECT
+		"stock"
+	FROM "ProductVariant"
+	WHERE "id" = $1
+	FOR UPDATE;`
+
+	var current int
+	if err := db.QueryRowxContext(ctx, query, variantId).Scan(&current); err != nil {
+		return movementErr(err)
+	}
+	if stock == current {
+		return nil
+	}
+
+	_, err := ApplyMovement(ctx, db, &inventory.MovementReq{
+		VariantId: variantId,
+		Type:      inventory.MovementAdjustment,
+		Qty:       stock - current,
+		UserId:    userId,
+		Note:      note,
+	})
+	return err
+}
+
+// WriteOffVariants ตัด stock และที่จองของ variant ที่กำลังจะถูกลบให้เป็น 0 ใน ledger
+// ไม่งั้น variant ที่ถูกสร้างใหม่ด้วย id เดิม (กู้คืน revision) จะมียอดไม่ตรงกับ ledger
+func WriteOffVariants(ctx context.Context, db sqlx.ExtContext, variantIds []string, userId, note string) error {
+	query := `
+	SELECT
+		"id",
+		"stock",
+		"reserved"
+	FROM "ProductVariant"
+	WHERE "id" = ANY($1)
+	AND ("stock" <> 0 OR "reserved" <> 0)
+	ORDER BY "id"
+	FOR UPDATE;`
+
+	levels := make([]struct {
+		Id       string `db:"id"`
+		Stock    int    `db:"stock"`
+		Reserved int    `db:"reserved"`
+	}, 0)
+	if err := sqlx.SelectContext(ctx, db, &levels, query, variantIds); err != nil {
+		return fmt.Errorf("find variant stock failed: %v", err)
+	}
+
+	for _, l := range levels {
+		if _, err := ApplyMovement(ctx, db, &inventory.MovementReq{
+			VariantId:   l.Id,
+			Type:        inventory.MovementAdjustment,
+			Qty:         -l.Stock,
+			ReservedQty: -l.Reserved,
+			UserId:      userId,
+			Note:        note,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReserveOrder จอง stock ของทุกรายการใน order ถ้ารายการไหนมีไม่พอได้ error ทั้ง order
+func ReserveOrder(ctx context.Context, db sqlx.ExtContext, orderId, userId string, items []*inventory.OrderItem) error {
+	for _, item := range mergeItems(items) {
+		if _, err := ApplyMovement(ctx, db, &inventory.MovementReq{
+			VariantId:   item.VariantId,
+			Type:        inventory.MovementReserve,
+			ReservedQty: item.Qty,
+			OrderId:     orderId,
+			UserId:      userId,
+		}); err != nil {
+			return fmt.Errorf("%s: %v", item.Label(), err)
+		}
+	}
+	return nil
+}
+
+// SettleOrder บันทึกการส่ง (sale) ยกเลิก (release) หรือคืนของ (return) ของ order
+// จำนวนที่คืนจากการจองดูจาก ledger ของ order จึงถูกต้องแม้ order เดิมที่ไม่เคยจอง
+func SettleOrder(ctx context.Context, db sqlx.ExtContext, orderId, userId, movementType string, items []*inventory.OrderItem) error {
+	query := `
+	SELECT
+		"variant_id",
+		SUM("reserved_qty")
+	FROM "StockMovement"
+	WHERE "order_id" = $1
+	GROUP BY "variant_id";`
+
+	rows, err := db.QueryxContext(ctx, query, orderId)
+	if err != nil {
+		return fmt.Errorf("find order reservations failed: %v", err)
+	}
+	reserved := make(map[string]int)
+	for rows.Next() {
+		var variantId string
+		var qty int
+		if err := rows.Scan(&variantId, &qty); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan order reservations failed: %v", err)
+		}
+		reserved[variantId] = qty
+	}
+	rows.Close()
+
+	for _, item := range mergeItems(items) {
+		req := &inventory.MovementReq{
+			VariantId: item.VariantId,
+			Type:      movementType,
+			OrderId:   orderId,
+			UserId:    userId,
+		}
+		switch movementType {
+		case inventory.MovementSale:
+			req.Qty, req.ReservedQty = -item.Qty, -reserved[item.VariantId]
+		case inventory.MovementRelease:
+			req.ReservedQty = -reserved[item.VariantId]
+		case inventory.MovementReturn:
+			req.Qty = item.Qty
+		default:
+			return fmt.Errorf("unsupported order movement %q", movementType)
+		}
+		if req.Qty == 0 && req.ReservedQty == 0 {
+			continue
+		}
+
+		if _, err := ApplyMovement(ctx, db, req); err != nil {
+			// variant ที่ถูกลบไปแล้วถูกตัดยอดตอนลบ ไม่มีอะไรต้องทำ
+			if err.Error() == "variant not found" {
+				continue
+			}
+			return fmt.Errorf("%s %s failed: %v", movementType, item.Label(), err)
+		}
+	}
+	return nil
+}
+
+// mergeItems รวมรายการที่เป็น variant เดียวกัน และตัดรายการที่ไม่มี variant (order ก่อนมี variant)
+func mergeItems(items []*inventory.OrderItem) []*inventory.OrderItem {
+	merged := make([]*inventory.OrderItem, 0, len(items))
+	index := make(map[string]*inventory.OrderItem)
+	for _, item := range items {
+		if item.VariantId == "" || item.Qty <= 0 {
+			continue
+		}
+		if m, ok := index[item.VariantId]; ok {
+			m.Qty += item.Qty
+			continue
+		}
+		m := &inventory.OrderItem{VariantId: item.VariantId, Sku: item.Sku, Qty: item.Qty}
+		index[item.VariantId] = m
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+func (r *inventoryRepository) FindStockLevel(variantId string) (*inventory.StockLevel, error) {
+	query := `
+	SELECT
+		"v"."id" AS "variant_id",
+		"v"."product_id",
+		"p"."product_title",
+		"v"."sku",
+		"v"."size",
+		"v"."color",
+		"v"."stock" AS "on_hand",
+		"v"."reserved",
+		"v"."stock" - "v"."reserved" AS "available",
+		COALESCE("t"."threshold", $2) AS "threshold"
+	FROM "ProductVariant" "v"
+	JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+	LEFT JOIN "StockThreshold" "t" ON "t"."product_id" = "p"."id"
+	WHERE "v"."id" = $1;`
+
+	level := new(inventory.StockLevel)
+	if err := r.db.Get(level, query, variantId, r.cfg.Inventory().LowStockThreshold()); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return nil, fmt.Errorf("variant not found")
+		default:
+			return nil, fmt.Errorf("get stock level failed: %v", err)
+		}
+	}
+	return level, nil
+}
+
+func (r *inventoryRepository) Receive(req *inventory.ReceiveReq) (*inventory.Movement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return ApplyMovement(ctx, r.db, &inventory.MovementReq{
+		VariantId: req.VariantId,
+		Type:      inventory.MovementReceipt,
+		Qty:       req.Qty,
+		UserId:    req.UserId,
+		Note:      req.Note,
+	})
+}
+
+func (r *inventoryRepository) Adjust(req *inventory.AdjustReq) (*inventory.Movement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return ApplyMovement(ctx, r.db, &inventory.MovementReq{
+		VariantId: req.VariantId,
+		Type:      inventory.MovementAdjustment,
+		Qty:       req.Qty,
+		UserId:    req.UserId,
+		Note:      req.Reason,
+	})
+}
+
+func movementWhere(b *sqlbuilder.Builder, req *inventory.MovementFilter) {
+	if req.VariantId != "" {
+		b.Where(`"m"."variant_id" = ?`, req.VariantId)
+	}
+	if req.OrderId != "" {
+		b.Where(`"m"."order_id" = ?`, req.OrderId)
+	}
+	if req.Type != "" {
+		b.Where(`"m"."type" = ?`, strings.ToLower(req.Type))
+	}
+}
+
+// FindMovements ledger ใหม่สุดก่อน
+func (r *inventoryRepository) FindMovements(req *inventory.MovementFilter) ([]*inventory.Movement, *entities.Cursors, error) {
+	keyset, err := entities.NewKeyset("movement", true, req.Cursor, &entities.KeysetColumn{Expr: `"m"."id"`, Cast: "BIGINT"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := sqlbuilder.New()
+	movementWhere(b, req)
+	b.WhereExpr(keyset.Condition(b))
+
+	query := fmt.Sprintf(`
+	SELECT
+		COALESCE(array_to_json(array_agg("t")), '[]'::json)
+	FROM (
+		SELECT
+			"m"."id",
+			"m"."variant_id",
+			"v"."sku",
+			"m"."type",
+			"m"."qty",
+			"m"."reserved_qty",
+			"m"."on_hand_after",
+			"m"."reserved_after",
+			"m"."order_id",
+			"m"."user_id",
+			"m"."note",
+			"m"."created_at",
+			%s AS "cursor_values"
+		FROM "StockMovement" "m"
+		LEFT JOIN "ProductVariant" "v" ON "v"."id" = "m"."variant_id"
+		WHERE 1 = 1%s
+		ORDER BY %s%s
+	) AS "t";`, keyset.Select(), b.Conditions(), keyset.OrderBy(), keyset.Limit(b, req.Page, req.Limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	raw := make([]byte, 0)
+	if err := r.db.GetContext(ctx, &raw, query, b.Args()...); err != nil {
+		return nil, nil, fmt.Errorf("find stock movements failed: %v", err)
+	}
+
+	rows := make([]*movementRow, 0)
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal stock movements failed: %v", err)
+	}
+
+	rows, cursors := entities.KeysetPage(keyset, rows, req.Limit, (req.Page-1)*req.Limit, func(r *movementRow) []string {
+		return r.CursorValues
+	})
+
+	movements := make([]*inventory.Movement, 0, len(rows))
+	for _, r := range rows {
+		movements = append(movements, &r.Movement)
+	}
+	return movements, cursors, nil
+}
+
+// movementRow movement หนึ่งแถวพร้อมค่าของ sort key สำหรับสร้าง cursor
+type movementRow struct {
+	inventory.Movement
+	CursorValues []string `json:"cursor_values"`
+}
+
+func (r *inventoryRepository) CountMovements(req *inventory.MovementFilter) int {
+	b := sqlbuilder.New()
+	movementWhere(b, req)
+
+	query := `
+	SELECT
+		COUNT(*)
+	FROM "StockMovement" "m"
+	WHERE 1 = 1` + b.Conditions() + `;`
+
+	var count int
+	if err := r.db.Get(&count, query, b.Args()...); err != nil {
+		log.Printf("count stock movements failed: %v", err)
+		return 0
+	}
+	return count
+}
+
+// Reconcile หา variant ที่ผลรวมของ ledger ไม่ตรงกับ "stock" หรือ "reserved"
+// ที่ไม่ตรงแปลว่ามีการแก้ "ProductVariant" ตรง ๆ โดยไม่ผ่าน ApplyMovement
+func (r *inventoryRepository) Reconcile() (*inventory.ReconciliationReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report := &inventory.ReconciliationReport{
+		Rows: make([]*inventory.ReconciliationRow, 0),
+	}
+	if err := r.db.GetContext(ctx, &report.Checked, `SELECT COUNT(*) FROM "ProductVariant";`); err != nil {
+		return nil, fmt.Errorf("count variants failed: %v", err)
+	}
+
+	query := `
+	SELECT
+		"v"."id" AS "variant_id",
+		"v"."sku",
+		"p"."product_title",
+		"v"."stock" AS "on_hand",
+		COALESCE("m"."qty", 0) AS "ledger_on_hand",
+		"v"."reserved",
+		COALESCE("m"."reserved_qty", 0) AS "ledger_reserved"
+	FROM "ProductVariant" "v"
+	JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+	LEFT JOIN (
+		SELECT
+			"variant_id",
+			SUM("qty") AS "qty",
+			SUM("reserved_qty") AS "reserved_qty"
+		FROM "StockMovement"
+		GROUP BY "variant_id"
+	) AS "m" ON "m"."variant_id" = "v"."id"
+	WHERE "v"."stock" <> COALESCE("m"."qty", 0)
+	OR "v"."reserved" <> COALESCE("m"."reserved_qty", 0)
+	ORDER BY "v"."id";`
+
+	if err := r.db.SelectContext(ctx, &report.Rows, query); err != nil {
+		return nil, fmt.Errorf("reconcile stock failed: %v", err)
+	}
+	report.Mismatched = len(report.Rows)
+	return report, nil
+}
+
+func (r *inventoryRepository) FindThreshold(productId string) (*inventory.Threshold, error) {
+	query := `
+	SELECT
+		"p"."id" AS "product_id",
+		COALESCE("t"."threshold", $2) AS "threshold",
+		"t"."threshold" IS NULL AS "default"
+	FROM "Product" "p"
+	LEFT JOIN "StockThreshold" "t" ON "t"."product_id" = "p"."id"
+	WHERE "p"."id" = $1;`
+
+	threshold := new(inventory.Threshold)
+	if err := r.db.Get(threshold, query, productId, r.cfg.Inventory().LowStockThreshold()); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return nil, fmt.Errorf("product not found")
+		default:
+			return nil, fmt.Errorf("get threshold failed: %v", err)
+		}
+	}
+	return threshold, nil
+}
+
+// SetThreshold threshold เป็น nil ลบค่าของสินค้าให้กลับไปใช้ค่าจาก config
+func (r *inventoryRepository) SetThreshold(req *inventory.ThresholdReq) (*inventory.Threshold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if req.Threshold == nil {
+		if _, err := r.db.ExecContext(ctx, `DELETE FROM "StockThreshold" WHERE "product_id" = $1;`, req.ProductId); err != nil {
+			return nil, fmt.Errorf("reset threshold failed: %v", err)
+		}
+		return r.FindThreshold(req.ProductId)
+	}
+
+	query := `
+	INSERT INTO "StockThreshold" (
+		"product_id",
+		"threshold"
+	)
+	VALUES ($1, $2)
+	ON CONFLICT ("product_id") DO UPDATE SET
+		"threshold" = EXCLUDED."threshold";`
+
+	if _, err := r.db.ExecContext(ctx, query, req.ProductId, *req.Threshold); err != nil {
+		if strings.Contains(err.Error(), "StockThreshold_product_id_fkey") {
+			return nil, fmt.Errorf("product not found")
+		}
+		return nil, fmt.Errorf("set threshold failed: %v", err)
+	}
+	return r.FindThreshold(req.ProductId)
+}
+
+// alertColumns คอลัมน์ของ alert "a" ข้อมูลสินค้าจาก LEFT JOIN ของ variant "v" และสินค้า "p"
+const alertColumns = `
+			"a"."id",
+			"a"."variant_id",
+			"v"."sku",
+			"p"."id" AS "product_id",
+			"p"."product_title",
+			"a"."type",
+			"a"."threshold",
+			"a"."available",
+			"a"."created_at",
+			"a"."resolved_at"`
+
+func alertWhere(b *sqlbuilder.Builder, req *inventory.AlertFilter) {
+	switch strings.ToLower(req.Status) {
+	case "open":
+		b.WhereExpr(`"a"."resolved_at" IS NULL`)
+	case "resolved":
+		b.WhereExpr(`"a"."resolved_at" IS NOT NULL`)
+	}
+	if req.Type != "" {
+		b.Where(`"a"."type" = ?`, strings.ToLower(req.Type))
+	}
+}
+
+// FindAlerts alert ใหม่สุดก่อน
+func (r *inventoryRepository) FindAlerts(req *inventory.AlertFilter) ([]*inventory.StockAlert, *entities.Cursors, error) {
+	keyset, err := entities.NewKeyset("alert", true, req.Cursor, &entities.KeysetColumn{Expr: `"a"."id"`, Cast: "BIGINT"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := sqlbuilder.New()
+	alertWhere(b, req)
+	b.WhereExpr(keyset.Condition(b))
+
+	query := fmt.Sprintf(`
+	SELECT
+		COALESCE(array_to_json(array_agg("t")), '[]'::json)
+	FROM (
+		SELECT%s,
+			%s AS "cursor_values"
+		FROM "StockAlert" "a"
+		LEFT JOIN "ProductVariant" "v" ON "v"."id" = "a"."variant_id"
+		LEFT JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+		WHERE 1 = 1%s
+		ORDER BY %s%s
+	) AS "t";`, alertColumns, keyset.Select(), b.Conditions(), keyset.OrderBy(), keyset.Limit(b, req.Page, req.Limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	raw := make([]byte, 0)
+	if err := r.db.GetContext(ctx, &raw, query, b.Args()...); err != nil {
+		return nil, nil, fmt.Errorf("find stock alerts failed: %v", err)
+	}
+
+	rows := make([]*alertRow, 0)
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal stock alerts failed: %v", err)
+	}
+
+	rows, cursors := entities.KeysetPage(keyset, rows, req.Limit, (req.Page-1)*req.Limit, func(r *alertRow) []string {
+		return r.CursorValues
+	})
+
+	alerts := make([]*inventory.StockAlert, 0, len(rows))
+	for _, r := range rows {
+		alerts = append(alerts, &r.StockAlert)
+	}
+	return alerts, cursors, nil
+}
+
+// alertRow alert หนึ่งแถวพร้อมค่าของ sort key สำหรับสร้าง cursor
+type alertRow struct {
+	inventory.StockAlert
+	CursorValues []string `json:"cursor_values"`
+}
+
+func (r *inventoryRepository) CountAlerts(req *inventory.AlertFilter) int {
+	b := sqlbuilder.New()
+	alertWhere(b, req)
+
+	query := `
+	SELECT
+		COUNT(*)
+	FROM "StockAlert" "a"
+	WHERE 1 = 1` + b.Conditions() + `;`
+
+	var count int
+	if err := r.db.Get(&count, query, b.Args()...); err != nil {
+		log.Printf("count stock alerts failed: %v", err)
+		return 0
+	}
+	return count
+}
+
+// findAlertsById alert ตาม id สำหรับ alert ที่เพิ่งเปิดหรือปิด
+func (r *inventoryRepository) findAlertsById(ctx context.Context, ids []int64) ([]*inventory.StockAlert, error) {
+	alerts := make([]*inventory.StockAlert, 0)
+	if len(ids) == 0 {
+		return alerts, nil
+	}
+
+	query := `
+	SELECT
+		COALESCE(array_to_json(array_agg("t")), '[]'::json)
+	FROM (
+		SELECT` + alertColumns + `
+		FROM "StockAlert" "a"
+		LEFT JOIN "ProductVariant" "v" ON "v"."id" = "a"."variant_id"
+		LEFT JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+		WHERE "a"."id" = ANY($1)
+		ORDER BY "a"."id"
+	) AS "t";`
+
+	raw := make([]byte, 0)
+	if err := r.db.GetContext(ctx, &raw, query, ids); err != nil {
+		return nil, fmt.Errorf("find stock alerts failed: %v", err)
+	}
+	if err := json.Unmarshal(raw, &alerts); err != nil {
+		return nil, fmt.Errorf("unmarshal stock alerts failed: %v", err)
+	}
+	return alerts, nil
+}
+
+// stockLevelsQuery จำนวนที่ขายได้และ threshold ของทุก variant ที่ยังไม่ archive ค่าเริ่มต้นของ threshold อยู่ที่ $1
+const stockLevelsQuery = `
+	SELECT
+		"v"."id" AS "variant_id",
+		"v"."stock" - "v"."reserved" AS "available",
+		COALESCE("t"."threshold", $1) AS "threshold"
+	FROM "ProductVariant" "v"
+	JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+	LEFT JOIN "StockThreshold" "t" ON "t"."product_id" = "p"."id"
+	WHERE "p"."status" <> 'archived'`
+
+// ResolveAlerts ปิด alert ที่ไม่ตรงเงื่อนไขแล้ว: stock กลับมา, low stock ที่กลายเป็นหมด, variant ถูกลบหรือสินค้าถูก archive
+func (r *inventoryRepository) ResolveAlerts(ctx context.Context) ([]*inventory.StockAlert, error) {
+	query := `
+	WITH "l" AS (` + stockLevelsQuery + `
+	)
+	UPDATE "StockAlert" "a" SET
+		"resolved_at" = now()
+	WHERE "a"."resolved_at" IS NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM "l"
+		WHERE "l"."variant_id" = "a"."variant_id"
+		AND (
+			("a"."type" = 'out_of_stock' AND "l"."available" <= 0)
+			OR ("a"."type" = 'low_stock' AND "l"."available" > 0 AND "l"."available" <= "l"."threshold")
+		)
+	)
+	RETURNING "a"."id";`
+
+	ids := make([]int64, 0)
+	if err := r.db.SelectContext(ctx, &ids, query, r.cfg.Inventory().LowStockThreshold()); err != nil {
+		return nil, fmt.Errorf("resolve stock alerts failed: %v", err)
+	}
+	return r.findAlertsById(ctx, ids)
+}
+
+// RaiseAlerts เปิด alert ให้ variant ที่หมดหรือเหลือไม่เกิน threshold และยังไม่มี alert ที่เปิดอยู่
+func (r *inventoryRepository) RaiseAlerts(ctx context.Context) ([]*inventory.StockAlert, error) {
+	query := `
+	WITH "l" AS (` + stockLevelsQuery + `
+	)
+	INSERT INTO "StockAlert" (
+		"variant_id",
+		"type",
+		"threshold",
+		"available"
+	)
+	SELECT
+		"l"."variant_id",
+		CASE WHEN "l"."available" <= 0 THEN 'out_of_stock' ELSE 'low_stock' END,
+		"l"."threshold",
+		"l"."available"
+	FROM "l"
+	WHERE "l"."available" <= "l"."threshold"
+	ON CONFLICT ("variant_id", "type") WHERE "resolved_at" IS NULL DO NOTHING
+	RETURNING "id";`
+
+	ids := make([]int64, 0)
+	if err := r.db.SelectContext(ctx, &ids, query, r.cfg.Inventory().LowStockThreshold()); err != nil {
+		return nil, fmt.Errorf("raise stock alerts failed: %v", err)
+	}
+	return r.findAlertsById(ctx, ids)
+}
+
+// FindRestocked variant ที่ out_of_stock ถูกปิดแล้วแต่ยังไม่ได้แจ้งลูกค้า และตอนนี้ขายได้และแสดงหน้าร้านอยู่
+// พร้อมคนที่ wishlist หรือขอให้แจ้งไว้ที่ยังไม่ได้รับแจ้งและยังลองส่งไม่ครบ inventory.RestockMaxAttempts
+// สินค้าที่ยังซ่อนอยู่รอไว้แจ้งในรอบที่สินค้าแสดงหน้าร้าน
+func (r *inventoryRepository) FindRestocked(ctx context.Context) ([]*inventory.RestockedVariant, error) {
+	restocked := make([]*inventory.RestockedVariant, 0)
+
+	query := `
+	SELECT
+		"a"."alert_id",
+		"v"."id" AS "variant_id",
+		"p"."id" AS "product_id",
+		"p"."product_title",
+		"v"."sku",
+		"v"."size",
+		"v"."color",
+		"v"."stock" - "v"."reserved" AS "available"
+	FROM "ProductVariant" "v"
+	JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+	JOIN (
+		SELECT
+			"variant_id",
+			MAX("id") AS "alert_id"
+		FROM "StockAlert"
+		WHERE "type" = 'out_of_stock'
+		AND "resolved_at" IS NOT NULL
+		AND "restock_notified_at" IS NULL
+		GROUP BY "variant_id"
+	) AS "a" ON "a"."variant_id" = "v"."id"
+	WHERE "v"."stock" > "v"."reserved"
+	AND ` + product.VisibleQuery(`"p"`) + `
+	ORDER BY "v"."id";`
+
+	if err := r.db.SelectContext(ctx, &restocked, query); err != nil {
+		return nil, fmt.Errorf("find restocked variants failed: %v", err)
+	}
+	if len(restocked) == 0 {
+		return restocked, nil
+	}
+
+	variantIds := make([]string, 0, len(restocked))
+	alertIds := make([]int64, 0, len(restocked))
+	for _, v := range restocked {
+		variantIds = append(variantIds, v.VariantId)
+		alertIds = append(alertIds, v.AlertId)
+	}
+
+	recipientsQuery := `
+	SELECT DISTINCT
+		"r"."variant_id",
+		"u"."id" AS "user_id",
+		"u"."email"
+	FROM (
+		SELECT "variant_id", "user_id" FROM "Wishlist" WHERE "variant_id" = ANY($1)
+		UNION
+		SELECT "variant_id", "user_id" FROM "StockSubscription" WHERE "variant_id" = ANY($1)
+	) AS "r"
+	JOIN unnest($1::VARCHAR[], $2::BIGINT[]) AS "a" ("variant_id", "alert_id") ON "a"."variant_id" = "r"."variant_id"
+	JOIN "User" "u" ON "u"."id" = "r"."user_id"
+	WHERE NOT EXISTS (
+		SELECT 1 FROM "RestockDelivery" "d"
+		WHERE "d"."alert_id" = "a"."alert_id"
+		AND "d"."user_id" = "r"."user_id"
+		AND ("d"."delivered_at" IS NOT NULL OR "d"."attempts" >= $3)
+	)
+	ORDER BY "r"."variant_id", "u"."email";`
+
+	recipients := make([]struct {
+		VariantId string `db:"variant_id"`
+		inventory.RestockRecipient
+	}, 0)
+	if err := r.db.SelectContext(ctx, &recipients, recipientsQuery, variantIds, alertIds, inventory.RestockMaxAttempts); err != nil {
+		return nil, fmt.Errorf("find restock recipients failed: %v", err)
+	}
+
+	index := make(map[string]*inventory.RestockedVariant, len(restocked))
+	for _, v := range restocked {
+		v.Recipients = make([]*inventory.RestockRecipient, 0)
+		index[v.VariantId] = v
+	}
+	for _, rc := range recipients {
+		if v, ok := index[rc.VariantId]; ok {
+			recipient := rc.RestockRecipient
+			v.Recipients = append(v.Recipients, &recipient)
+		}
+	}
+	return restocked, nil
+}
+
+// RecordRestockDelivery บันทึกผลการแจ้งลูกค้าหนึ่งคน ส่งไม่สำเร็จนับเป็นหนึ่ง attempt
+func (r *inventoryRepository) RecordRestockDelivery(ctx context.Context, alertId int64, userId string, delivered bool) error {
+	query := `
+	INSERT INTO "RestockDelivery" (
+		"alert_id",
+		"user_id",
+		"attempts",
+		"delivered_at"
+	)
+	VALUES ($1, $2, 1, CASE WHEN $3::BOOLEAN THEN now() END)
+	ON CONFLICT ("alert_id", "user_id") DO UPDATE SET
+		"attempts" = "RestockDelivery"."attempts" + 1,
+		"delivered_at" = EXCLUDED."delivered_at";`
+
+	if _, err := r.db.ExecContext(ctx, query, alertId, userId, delivered); err != nil {
+		return fmt.Errorf("record restock delivery failed: %v", err)
+	}
+	return nil
+}
+
+// MarkRestockNotified บันทึกว่าแจ้งลูกค้าของ variant แล้ว และลบคำขอให้แจ้ง ส่วน wishlist ยังอยู่
+func (r *inventoryRepository) MarkRestockNotified(ctx context.Context, variantIds []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %v", err)
+	}
+
+	query := `
+	UPDATE "StockAlert" SET
+		"restock_notified_at" = now()
+	WHERE "variant_id" = ANY($1)
+	AND "type" = 'out_of_stock'
+	AND "resolved_at" IS NOT NULL
+	AND "restock_notified_at" IS NULL;`
+
+	if _, err := tx.ExecContext(ctx, query, variantIds); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("mark restock notified failed: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "StockSubscription" WHERE "variant_id" = ANY($1);`, variantIds); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("clear stock subscriptions failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %v", err)
+	}
+	return nil
+}
+
+// FindAdminEmails ผู้รับ alert จาก NOTIFY_ADMIN_EMAILS ถ้าไม่ได้ตั้งใช้ email ของ admin ทุกคน
+func (r *inventoryRepository) FindAdminEmails(ctx context.Context) ([]string, error) {
+	if emails := r.cfg.Notify().AdminEmails(); len(emails) > 0 {
+		return emails, nil
+	}
+
+	emails := make([]string, 0)
+	if err := r.db.SelectContext(ctx, &emails, `SELECT "email" FROM "User" WHERE "role_id" = 2 ORDER BY "email";`); err != nil {
+		return nil, fmt.Errorf("find admin emails failed: %v", err)
+	}
+	return emails, nil
+}
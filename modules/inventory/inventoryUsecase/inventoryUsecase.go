@@ -0,0 +1,243 @@
+package inventoryUsecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/notify"
+)
+
+type IInventoryUsecase interface {
+	FindStockLevel(variantId string) (*inventory.StockLevel, error)
+	FindMovements(req *inventory.MovementFilter) (*entities.PaginateRes, error)
+	Receive(req *inventory.ReceiveReq) (*inventory.Movement, error)
+	Adjust(req *inventory.AdjustReq) (*inventory.Movement, error)
+	Reconcile() (*inventory.ReconciliationReport, error)
+	FindThreshold(productId string) (*inventory.Threshold, error)
+	SetThreshold(req *inventory.ThresholdReq) (*inventory.Threshold, error)
+	FindAlerts(req *inventory.AlertFilter) (*entities.PaginateRes, error)
+	CheckStock(ctx context.Context) (*inventory.StockCheckReport, error)
+}
+
+type inventoryUsecase struct {
+	inventoryRepository inventoryRepository.IInventoryRepository
+	notifier            notify.INotifier
+}
+
+func InventoryUsecase(inventoryRepository inventoryRepository.IInventoryRepository, notifier notify.INotifier) IInventoryUsecase {
+	return &inventoryUsecase{
+		inventoryRepository: inventoryRepository,
+		notifier:            notifier,
+	}
+}
+
+func (u *inventoryUsecase) FindStockLevel(variantId string) (*inventory.StockLevel, error) {
+	return u.inventoryRepository.FindStockLevel(variantId)
+}
+
+func (u *inventoryUsecase) FindMovements(req *inventory.MovementFilter) (*entities.PaginateRes, error) {
+	if req.Page < 1 || req.Cursor != "" {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	movements, cursors, err := u.inventoryRepository.FindMovements(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entities.PaginateRes{
+		Data:       movements,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		NextCursor: cursors.Next,
+		PrevCursor: cursors.Prev,
+	}
+	if req.Cursor != "" {
+		// หน้าแบบ cursor ไม่มีเลขหน้า
+		res.Page = 0
+	}
+	if req.CountTotal() {
+		res.TotalItem = u.inventoryRepository.CountMovements(req)
+		res.TotalPage = int(math.Ceil(float64(res.TotalItem) / float64(req.Limit)))
+	}
+	return res, nil
+}
+
+func (u *inventoryUsecase) Receive(req *inventory.ReceiveReq) (*inventory.Movement, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.inventoryRepository.Receive(req)
+}
+
+func (u *inventoryUsecase) Adjust(req *inventory.AdjustReq) (*inventory.Movement, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.inventoryRepository.Adjust(req)
+}
+
+func (u *inventoryUsecase) Reconcile() (*inventory.ReconciliationReport, error) {
+	return u.inventoryRepository.Reconcile()
+}
+
+func (u *inventoryUsecase) FindThreshold(productId string) (*inventory.Threshold, error) {
+	return u.inventoryRepository.FindThreshold(productId)
+}
+
+func (u *inventoryUsecase) SetThreshold(req *inventory.ThresholdReq) (*inventory.Threshold, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.inventoryRepository.SetThreshold(req)
+}
+
+func (u *inventoryUsecase) FindAlerts(req *inventory.AlertFilter) (*entities.PaginateRes, error) {
+	if req.Page < 1 || req.Cursor != "" {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	alerts, cursors, err := u.inventoryRepository.FindAlerts(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entities.PaginateRes{
+		Data:       alerts,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		NextCursor: cursors.Next,
+		PrevCursor: cursors.Prev,
+	}
+	if req.Cursor != "" {
+		// หน้าแบบ cursor ไม่มีเลขหน้า
+		res.Page = 0
+	}
+	if req.CountTotal() {
+		res.TotalItem = u.inventoryRepository.CountAlerts(req)
+		res.TotalPage = int(math.Ceil(float64(res.TotalItem) / float64(req.Limit)))
+	}
+	return res, nil
+}
+
+// CheckStock เช็ค stock หนึ่งรอบ: ปิด alert ที่ stock กลับมาแล้ว เปิด alert ใหม่แล้วแจ้ง admin
+// และแจ้งคนที่ wishlist หรือขอให้แจ้งไว้เมื่อ variant ที่หมดกลับมามีของและสินค้าแสดงหน้าร้านอยู่
+// alert ของ admin ถูกบันทึกก่อนส่ง ส่งไม่สำเร็จจะไม่ถูกส่งซ้ำ ดูได้จาก Errors และ log
+// ส่วนลูกค้าที่ส่งไม่สำเร็จจะถูกลองใหม่ทีละคนไม่เกิน inventory.RestockMaxAttempts ครั้ง
+// และ variant ที่สินค้ายังซ่อนอยู่จะถูกแจ้งในรอบที่สินค้าแสดงหน้าร้าน
+func (u *inventoryUsecase) CheckStock(ctx context.Context) (*inventory.StockCheckReport, error) {
+	report := &inventory.StockCheckReport{
+		Restocked: make([]*inventory.RestockedVariant, 0),
+		Errors:    make([]string, 0),
+	}
+
+	resolved, err := u.inventoryRepository.ResolveAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Resolved = resolved
+
+	raised, err := u.inventoryRepository.RaiseAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Raised = raised
+
+	if len(raised) > 0 {
+		if err := u.notifyAdmins(ctx, raised); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	restocked, err := u.inventoryRepository.FindRestocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Restocked = restocked
+
+	// ส่งและบันทึกผลทีละคน คนที่ส่งไม่สำเร็จถูกลองใหม่รอบหน้าโดยไม่ส่งซ้ำให้คนอื่น
+	// variant ถูก mark ว่าแจ้งแล้วเมื่อไม่เหลือคนที่ต้องส่ง
+	notified := make([]string, 0, len(restocked))
+	for _, v := range restocked {
+		pending := 0
+		for _, rc := range v.Recipients {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			err := u.notifier.Notify(ctx, backInStockMessage(v, rc.Email))
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("notify back in stock %s failed: %v", v.Sku, err))
+				pending++
+			} else {
+				report.Notified++
+			}
+			if recErr := u.inventoryRepository.RecordRestockDelivery(ctx, v.AlertId, rc.UserId, err == nil); recErr != nil {
+				report.Errors = append(report.Errors, recErr.Error())
+				pending++
+			}
+		}
+		if pending == 0 {
+			notified = append(notified, v.VariantId)
+		}
+	}
+	if len(notified) > 0 {
+		if err := u.inventoryRepository.MarkRestockNotified(ctx, notified); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	return report, nil
+}
+
+func (u *inventoryUsecase) notifyAdmins(ctx context.Context, alerts []*inventory.StockAlert) error {
+	emails, err := u.inventoryRepository.FindAdminEmails(ctx)
+	if err != nil {
+		return err
+	}
+	if len(emails) == 0 {
+		return fmt.Errorf("no admin to notify of %d stock alerts", len(alerts))
+	}
+
+	var body strings.Builder
+	body.WriteString("The following variants need restocking:\n\n")
+	for _, a := range alerts {
+		fmt.Fprintf(&body, "- [%s] %s %s: %d available (threshold %d)\n", a.Type, deref(a.Sku), deref(a.ProductTitle), a.Available, a.Threshold)
+	}
+
+	if err := u.notifier.Notify(ctx, &notify.Message{
+		To:      emails,
+		Subject: fmt.Sprintf("Stock alert: %d variants low or out of stock", len(alerts)),
+		Body:    body.String(),
+	}); err != nil {
+		return fmt.Errorf("notify stock alerts failed: %v", err)
+	}
+	return nil
+}
+
+func backInStockMessage(v *inventory.RestockedVariant, to string) *notify.Message {
+	return &notify.Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("%s is back in stock", v.ProductTitle),
+		Body: fmt.Sprintf(
+			"%s (size %s, color %s) from your wishlist is back in stock, %d available now.\n",
+			v.ProductTitle, v.Size, v.Color, v.Available,
+		),
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -1,13 +1,24 @@
 package middlewareHandler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares/middlewareUsecase"
 	"github.com/deeptech-kmitl/Cicero-Backend/pkg/auth"
+	applog "github.com/deeptech-kmitl/Cicero-Backend/pkg/logger"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/ratelimit"
 	"github.com/deeptech-kmitl/Cicero-Backend/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -21,39 +32,72 @@ const (
 	jwtAuthErr     middlewareHandlersErrCode = "middleware-002"
 	paramsCheckErr middlewareHandlersErrCode = "middleware-003"
 	authorizeErr   middlewareHandlersErrCode = "middleware-004"
+	rateLimitErr   middlewareHandlersErrCode = "middleware-005"
+	recoverErr     middlewareHandlersErrCode = "middleware-006"
+	securityErr    middlewareHandlersErrCode = "middleware-007"
 )
 
 type IMiddlewaresHandler interface {
-	Cors() fiber.Handler
+	Cors(policy middlewares.CorsPolicy) fiber.Handler
 	RouterCheck() fiber.Handler
 	Logger() fiber.Handler
 	JwtAuth() fiber.Handler
+	OptionalJwtAuth() fiber.Handler
 	ParamsCheck() fiber.Handler
 	Authorize(expectRoleId ...int) fiber.Handler
+	RateLimit(policy *middlewares.RateLimitPolicy) fiber.Handler
+	Recover() fiber.Handler
+	Security() fiber.Handler
 }
 
 type middlewaresHandler struct {
 	cfg               config.IConfig
 	middlewareUsecase middlewareUsecase.IMiddlewaresUsecase
+	rateLimitStore    ratelimit.IStore
 }
 
-func MiddlewaresHandler(cfg config.IConfig, usecase middlewareUsecase.IMiddlewaresUsecase) IMiddlewaresHandler {
+func MiddlewaresHandler(cfg config.IConfig, usecase middlewareUsecase.IMiddlewaresUsecase, rateLimitStore ratelimit.IStore) IMiddlewaresHandler {
 	return &middlewaresHandler{
 		cfg:               cfg,
 		middlewareUsecase: usecase,
+		rateLimitStore:    rateLimitStore,
 	}
 }
 
-// กำหนด cors ให้กับ api
-func (h *middlewaresHandler) Cors() fiber.Handler {
+// กำหนด cors ให้กับ route group ตาม policy ที่เลือก
+func (h *middlewaresHandler) Cors(policy middlewares.CorsPolicy) fiber.Handler {
+	public := h.corsHandler(h.cfg.Cors().Public())
+	admin := h.corsHandler(h.cfg.Cors().Admin())
+
+	switch policy {
+	case middlewares.CorsAdmin:
+		return admin
+	case middlewares.CorsCatalog:
+		return func(c *fiber.Ctx) error {
+			// preflight บอก method จริงมาใน Access-Control-Request-Method
+			method := c.Method()
+			if method == fiber.MethodOptions {
+				method = c.Get(fiber.HeaderAccessControlRequestMethod)
+			}
+			if method == fiber.MethodGet || method == fiber.MethodHead {
+				return public(c)
+			}
+			return admin(c)
+		}
+	default:
+		return public
+	}
+}
+
+func (h *middlewaresHandler) corsHandler(policy config.ICorsPolicy) fiber.Handler {
 	return cors.New(cors.Config{
 		Next:             cors.ConfigDefault.Next,
-		AllowOrigins:     "*",
+		AllowOrigins:     strings.Join(policy.AllowOrigins(), ","),
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders:     "",
-		AllowCredentials: false,
-		ExposeHeaders:    "",
-		MaxAge:           0,
+		AllowHeaders:     strings.Join(policy.AllowHeaders(), ","),
+		AllowCredentials: policy.AllowCredentials(),
+		ExposeHeaders:    strings.Join(policy.ExposeHeaders(), ","),
+		MaxAge:           policy.MaxAge(),
 	})
 }
 
@@ -68,11 +112,18 @@ func (h *middlewaresHandler) RouterCheck() fiber.Handler {
 	}
 }
 
+// Logger log ทุก request ตาม APP_LOG_LEVEL: warn ขึ้นไปเหลือแค่ 4xx/5xx, error เหลือแค่ 5xx
 func (h *middlewaresHandler) Logger() fiber.Handler {
 	return logger.New(logger.Config{
 		Format:     "${time} [${ip}] ${status} - ${method} ${path}\n",
 		TimeFormat: "02/01/2006",
 		TimeZone:   "Bangkok/Asia",
+		Output:     io.Discard,
+		Done: func(c *fiber.Ctx, logString []byte) {
+			if applog.Enabled(applog.StatusLevel(c.Response().StatusCode())) {
+				os.Stdout.Write(logString)
+			}
+		},
 	})
 }
 
@@ -107,6 +158,30 @@ func (h *middlewaresHandler) JwtAuth() fiber.Handler {
 	}
 }
 
+// OptionalJwtAuth ใส่ userId และ roleId ให้ถ้ามี token ที่ใช้ได้ ไม่มีหรือใช้ไม่ได้ผ่านไปแบบไม่ login
+// ใช้กับ endpoint สาธารณะที่ admin เห็นข้อมูลมากกว่า
+func (h *middlewaresHandler) OptionalJwtAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if token == "" {
+			return c.Next()
+		}
+
+		result, err := auth.ParseToken(h.cfg.Jwt(), token)
+		if err != nil {
+			return c.Next()
+		}
+		claims := result.Claims
+		if !h.middlewareUsecase.FindAccessToken(claims.Id, token) {
+			return c.Next()
+		}
+
+		c.Locals("userId", claims.Id)
+		c.Locals("userRoleId", claims.RoleId)
+		return c.Next()
+	}
+}
+
 // ป้องกันการเข้าถึงข้อมูลของคนอื่น ต้องมาคู่กับ JwtAuth
 func (h *middlewaresHandler) ParamsCheck() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -179,3 +254,109 @@ func (h *middlewaresHandler) Authorize(expectRoleId ...int) fiber.Handler {
 		).Res()
 	}
 }
+
+// จำกัดจำนวน request ตาม policy และตอบ header RateLimit-* ตาม draft-ietf-httpapi-ratelimit-headers
+func (h *middlewaresHandler) RateLimit(policy *middlewares.RateLimitPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := fmt.Sprintf("%s:%s", policy.Name, rateLimitKey(c, policy.KeyBy))
+
+		result, err := h.rateLimitStore.Take(c.UserContext(), key, policy.Limit, policy.Window)
+		if err != nil {
+			// store ล่มไม่ควรทำให้ api ใช้งานไม่ได้
+			log.Printf("rate limit store failed: %v", err)
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			return entities.NewResponse(c).Error(
+				fiber.ErrTooManyRequests.Code,
+				string(rateLimitErr),
+				"too many requests",
+			).Res()
+		}
+		return c.Next()
+	}
+}
+
+func rateLimitKey(c *fiber.Ctx, keyBy middlewares.RateLimitKey) string {
+	switch keyBy {
+	case middlewares.RateLimitByUser:
+		if userId, ok := c.Locals("userId").(string); ok && userId != "" {
+			return "user:" + userId
+		}
+	case middlewares.RateLimitByApiKey:
+		if apiKey := c.Get("X-API-Key"); apiKey != "" {
+			// ไม่เก็บ api key ตัวจริงไว้ใน store
+			sum := sha256.Sum256([]byte(apiKey))
+			return "api_key:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + c.IP()
+}
+
+// ดัก panic แล้วตอบกลับเป็น ErrorResponse แทนการตัด connection ต้องอยู่เป็นตัวแรกสุด
+func (h *middlewaresHandler) Recover() fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("panic recovered: %v\n%s", r, debug.Stack())
+				err = entities.NewResponse(c).Error(
+					fiber.ErrInternalServerError.Code,
+					string(recoverErr),
+					"internal server error",
+				).Res()
+			}
+		}()
+		return c.Next()
+	}
+}
+
+// ใส่ security headers ให้ทุก response และปฏิเสธ JSON body ที่ใหญ่เกินกำหนด
+func (h *middlewaresHandler) Security() fiber.Handler {
+	hsts := ""
+	if h.cfg.App().HstsMaxAge() > 0 {
+		hsts = fmt.Sprintf("max-age=%d; includeSubDomains", h.cfg.App().HstsMaxAge())
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		c.Set(fiber.HeaderXFrameOptions, "DENY")
+		c.Set(fiber.HeaderReferrerPolicy, "strict-origin-when-cross-origin")
+		if hsts != "" {
+			c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+		}
+
+		// BodyLimit ครอบคลุม multipart ที่มีไฟล์ ส่วน JSON ไม่ควรใหญ่ขนาดนั้น
+		// body แบบ chunked ไม่มี Content-Length (ได้ค่าติดลบ) ต้องดูขนาด body ที่อ่านมาแล้วแทน
+		if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) &&
+			jsonBodySize(c) > h.cfg.App().JsonLimit() {
+			return entities.NewResponse(c).Error(
+				fiber.ErrRequestEntityTooLarge.Code,
+				string(securityErr),
+				fmt.Sprintf("json body must less than %d bytes", h.cfg.App().JsonLimit()),
+			).Res()
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMETextHTML) {
+			c.Set(fiber.HeaderContentSecurityPolicy, h.cfg.App().Csp())
+		}
+		return nil
+	}
+}
+
+func jsonBodySize(c *fiber.Ctx) int {
+	if size := c.Request().Header.ContentLength(); size >= 0 {
+		return size
+	}
+	return len(c.Body())
+}
@@ -1,6 +1,34 @@
 package middlewares
 
+import "time"
+
 type Role struct {
 	Id    int    `json:"id" db:"id"`
 	Title string `json:"title" db:"title"`
 }
+
+// CorsPolicy คือชื่อ policy ของ cors ที่แต่ละ route group เลือกใช้
+type CorsPolicy string
+
+const (
+	CorsPublic  CorsPolicy = "public"  // storefront
+	CorsAdmin   CorsPolicy = "admin"   // admin dashboard เท่านั้น
+	CorsCatalog CorsPolicy = "catalog" // GET/HEAD ใช้ public ส่วน method อื่นใช้ admin
+)
+
+// RateLimitKey บอกว่าจะนับจำนวน request แยกตามอะไร
+type RateLimitKey string
+
+const (
+	RateLimitByIp     RateLimitKey = "ip"
+	RateLimitByUser   RateLimitKey = "user"    // ต้องมาหลัง JwtAuth ถ้าไม่มี userId จะใช้ ip แทน
+	RateLimitByApiKey RateLimitKey = "api_key" // header X-API-Key ถ้าไม่มีจะใช้ ip แทน
+)
+
+// RateLimitPolicy ให้ได้ไม่เกิน Limit request ต่อ Window ต่อ key
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	KeyBy  RateLimitKey
+}
@@ -1,11 +1,59 @@
 package order
 
-import "github.com/deeptech-kmitl/Cicero-Backend/modules/users"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/users"
+)
+
+// สถานะของ order
+const (
+	StatusPending   = "pending"
+	StatusShipped   = "shipped"
+	StatusCancelled = "cancelled"
+	StatusReturned  = "returned"
+)
+
+// statusMovements สถานะที่เปลี่ยนได้ กับการเคลื่อนไหวของ stock ที่เกิดขึ้น
+var statusMovements = map[string]map[string]string{
+	StatusPending: {
+		StatusShipped:   inventory.MovementSale,
+		StatusCancelled: inventory.MovementRelease,
+	},
+	StatusShipped: {
+		StatusReturned: inventory.MovementReturn,
+	},
+}
+
+// StatusMovement ชนิดของ movement เมื่อเปลี่ยนสถานะจาก from เป็น to
+func StatusMovement(from, to string) (string, error) {
+	movement, ok := statusMovements[strings.ToLower(from)][to]
+	if !ok {
+		return "", fmt.Errorf("cannot change order status from %s to %s", from, to)
+	}
+	return movement, nil
+}
 
 type OrderProducts struct {
 	Products []*users.Cart
 }
 
+// Items รายการสินค้าใน order สำหรับตัด stock
+func (p *OrderProducts) Items() []*inventory.OrderItem {
+	items := make([]*inventory.OrderItem, 0, len(p.Products))
+	for _, c := range p.Products {
+		items = append(items, &inventory.OrderItem{
+			VariantId: c.VariantId,
+			Sku:       c.Sku,
+			Qty:       c.Qty,
+		})
+	}
+	return items
+}
+
 type AddOrderReq struct {
 	UserId        string         `json:"user_id" form:"user_id" db:"user_id"`
 	Total         float64        `json:"total" form:"total" db:"total"`
@@ -50,3 +98,39 @@ type GetOneOrderById struct {
 	PaymentDetail *PaymentDetail `json:"payment_detail" form:"payment_detail" db:"payment_detail"`
 	CreatedAt     string         `json:"created_at" form:"created_at" db:"created_at"`
 }
+
+// OrderFilter รายการ order ทั้งหมดสำหรับ admin order_by: newest, total, id
+type OrderFilter struct {
+	UserId string `json:"user_id" query:"user_id"`
+	Status string `json:"status" query:"status"`
+	*entities.PaginationReq
+	*entities.SortReq
+}
+
+type OrderSummary struct {
+	Id        string         `json:"id" db:"id"`
+	UserId    string         `json:"user_id" db:"user_id"`
+	Total     float64        `json:"total" db:"total"`
+	Status    string         `json:"status" db:"status"`
+	Products  *OrderProducts `json:"products"`
+	CreatedAt string         `json:"created_at" db:"created_at"`
+}
+
+// UpdateStatusReq admin เปลี่ยนสถานะ order stock เปลี่ยนตามสถานะ
+type UpdateStatusReq struct {
+	OrderId string `json:"-" form:"-"`
+	Status  string `json:"status" form:"status"`
+	UserId  string `json:"-" form:"-"`
+}
+
+func (r *UpdateStatusReq) Validate() error {
+	r.Status = strings.ToLower(strings.TrimSpace(r.Status))
+	switch r.Status {
+	case StatusPending, StatusShipped, StatusCancelled, StatusReturned:
+		return nil
+	case "":
+		return fmt.Errorf("status is required")
+	default:
+		return fmt.Errorf("invalid status %q", r.Status)
+	}
+}
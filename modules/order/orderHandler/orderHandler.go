@@ -15,12 +15,16 @@ const (
 	addOrderErr         orderHandlerErrCode = "order-001"
 	getOrderByUserIdErr orderHandlerErrCode = "order-002"
 	getOneOrderByIdErr  orderHandlerErrCode = "order-003"
+	findOrdersErr       orderHandlerErrCode = "order-004"
+	updateStatusErr     orderHandlerErrCode = "order-005"
 )
 
 type IOrderHandler interface {
 	AddOrder(c *fiber.Ctx) error
 	GetOrderByUserId(c *fiber.Ctx) error
 	GetOneOrderById(c *fiber.Ctx) error
+	FindOrders(c *fiber.Ctx) error
+	UpdateStatus(c *fiber.Ctx) error
 }
 
 type orderHandler struct {
@@ -80,3 +84,60 @@ func (h *orderHandler) GetOneOrderById(c *fiber.Ctx) error {
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, order).Res()
 }
+
+func (h *orderHandler) FindOrders(c *fiber.Ctx) error {
+	req := &order.OrderFilter{
+		PaginationReq: &entities.PaginationReq{},
+		SortReq:       &entities.SortReq{},
+	}
+
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findOrdersErr),
+			err.Error(),
+		).Res()
+	}
+
+	orders, err := h.orderUsecase.FindOrders(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findOrdersErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, orders).Res()
+}
+
+// UpdateStatus pending -> shipped ตัด stock, pending -> cancelled คืนที่จอง, shipped -> returned รับของคืน
+func (h *orderHandler) UpdateStatus(c *fiber.Ctx) error {
+	req := new(order.UpdateStatusReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateStatusErr),
+			err.Error(),
+		).Res()
+	}
+	req.OrderId = strings.TrimSpace(c.Params("order_id"))
+	req.UserId, _ = c.Locals("userId").(string)
+
+	result, err := h.orderUsecase.UpdateStatus(req)
+	if err != nil {
+		code := fiber.ErrBadRequest.Code
+		switch {
+		case err.Error() == "order not found":
+			code = fiber.ErrNotFound.Code
+		case strings.HasPrefix(err.Error(), "cannot change order status"),
+			strings.HasSuffix(err.Error(), "not enough stock available"):
+			code = fiber.ErrConflict.Code
+		}
+		return entities.NewResponse(c).Error(
+			code,
+			string(updateStatusErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
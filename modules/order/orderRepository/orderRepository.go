@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/order"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -14,6 +19,9 @@ type IOrderRepository interface {
 	AddOrder(req *order.AddOrderReq, products *order.OrderProducts) (string, error)
 	GetOrderByUserId(userId string) []*order.GetOrderByUserId
 	GetOneOrderById(orderId string) (*order.GetOneOrderById, error)
+	FindOrders(req *order.OrderFilter) ([]*order.OrderSummary, *entities.Cursors, error)
+	CountOrders(req *order.OrderFilter) int
+	UpdateStatus(req *order.UpdateStatusReq) (*order.GetOneOrderById, error)
 }
 
 type orderRepository struct {
@@ -53,6 +61,12 @@ func (r *orderRepository) AddOrder(req *order.AddOrderReq, products *order.Order
 		return "", fmt.Errorf("add order: %v", err)
 	}
 
+	// จอง stock ของสินค้าใน order ตัดจริงตอนส่งของ
+	if err := inventoryRepository.ReserveOrder(ctx, tx, orderId, req.UserId, products.Items()); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
 	//delete all products in cart by user_id
 	query = `
 	DELETE FROM "Cart"
@@ -138,3 +152,148 @@ func (r *orderRepository) GetOneOrderById(orderId string) (*order.GetOneOrderByI
 
 	return orderData, nil
 }
+
+// sort key ของรายการ order
+var orderSortKeys = map[string]*entities.KeysetColumn{
+	"id":     {Expr: `"o"."id"`, Cast: "VARCHAR"},
+	"newest": {Expr: `"o"."created_at"`, Cast: "TIMESTAMP"},
+	"total":  {Expr: `"o"."total"`, Cast: "FLOAT"},
+}
+
+func orderWhere(b *sqlbuilder.Builder, req *order.OrderFilter) {
+	if req.UserId != "" {
+		b.Where(`"o"."user_id" = ?`, req.UserId)
+	}
+	if req.Status != "" {
+		b.Where(`LOWER("o"."status") = ?`, strings.ToLower(req.Status))
+	}
+}
+
+func (r *orderRepository) FindOrders(req *order.OrderFilter) ([]*order.OrderSummary, *entities.Cursors, error) {
+	keyset, err := entities.SortKeyset("order", orderSortKeys, req.OrderBy, strings.ToUpper(req.Sort) == "DESC", req.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := sqlbuilder.New()
+	orderWhere(b, req)
+	b.WhereExpr(keyset.Condition(b))
+
+	query := fmt.Sprintf(`
+	SELECT
+		COALESCE(array_to_json(array_agg("t")), '[]'::json)
+	FROM (
+		SELECT
+			"o"."id",
+			"o"."user_id",
+			"o"."total",
+			"o"."status",
+			"o"."products",
+			"o"."created_at",
+			%s AS "cursor_values"
+		FROM "Order" "o"
+		WHERE 1 = 1%s
+		ORDER BY %s%s
+	) AS "t";`, keyset.Select(), b.Conditions(), keyset.OrderBy(), keyset.Limit(b, req.Page, req.Limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bytes := make([]byte, 0)
+	if err := r.db.GetContext(ctx, &bytes, query, b.Args()...); err != nil {
+		return nil, nil, fmt.Errorf("find orders failed: %v", err)
+	}
+
+	rows := make([]*orderRow, 0)
+	if err := json.Unmarshal(bytes, &rows); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal orders failed: %v", err)
+	}
+
+	rows, cursors := entities.KeysetPage(keyset, rows, req.Limit, (req.Page-1)*req.Limit, func(r *orderRow) []string {
+		return r.CursorValues
+	})
+
+	orders := make([]*order.OrderSummary, 0, len(rows))
+	for _, r := range rows {
+		orders = append(orders, &r.OrderSummary)
+	}
+	return orders, cursors, nil
+}
+
+// orderRow order หนึ่งแถวพร้อมค่าของ sort key สำหรับสร้าง cursor
+type orderRow struct {
+	order.OrderSummary
+	CursorValues []string `json:"cursor_values"`
+}
+
+func (r *orderRepository) CountOrders(req *order.OrderFilter) int {
+	b := sqlbuilder.New()
+	orderWhere(b, req)
+
+	query := `
+	SELECT
+		COUNT(*)
+	FROM "Order" "o"
+	WHERE 1 = 1` + b.Conditions() + `;`
+
+	var count int
+	if err := r.db.Get(&count, query, b.Args()...); err != nil {
+		log.Printf("count orders failed: %v\n", err)
+		return 0
+	}
+	return count
+}
+
+// UpdateStatus เปลี่ยนสถานะ order และบันทึกการเคลื่อนไหวของ stock ใน transaction เดียวกัน
+// lock order ไว้ไม่ให้การเปลี่ยนสถานะพร้อมกันตัด stock ซ้ำ
+func (r *orderRepository) UpdateStatus(req *order.UpdateStatusReq) (*order.GetOneOrderById, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction update order status failed: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT
+		"status",
+		"products"
+	FROM "Order"
+	WHERE "id" = $1
+	FOR UPDATE;`
+
+	var status string
+	productsBytes := make([]byte, 0)
+	if err := tx.QueryRowxContext(ctx, query, req.OrderId).Scan(&status, &productsBytes); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return nil, fmt.Errorf("order not found")
+		default:
+			return nil, fmt.Errorf("get order failed: %v", err)
+		}
+	}
+
+	movement, err := order.StatusMovement(status, req.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	products := new(order.OrderProducts)
+	if err := json.Unmarshal(productsBytes, products); err != nil {
+		return nil, fmt.Errorf("unmarshal order products failed: %v", err)
+	}
+	if err := inventoryRepository.SettleOrder(ctx, tx, req.OrderId, req.UserId, movement, products.Items()); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE "Order" SET "status" = $1 WHERE "id" = $2;`, req.Status, req.OrderId); err != nil {
+		return nil, fmt.Errorf("update order status failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit update order status failed: %v", err)
+	}
+	return r.GetOneOrderById(req.OrderId)
+}
@@ -2,8 +2,10 @@ package orderUsecase
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/order"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/order/orderRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users/usersRepositories"
@@ -14,6 +16,8 @@ type IOrderUsecase interface {
 	AddOrder(req *order.AddOrderReq) (string, error)
 	GetOrderByUserId(userId string) []*order.GetOrderByUserId
 	GetOneOrderById(orderId string) (*order.GetOneOrderById, error)
+	FindOrders(req *order.OrderFilter) (*entities.PaginateRes, error)
+	UpdateStatus(req *order.UpdateStatusReq) (*order.GetOneOrderById, error)
 }
 
 type orderUsecase struct {
@@ -39,8 +43,14 @@ func (u *orderUsecase) AddOrder(req *order.AddOrderReq) (string, error) {
 		return "", fmt.Errorf("cart is empty")
 
 	}
+	// สินค้าที่เลิกขายหรือถูกซ่อนหลังใส่ตะกร้ายังอยู่ในตะกร้า แต่สั่งซื้อไม่ได้
+	for _, p := range productsOrder {
+		if !p.Available {
+			return "", fmt.Errorf("%s (%s) is no longer available, please remove it from cart", p.ProductTitle, p.Sku)
+		}
+	}
 
-	req.Status = "pending"
+	req.Status = order.StatusPending
 
 	orders := &order.OrderProducts{
 		Products: productsOrder,
@@ -61,3 +71,47 @@ func (u *orderUsecase) GetOrderByUserId(userId string) []*order.GetOrderByUserId
 func (u *orderUsecase) GetOneOrderById(orderId string) (*order.GetOneOrderById, error) {
 	return u.orderRepo.GetOneOrderById(orderId)
 }
+
+func (u *orderUsecase) FindOrders(req *order.OrderFilter) (*entities.PaginateRes, error) {
+	if req.Page < 1 || req.Cursor != "" {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	if req.OrderBy == "" {
+		req.OrderBy = "newest"
+	}
+	if req.Sort == "" {
+		req.Sort = "DESC"
+	}
+
+	orders, cursors, err := u.orderRepo.FindOrders(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entities.PaginateRes{
+		Data:       orders,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		NextCursor: cursors.Next,
+		PrevCursor: cursors.Prev,
+	}
+	if req.Cursor != "" {
+		// หน้าแบบ cursor ไม่มีเลขหน้า
+		res.Page = 0
+	}
+	if req.CountTotal() {
+		res.TotalItem = u.orderRepo.CountOrders(req)
+		res.TotalPage = int(math.Ceil(float64(res.TotalItem) / float64(req.Limit)))
+	}
+	return res, nil
+}
+
+func (u *orderUsecase) UpdateStatus(req *order.UpdateStatusReq) (*order.GetOneOrderById, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.orderRepo.UpdateStatus(req)
+}
@@ -0,0 +1,535 @@
+package product
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// รูปแบบไฟล์ที่ import และ export ได้
+const (
+	FormatCsv    = "csv"
+	FormatJson   = "json"   // import เท่านั้น เป็น array ของ ImportProduct
+	FormatNdjson = "ndjson" // ImportProduct หนึ่งตัวต่อบรรทัด
+)
+
+// CsvColumns คอลัมน์ของไฟล์ CSV หนึ่งแถวต่อหนึ่ง variant
+// แถวของสินค้าเดียวกันใช้ product_title เดียวกัน คอลัมน์ของสินค้าในแถวถัดไปเว้นว่างได้
+// product_id มีแค่ตอน export ตอน import ไม่ใช้ images คั่นหลาย url ด้วย |
+var CsvColumns = []string{
+	"product_id",
+	"product_title",
+	"product_desc",
+	"product_price",
+	"product_sex",
+	"product_category",
+	"status",
+	"images",
+	"sku",
+	"size",
+	"color",
+	"stock",
+	"price_override",
+}
+
+const imageSeparator = "|"
+
+// ImportProduct สินค้าหนึ่งตัวในไฟล์ import และหนึ่งบรรทัดของ NDJSON ที่ export
+// upsert ตาม sku ของ variant ก่อน ถ้าไม่มี sku ที่มีอยู่แล้วใช้ชื่อสินค้า
+type ImportProduct struct {
+	Id              string           `json:"id,omitempty"` // มีแค่ตอน export
+	ProductTitle    string           `json:"product_title"`
+	ProductDesc     string           `json:"product_desc"`
+	ProductPrice    float64          `json:"product_price"`
+	ProductSex      string           `json:"product_sex"`
+	ProductCategory string           `json:"product_category"` // id, slug หรือชื่อของหมวด
+	Status          string           `json:"status,omitempty"` // ว่าง = published สำหรับสินค้าใหม่ สินค้าเดิมไม่เปลี่ยน
+	Images          []string         `json:"images"`
+	Variants        []*ImportVariant `json:"variants"`
+	Row             int              `json:"-"`
+	Action          string           `json:"-"` // created หรือ updated หลัง import
+	Result          *ImportRowResult `json:"-"` // ใช้เมื่อสินค้าไม่มี variant
+}
+
+type ImportVariant struct {
+	VariantReq
+	Result *ImportRowResult `json:"-"`
+}
+
+// Fail บันทึก error ของข้อมูลระดับสินค้าไว้ที่แถวแรกของสินค้า
+func (p *ImportProduct) Fail(format string, a ...any) {
+	if len(p.Variants) > 0 {
+		p.Variants[0].Fail(format, a...)
+		return
+	}
+	p.Result.Errors = append(p.Result.Errors, fmt.Sprintf(format, a...))
+}
+
+func (v *ImportVariant) Fail(format string, a ...any) {
+	v.Result.Errors = append(v.Result.Errors, fmt.Sprintf(format, a...))
+}
+
+// ImportReport ผลของการ import ทีละแถว
+// ถ้ามีแถวที่ผิดแม้แต่แถวเดียวจะไม่มีอะไรถูกบันทึก (Imported = false)
+type ImportReport struct {
+	Format          string             `json:"format"`
+	DryRun          bool               `json:"dry_run"`
+	Imported        bool               `json:"imported"`
+	Products        int                `json:"products"`
+	ProductsCreated int                `json:"products_created"`
+	ProductsUpdated int                `json:"products_updated"`
+	Failed          int                `json:"failed"` // จำนวนแถวที่ผิด
+	Rows            []*ImportRowResult `json:"rows"`
+}
+
+// ImportRowResult ผลของหนึ่งแถว Row คือเลขบรรทัดของ CSV/NDJSON หรือลำดับสินค้าใน JSON (เริ่มที่ 1)
+type ImportRowResult struct {
+	Row          int      `json:"row"`
+	ProductId    string   `json:"product_id,omitempty"`
+	ProductTitle string   `json:"product_title"`
+	Sku          string   `json:"sku,omitempty"`
+	Status       string   `json:"status"` // invalid, valid (dry run), created หรือ updated
+	Errors       []string `json:"errors,omitempty"`
+}
+
+func (r *ImportReport) add(row int, title, sku string) *ImportRowResult {
+	res := &ImportRowResult{
+		Row:          row,
+		ProductTitle: title,
+		Sku:          sku,
+	}
+	r.Rows = append(r.Rows, res)
+	return res
+}
+
+// Tally นับแถวที่ผิดและสินค้าที่สร้าง/แก้ไข แล้วคืนจำนวนแถวที่ผิด
+func (r *ImportReport) Tally(products []*ImportProduct) int {
+	r.Products = len(products)
+	r.Failed, r.ProductsCreated, r.ProductsUpdated = 0, 0, 0
+	for _, row := range r.Rows {
+		if len(row.Errors) > 0 {
+			row.Status = "invalid"
+			r.Failed++
+		}
+	}
+	for _, p := range products {
+		switch p.Action {
+		case "created":
+			r.ProductsCreated++
+		case "updated":
+			r.ProductsUpdated++
+		}
+	}
+	return r.Failed
+}
+
+// ImportRefs ข้อมูลใน database ที่ใช้ตรวจไฟล์ import
+type ImportRefs struct {
+	Categories map[string]bool // ค่าของหมวดในไฟล์ (ตัวพิมพ์เล็ก) ที่หาเจอ
+	SkuOwners  map[string]*ImportSkuOwner
+}
+
+type ImportSkuOwner struct {
+	Sku          string `db:"sku"`
+	ProductId    string `db:"id"`
+	ProductTitle string `db:"product_title"`
+}
+
+// DetectFormat หารูปแบบไฟล์จากนามสกุลหรือ content type ได้ "" ถ้าไม่รู้จัก
+func DetectFormat(filename, contentType string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return FormatCsv
+	case ".json":
+		return FormatJson
+	case ".ndjson", ".jsonl":
+		return FormatNdjson
+	}
+
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return FormatCsv
+	case strings.HasPrefix(contentType, "application/x-ndjson"), strings.HasPrefix(contentType, "application/jsonl"):
+		return FormatNdjson
+	case strings.HasPrefix(contentType, "application/json"):
+		return FormatJson
+	}
+	return ""
+}
+
+// ParseImport อ่านไฟล์ import และสร้าง report ที่มีหนึ่งผลต่อแถว
+// error คือไฟล์ที่อ่านไม่ได้ทั้งไฟล์ ส่วนค่าที่ผิดในแต่ละแถวอยู่ใน report
+func ParseImport(r io.Reader, format string) ([]*ImportProduct, *ImportReport, error) {
+	report := &ImportReport{
+		Format: format,
+		Rows:   make([]*ImportRowResult, 0),
+	}
+
+	var (
+		products []*ImportProduct
+		err      error
+	)
+	switch format {
+	case FormatCsv:
+		products, err = parseCsv(r, report)
+	case FormatJson:
+		products, err = parseJson(r, report)
+	case FormatNdjson:
+		products, err = parseNdjson(r, report)
+	default:
+		return nil, nil, fmt.Errorf("format must be csv, json or ndjson")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(products) == 0 {
+		return nil, nil, fmt.Errorf("import file has no rows")
+	}
+	return products, report, nil
+}
+
+func parseCsv(r io.Reader, report *ImportReport) ([]*ImportProduct, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header failed: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	for _, name := range []string{"product_title", "size", "color"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv column %s is required", name)
+		}
+	}
+
+	products := make([]*ImportProduct, 0)
+	byTitle := make(map[string]*ImportProduct)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv failed: %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		row := &ImportProduct{
+			Row:             line,
+			ProductTitle:    get("product_title"),
+			ProductDesc:     get("product_desc"),
+			ProductSex:      get("product_sex"),
+			ProductCategory: get("product_category"),
+			Status:          get("status"),
+			Images:          splitImages(get("images")),
+		}
+		v := &ImportVariant{
+			VariantReq: VariantReq{
+				Sku:   get("sku"),
+				Size:  get("size"),
+				Color: get("color"),
+			},
+		}
+		v.Result = report.add(line, row.ProductTitle, v.Sku)
+		row.Variants = []*ImportVariant{v}
+
+		if s := get("product_price"); s != "" {
+			if row.ProductPrice, err = strconv.ParseFloat(s, 64); err != nil {
+				v.Fail("product_price %q is not a number", s)
+			}
+		}
+		if s := get("stock"); s != "" {
+			if v.Stock, err = strconv.Atoi(s); err != nil {
+				v.Fail("stock %q is not an integer", s)
+			}
+		}
+		if s := get("price_override"); s != "" {
+			price, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				v.Fail("price_override %q is not a number", s)
+			}
+			v.PriceOverride = &price
+		}
+
+		key := strings.ToLower(row.ProductTitle)
+		p, ok := byTitle[key]
+		if !ok || key == "" {
+			products = append(products, row)
+			byTitle[key] = row
+			continue
+		}
+		mergeCsvRow(p, row, v)
+	}
+	return products, nil
+}
+
+// mergeCsvRow รวมแถวเข้ากับสินค้าชื่อเดียวกันที่เจอก่อนหน้า
+// คอลัมน์ของสินค้าที่ว่างใช้ค่าจากแถวแรก ถ้าใส่ต้องตรงกับแถวแรก
+func mergeCsvRow(p, row *ImportProduct, v *ImportVariant) {
+	if p.ProductDesc == "" {
+		p.ProductDesc = row.ProductDesc
+	}
+	conflicts := make([]string, 0)
+	if row.ProductDesc != "" && row.ProductDesc != p.ProductDesc {
+		conflicts = append(conflicts, "product_desc")
+	}
+	if row.ProductPrice != 0 && row.ProductPrice != p.ProductPrice {
+		conflicts = append(conflicts, "product_price")
+	}
+	if row.ProductSex != "" && !strings.EqualFold(row.ProductSex, p.ProductSex) {
+		conflicts = append(conflicts, "product_sex")
+	}
+	if row.ProductCategory != "" && !strings.EqualFold(row.ProductCategory, p.ProductCategory) {
+		conflicts = append(conflicts, "product_category")
+	}
+	if row.Status != "" && !strings.EqualFold(row.Status, p.Status) {
+		conflicts = append(conflicts, "status")
+	}
+	if len(conflicts) > 0 {
+		v.Fail("%s differ from row %d of the same product", strings.Join(conflicts, ", "), p.Row)
+	}
+
+	for _, img := range row.Images {
+		if !slices.Contains(p.Images, img) {
+			p.Images = append(p.Images, img)
+		}
+	}
+	p.Variants = append(p.Variants, v)
+}
+
+func parseJson(r io.Reader, report *ImportReport) ([]*ImportProduct, error) {
+	products := make([]*ImportProduct, 0)
+	if err := json.NewDecoder(r).Decode(&products); err != nil {
+		return nil, fmt.Errorf("decode json failed: %v", err)
+	}
+	for i, p := range products {
+		if p == nil {
+			p = new(ImportProduct)
+			products[i] = p
+		}
+		p.Row = i + 1
+		addResults(p, report)
+	}
+	return products, nil
+}
+
+func parseNdjson(r io.Reader, report *ImportReport) ([]*ImportProduct, error) {
+	products := make([]*ImportProduct, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var line int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		p := new(ImportProduct)
+		if err := json.Unmarshal([]byte(text), p); err != nil {
+			p = &ImportProduct{Row: line}
+			p.Result = report.add(line, "", "")
+			p.Fail("invalid json: %v", err)
+			products = append(products, p)
+			continue
+		}
+		p.Row = line
+		addResults(p, report)
+		products = append(products, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ndjson failed: %v", err)
+	}
+	return products, nil
+}
+
+// addResults สร้างผลหนึ่งแถวต่อ variant (หรือหนึ่งแถวถ้าไม่มี variant) ทุก variant ใช้เลขแถวของสินค้า
+func addResults(p *ImportProduct, report *ImportReport) {
+	variants := make([]*ImportVariant, 0, len(p.Variants))
+	for _, v := range p.Variants {
+		if v != nil {
+			variants = append(variants, v)
+		}
+	}
+	p.Variants = variants
+
+	if len(p.Variants) == 0 {
+		p.Result = report.add(p.Row, p.ProductTitle, "")
+		return
+	}
+	for _, v := range p.Variants {
+		v.Result = report.add(p.Row, p.ProductTitle, v.Sku)
+	}
+}
+
+// ValidateImport ตรวจทุกแถวโดยไม่แตะ database และบันทึก error ลงผลของแถว
+// ข้อที่ต้องใช้ database (หมวดและเจ้าของ sku) ตรวจที่ usecase
+func ValidateImport(products []*ImportProduct) {
+	titles := make(map[string]int)
+	skus := make(map[string]int)
+
+	for _, p := range products {
+		if len(p.Variants) == 0 && len(p.Result.Errors) > 0 {
+			// บรรทัด NDJSON ที่อ่านไม่ได้
+			continue
+		}
+		p.ProductTitle = strings.TrimSpace(p.ProductTitle)
+		p.ProductDesc = strings.TrimSpace(p.ProductDesc)
+		p.ProductSex = strings.TrimSpace(p.ProductSex)
+		p.ProductCategory = strings.TrimSpace(p.ProductCategory)
+
+		if p.ProductTitle == "" {
+			p.Fail("product_title is required")
+		} else if row, ok := titles[strings.ToLower(p.ProductTitle)]; ok {
+			p.Fail("duplicate product_title of row %d", row)
+		} else {
+			titles[strings.ToLower(p.ProductTitle)] = p.Row
+		}
+		if p.ProductPrice <= 0 {
+			p.Fail("product_price must be greater than 0")
+		}
+		if p.ProductSex == "" {
+			p.Fail("product_sex is required")
+		}
+		if p.ProductCategory == "" {
+			p.Fail("product_category is required")
+		}
+		if p.Status = strings.ToLower(strings.TrimSpace(p.Status)); p.Status != "" {
+			if p.Status != StatusDraft && p.Status != StatusPublished && p.Status != StatusArchived {
+				p.Fail("status must be draft, published or archived")
+			}
+		}
+		for _, img := range p.Images {
+			if u, err := url.Parse(img); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				p.Fail("image %q must be an http(s) url", img)
+			}
+		}
+
+		if len(p.Variants) == 0 {
+			p.Fail("variants is required")
+			continue
+		}
+		sizes := make(map[string]bool)
+		for _, v := range p.Variants {
+			if err := v.Validate(); err != nil {
+				v.Fail("%v", err)
+			}
+			v.Result.Sku = v.Sku
+
+			key := strings.ToLower(v.Size + "\x00" + v.Color)
+			if sizes[key] {
+				v.Fail("duplicate variant %s/%s", v.Size, v.Color)
+			}
+			sizes[key] = true
+
+			if v.Sku == "" {
+				continue
+			}
+			if row, ok := skus[v.Sku]; ok {
+				v.Fail("duplicate sku of row %d", row)
+			} else {
+				skus[v.Sku] = v.Result.Row
+			}
+		}
+	}
+}
+
+// IExportWriter เขียนสินค้าทีละตัวลงไฟล์ export
+type IExportWriter interface {
+	Write(p *ImportProduct) error
+	Flush() error
+}
+
+func NewExportWriter(w io.Writer, format string) (IExportWriter, error) {
+	switch format {
+	case FormatCsv:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(CsvColumns); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{cw}, nil
+	case FormatNdjson:
+		return &ndjsonExportWriter{json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("export format must be csv or ndjson")
+	}
+}
+
+// csvExportWriter หนึ่งแถวต่อ variant ใส่คอลัมน์ของสินค้าทุกแถว ใช้ import กลับได้ทันที
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) Write(p *ImportProduct) error {
+	for _, v := range p.Variants {
+		var priceOverride string
+		if v.PriceOverride != nil {
+			priceOverride = strconv.FormatFloat(*v.PriceOverride, 'f', -1, 64)
+		}
+		if err := e.w.Write([]string{
+			p.Id,
+			p.ProductTitle,
+			p.ProductDesc,
+			strconv.FormatFloat(p.ProductPrice, 'f', -1, 64),
+			p.ProductSex,
+			p.ProductCategory,
+			p.Status,
+			strings.Join(p.Images, imageSeparator),
+			v.Sku,
+			v.Size,
+			v.Color,
+			strconv.Itoa(v.Stock),
+			priceOverride,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExportWriter) Write(p *ImportProduct) error { return e.enc.Encode(p) }
+func (e *ndjsonExportWriter) Flush() error                 { return nil }
+
+func splitImages(raw string) []string {
+	images := make([]string, 0)
+	for _, img := range strings.Split(raw, imageSeparator) {
+		if img = strings.TrimSpace(img); img != "" && !slices.Contains(images, img) {
+			images = append(images, img)
+		}
+	}
+	return images
+}
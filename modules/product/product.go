@@ -1,6 +1,12 @@
 package product
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
 )
@@ -9,13 +15,16 @@ type GetAllProduct struct {
 	Id              string               `db:"id" json:"id" form:"id"`
 	ProductTitle    string               `db:"product_title" json:"product_title" form:"product_title"`
 	ProductPrice    float64              `db:"product_price" json:"product_price" form:"product_price"`
-	ProductColor    string               `db:"product_color" json:"product_color" form:"product_color"`
-	ProductSize     []*string            `db:"product_size" json:"product_size" form:"product_size"`
 	ProductSex      string               `db:"product_sex" json:"product_sex" form:"product_sex"`
 	ProductDesc     string               `db:"product_desc" json:"product_desc" form:"product_desc"`
-	ProductCategory string               `db:"product_category" json:"product_category" form:"product_category"`
-	ProductStock    int                  `db:"product_stock" json:"product_stock" form:"product_stock"`
+	CategoryId      int                  `db:"category_id" json:"category_id" form:"category_id"`
+	ProductCategory string               `db:"product_category" json:"product_category" form:"product_category"` // ชื่อหมวด
+	ProductStock    int                  `db:"product_stock" json:"product_stock" form:"product_stock"`          // stock รวมทุก variant
+	Status          string               `db:"status" json:"status" form:"status"`
+	PublishAt       *string              `db:"publish_at" json:"publish_at" form:"publish_at"`
+	UnpublishAt     *string              `db:"unpublish_at" json:"unpublish_at" form:"unpublish_at"`
 	Images          []*entities.ImageRes `json:"images" form:"images"`
+	Variants        []*Variant           `json:"variants" form:"variants"`
 	CreatedAt       string               `db:"created_at" json:"created_at" form:"created_at"`
 }
 
@@ -23,44 +32,226 @@ type Product struct {
 	Id              string               `db:"id" json:"id" form:"id"`
 	ProductTitle    string               `db:"product_title" json:"product_title" form:"product_title"`
 	ProductPrice    float64              `db:"product_price" json:"product_price" form:"product_price"`
-	ProductColor    string               `db:"product_color" json:"product_color" form:"product_color"`
-	ProductSize     string               `db:"product_size" json:"product_size" form:"product_size"`
 	ProductSex      string               `db:"product_sex" json:"product_sex" form:"product_sex"`
 	ProductDesc     string               `db:"product_desc" json:"product_desc" form:"product_desc"`
-	ProductCategory string               `db:"product_category" json:"product_category" form:"product_category"`
-	ProductStock    int                  `db:"product_stock" json:"product_stock" form:"product_stock"`
+	CategoryId      int                  `db:"category_id" json:"category_id" form:"category_id"`
+	ProductCategory string               `db:"product_category" json:"product_category" form:"product_category"` // ชื่อหมวด
+	ProductStock    int                  `db:"product_stock" json:"product_stock" form:"product_stock"`          // stock รวมทุก variant
+	Status          string               `db:"status" json:"status" form:"status"`
+	PublishAt       *string              `db:"publish_at" json:"publish_at" form:"publish_at"`
+	UnpublishAt     *string              `db:"unpublish_at" json:"unpublish_at" form:"unpublish_at"`
 	Images          []*entities.ImageRes `json:"images" form:"images"`
+	Variants        []*Variant           `json:"variants" form:"variants"`
+	Version         int                  `db:"version" json:"version,omitempty"` // ส่งเป็น ETag ใช้กับ If-Match
+}
+
+// Variant คือสินค้าแต่ละ size/สี ที่มี sku และ stock ของตัวเอง
+// Price คือราคาที่ขายจริง (PriceOverride ถ้ามี ไม่งั้นราคาของสินค้า)
+type Variant struct {
+	Id            string   `db:"id" json:"id"`
+	ProductId     string   `db:"product_id" json:"product_id"`
+	Sku           string   `db:"sku" json:"sku"`
+	Size          string   `db:"size" json:"size"`
+	Color         string   `db:"color" json:"color"`
+	Stock         int      `db:"stock" json:"stock"`
+	Price         float64  `db:"price" json:"price"`
+	PriceOverride *float64 `db:"price_override" json:"price_override"`
+}
+
+type VariantReq struct {
+	Id            string   `json:"-"`
+	ProductId     string   `json:"-"`
+	Sku           string   `json:"sku"` // ว่างได้ตอนสร้าง จะสร้างจาก product id, size และสี
+	Size          string   `json:"size"`
+	Color         string   `json:"color"`
+	Stock         int      `json:"stock"`
+	PriceOverride *float64 `json:"price_override"`
+	ActorId       string   `json:"-"`
+}
+
+func (v *VariantReq) Validate() error {
+	v.Sku = strings.TrimSpace(v.Sku)
+	v.Size = strings.TrimSpace(v.Size)
+	v.Color = strings.TrimSpace(v.Color)
+
+	if v.Size == "" {
+		return fmt.Errorf("variant size is required")
+	}
+	if v.Color == "" {
+		return fmt.Errorf("variant color is required")
+	}
+	if v.Stock < 0 {
+		return fmt.Errorf("variant stock must be greater than 0")
+	}
+	if v.PriceOverride != nil && *v.PriceOverride < 0 {
+		return fmt.Errorf("variant price must be greater than 0")
+	}
+	return nil
+}
+
+var skuInvalidRe = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// DefaultSku สร้าง sku จาก product id, size และสี เช่น P000001-XL-NAVY-BLUE
+func DefaultSku(productId, size, color string) string {
+	parts := []string{productId, size, color}
+	for i := range parts {
+		parts[i] = strings.Trim(skuInvalidRe.ReplaceAllString(strings.ToUpper(parts[i]), "-"), "-")
+	}
+	return strings.Join(parts, "-")
 }
 
 type AddProduct struct {
-	Id              string           `db:"id" json:"id" form:"id"`
-	ProductTitle    string           `db:"product_title" json:"product_title" form:"product_title"`
-	ProductPrice    float64          `db:"product_price" json:"product_price" form:"product_price"`
-	ProductColor    string           `db:"product_color" json:"product_color" form:"product_color"`
-	ProductSize     string           `db:"product_size" json:"product_size" form:"product_size"`
-	ProductSex      string           `db:"product_sex" json:"product_sex" form:"product_sex"`
-	ProductDesc     string           `db:"product_desc" json:"product_desc" form:"product_desc"`
-	ProductCategory string           `db:"product_category" json:"product_category" form:"product_category"`
-	ProductStock    int              `db:"product_stock" json:"product_stock" form:"product_stock"`
-	Images          []*files.FileRes `json:"images" form:"images"`
+	Id              string            `db:"id" json:"id" form:"id"`
+	ProductTitle    string            `db:"product_title" json:"product_title" form:"product_title"`
+	ProductPrice    float64           `db:"product_price" json:"product_price" form:"product_price"`
+	ProductSex      string            `db:"product_sex" json:"product_sex" form:"product_sex"`
+	ProductDesc     string            `db:"product_desc" json:"product_desc" form:"product_desc"`
+	ProductCategory string            `db:"product_category" json:"product_category" form:"product_category"` // id, slug หรือชื่อของหมวด
+	Images          []*files.FileRes  `json:"images" form:"images"`
+	Variants        []*VariantReq     `json:"variants" form:"variants"`
+	Status          *ProductStatusReq `json:"-" form:"-"`
+	ActorId         string            `json:"-" form:"-"` // user ที่แก้ไข บันทึกลงประวัติ
+	UploadIds       []string          `json:"-" form:"-"` // upload ที่อยู่ใน Images ถูก mark attached ตอน insert สำเร็จ
+}
+
+// สถานะของสินค้า
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// VisibleQuery เงื่อนไขว่าสินค้า alias แสดงหน้าร้านได้ คือ published และอยู่ในช่วง publish_at ถึง unpublish_at
+// เวลาเก็บเป็น UTC จึงเทียบกับ now() ใน UTC
+func VisibleQuery(alias string) string {
+	return fmt.Sprintf(`(%[1]s."status" = 'published'
+		AND (%[1]s."publish_at" IS NULL OR %[1]s."publish_at" <= (now() AT TIME ZONE 'UTC'))
+		AND (%[1]s."unpublish_at" IS NULL OR %[1]s."unpublish_at" > (now() AT TIME ZONE 'UTC')))`, alias)
+}
+
+// StatusColumns คอลัมน์สถานะของสินค้า alias สำหรับ SELECT เวลาเป็น RFC3339 ใน UTC
+func StatusColumns(alias string) string {
+	return fmt.Sprintf(`%[1]s."status",
+			to_char(%[1]s."publish_at", 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS "publish_at",
+			to_char(%[1]s."unpublish_at", 'YYYY-MM-DD"T"HH24:MI:SS"Z"') AS "unpublish_at"`, alias)
+}
+
+// ProductStatusReq เปลี่ยนสถานะและกำหนดเวลาขึ้น/ลงหน้าร้าน
+// publish_at และ unpublish_at เป็น RFC3339 ว่าง = ไม่จำกัด
+type ProductStatusReq struct {
+	Id            string                 `json:"-"`
+	Status        string                 `json:"status" form:"status"`
+	PublishAt     string                 `json:"publish_at" form:"publish_at"`
+	UnpublishAt   string                 `json:"unpublish_at" form:"unpublish_at"`
+	PublishTime   *time.Time             `json:"-"`
+	UnpublishTime *time.Time             `json:"-"`
+	ActorId       string                 `json:"-"`
+	IfMatch       *entities.Precondition `json:"-"`
+}
+
+func (r *ProductStatusReq) Validate() error {
+	r.Status = strings.ToLower(strings.TrimSpace(r.Status))
+	switch r.Status {
+	case StatusDraft, StatusPublished, StatusArchived:
+	default:
+		return fmt.Errorf("status must be draft, published or archived")
+	}
+
+	var err error
+	if r.PublishTime, err = parseSchedule(r.PublishAt); err != nil {
+		return fmt.Errorf("invalid publish_at: %v", err)
+	}
+	if r.UnpublishTime, err = parseSchedule(r.UnpublishAt); err != nil {
+		return fmt.Errorf("invalid unpublish_at: %v", err)
+	}
+	if r.PublishTime != nil && r.UnpublishTime != nil && !r.UnpublishTime.After(*r.PublishTime) {
+		return fmt.Errorf("unpublish_at must be after publish_at")
+	}
+	return nil
+}
+
+// parseSchedule แปลงเวลา RFC3339 เป็น UTC ค่าว่างได้ nil
+func parseSchedule(s string) (*time.Time, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
 }
 
 type ProductFilter struct {
-	Id     string `json:"id" query:"id"`
-	Search string `json:"search" query:"search"` // search by title and description
+	Id       string  `json:"id" query:"id"`
+	Search   string  `json:"search" query:"search"`       // full-text บนชื่อและรายละเอียด เรียงตาม relevance
+	Category string  `json:"category" query:"category"`   // id หรือ slug ของหมวด รวมหมวดย่อยทั้งหมด
+	Sex      string  `json:"sex" query:"sex"`             // คั่นหลายค่าด้วย comma
+	Color    string  `json:"color" query:"color"`         // คั่นหลายค่าด้วย comma
+	Size     string  `json:"size" query:"size"`           // คั่นหลายค่าด้วย comma
+	MinPrice float64 `json:"min_price" query:"min_price"` // 0 = ไม่จำกัด
+	MaxPrice float64 `json:"max_price" query:"max_price"` // 0 = ไม่จำกัด
+	InStock  bool    `json:"in_stock" query:"in_stock"`
+	Status   string  `json:"status" query:"status"` // admin เท่านั้น
+	// IncludeHidden ไม่ซ่อนสินค้าที่ไม่ได้แสดงหน้าร้าน ตั้งโดย handler เมื่อเป็น admin
+	IncludeHidden bool `json:"-" query:"-"`
 	*entities.PaginationReq
 	*entities.SortReq
 }
 
+// ProductFacets จำนวนสินค้าต่อค่าของแต่ละ filter สำหรับ sidebar
+// แต่ละ facet นับโดยใช้ filter อื่นทั้งหมดยกเว้นตัวเอง
+type ProductFacets struct {
+	Category []*FacetCount `json:"category"`
+	Sex      []*FacetCount `json:"sex"`
+	Color    []*FacetCount `json:"color"`
+	Size     []*FacetCount `json:"size"`
+	Price    *PriceRange   `json:"price"`
+	InStock  int           `json:"in_stock"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+type PriceRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// IsThai คำค้นมีตัวอักษรไทยหรือไม่ ใช้เลือกวิธีค้นหา
+func IsThai(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Thai, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterValues แยกค่าที่คั่นด้วย comma ตัดช่องว่างและค่าว่างทิ้ง
+func FilterValues(raw string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 type UpdateProduct struct {
-	Id              string           `db:"id" json:"id" form:"id"`
-	ProductTitle    string           `db:"product_title" json:"product_title" form:"product_title"`
-	ProductPrice    float64          `db:"product_price" json:"product_price" form:"product_price"`
-	ProductColor    string           `db:"product_color" json:"product_color" form:"product_color"`
-	ProductSize     string           `db:"product_size" json:"product_size" form:"product_size"`
-	ProductSex      string           `db:"product_sex" json:"product_sex" form:"product_sex"`
-	ProductDesc     string           `db:"product_desc" json:"product_desc" form:"product_desc"`
-	ProductCategory string           `db:"product_category" json:"product_category" form:"product_category"`
-	ProductStock    int              `db:"product_stock" json:"product_stock" form:"product_stock"`
-	Images          []*files.FileRes `json:"images" form:"images"`
+	Id              string                 `db:"id" json:"id" form:"id"`
+	ProductTitle    string                 `db:"product_title" json:"product_title" form:"product_title"`
+	ProductPrice    float64                `db:"product_price" json:"product_price" form:"product_price"`
+	ProductSex      string                 `db:"product_sex" json:"product_sex" form:"product_sex"`
+	ProductDesc     string                 `db:"product_desc" json:"product_desc" form:"product_desc"`
+	ProductCategory string                 `db:"product_category" json:"product_category" form:"product_category"` // id, slug หรือชื่อของหมวด
+	Images          []*files.FileRes       `json:"images" form:"images"`
+	ActorId         string                 `json:"-" form:"-"`
+	IfMatch         *entities.Precondition `json:"-" form:"-"`
+	UploadIds       []string               `json:"-" form:"-"` // upload ที่อยู่ใน Images ถูก mark attached ตอน update สำเร็จ
 }
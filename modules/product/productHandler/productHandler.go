@@ -1,11 +1,18 @@
 package productHandler
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"path/filepath"
+	"io"
+	"log"
+	"mime/multipart"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
@@ -13,7 +20,6 @@ import (
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productUsecase"
-	"github.com/deeptech-kmitl/Cicero-Backend/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -29,6 +35,15 @@ const (
 	DeleteImageProductErr   productHandlerErrCode = "product-007"
 	InsertImageProductErr   productHandlerErrCode = "product-008"
 	GetAllProductErr        productHandlerErrCode = "product-009"
+	AddVariantErr           productHandlerErrCode = "product-010"
+	UpdateVariantErr        productHandlerErrCode = "product-011"
+	DeleteVariantErr        productHandlerErrCode = "product-012"
+	ImportProductErr        productHandlerErrCode = "product-013"
+	ExportProductErr        productHandlerErrCode = "product-014"
+	UpdateProductStatusErr  productHandlerErrCode = "product-015"
+	FindRevisionsErr        productHandlerErrCode = "product-016"
+	FindRevisionErr         productHandlerErrCode = "product-017"
+	RestoreRevisionErr      productHandlerErrCode = "product-018"
 )
 
 type IProductHandler interface {
@@ -37,8 +52,18 @@ type IProductHandler interface {
 	DeleteProduct(c *fiber.Ctx) error
 	FindProduct(c *fiber.Ctx) error
 	UpdateProduct(c *fiber.Ctx) error
+	UpdateProductStatus(c *fiber.Ctx) error
 	FindImageByProductId(c *fiber.Ctx) error
 	GetAllProduct(c *fiber.Ctx) error
+	AddVariant(c *fiber.Ctx) error
+	UpdateVariant(c *fiber.Ctx) error
+	DeleteVariant(c *fiber.Ctx) error
+	Suggest(c *fiber.Ctx) error
+	ImportProducts(c *fiber.Ctx) error
+	ExportProducts(c *fiber.Ctx) error
+	FindRevisions(c *fiber.Ctx) error
+	FindRevision(c *fiber.Ctx) error
+	RestoreRevision(c *fiber.Ctx) error
 }
 
 type productHandler struct {
@@ -57,7 +82,7 @@ func ProductHandler(productUsecase productUsecase.IProductUsecase, fileUsecase f
 
 func (h *productHandler) FindOneProduct(c *fiber.Ctx) error {
 	prodId := strings.TrimSpace(c.Params("product_id"))
-	result, err := h.productUsecase.FindOneProduct(prodId)
+	result, err := h.productUsecase.FindOneProduct(prodId, isAdmin(c))
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
@@ -65,6 +90,7 @@ func (h *productHandler) FindOneProduct(c *fiber.Ctx) error {
 			err.Error(),
 		).Res()
 	}
+	c.Set(fiber.HeaderETag, entities.ETag(result.Version))
 	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 
 }
@@ -103,22 +129,6 @@ func (h *productHandler) AddProduct(c *fiber.Ctx) error {
 			"product_price is required",
 		).Res()
 	}
-	productColor, exists := form.Value["product_color"]
-	if !exists || len(productColor[0]) == 0 {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(AddProductErr),
-			"product_color is required",
-		).Res()
-	}
-	productSize, exists := form.Value["product_size"]
-	if !exists || len(productSize[0]) == 0 {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(AddProductErr),
-			"product_size is required",
-		).Res()
-	}
 	productSex, exists := form.Value["product_sex"]
 	if !exists || len(productSex[0]) == 0 {
 		return entities.NewResponse(c).Error(
@@ -127,7 +137,11 @@ func (h *productHandler) AddProduct(c *fiber.Ctx) error {
 			"product_sex is required",
 		).Res()
 	}
-	productCategory, exists := form.Value["product_category"]
+	// หมวดส่งมาเป็น category_id หรือ product_category (id, slug หรือชื่อ) ก็ได้
+	productCategory, exists := form.Value["category_id"]
+	if !exists || len(productCategory[0]) == 0 {
+		productCategory, exists = form.Value["product_category"]
+	}
 	if !exists || len(productCategory[0]) == 0 {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
@@ -136,35 +150,36 @@ func (h *productHandler) AddProduct(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	stockValue := 0
-	productStock, exists := form.Value["product_stock"]
-	if !exists || len(productStock[0]) == 0 {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(AddProductErr),
-			"product_stock is required",
-		).Res()
-	}
-	// convert to int and check if it's 0 then stock is 0
-	stock, err := strconv.Atoi(productStock[0])
+	variants, err := variantsFromForm(form)
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
 			string(AddProductErr),
-			"invalid product stock",
+			err.Error(),
 		).Res()
 	}
-	if stock < 0 {
+
+	// สร้างเป็น draft หรือตั้งเวลาขึ้นหน้าร้านได้ ไม่ส่ง status = published
+	status := &product.ProductStatusReq{
+		Status:      formValue(form, "status"),
+		PublishAt:   formValue(form, "publish_at"),
+		UnpublishAt: formValue(form, "unpublish_at"),
+	}
+	if status.Status == "" {
+		status.Status = product.StatusPublished
+	}
+	if err := status.Validate(); err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
 			string(AddProductErr),
-			"product stock must be greater than 0",
+			err.Error(),
 		).Res()
 	}
-	stockValue = stock
 
-	images, exists := form.File["images"]
-	if !exists || len(images) == 0 {
+	// รูปส่งมาได้ทั้งเป็นไฟล์ หรือเป็น upload_ids ของไฟล์ที่ upload ตรงเข้า storage และ confirm แล้ว
+	images := form.File["images"]
+	uploadIds := form.Value["upload_ids"]
+	if len(images) == 0 && len(uploadIds) == 0 {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
 			string(AddProductErr),
@@ -189,44 +204,24 @@ func (h *productHandler) AddProduct(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	// files ext validation
-	extMap := map[string]string{
-		"png":  "png",
-		"jpg":  "jpg",
-		"jpeg": "jpeg",
-	}
-
 	req := make([]*files.FileReq, 0)
 
+	// ยังไม่มี product id จึงเก็บไว้ที่ prefix ของสินค้าตรง ๆ ชื่อไฟล์สุ่มอยู่แล้ว
+	dir, _ := files.UploadDir(files.NamespaceProducts, "")
 	for _, file := range images {
-		// check file extension
-		ext := strings.TrimPrefix(filepath.Ext(file.Filename), ".")
-		if extMap[ext] != ext || extMap[ext] == "" {
-			return entities.NewResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(AddProductErr),
-				"invalid file extension",
-			).Res()
-		}
-		// check file size
-		if file.Size > int64(h.cfg.App().FileLimit()) {
+		// ตรวจชนิดไฟล์จากเนื้อหาจริง และขนาดของรูป
+		fileReq, err := files.NewImageReq(h.cfg.App(), file, dir, false)
+		if err != nil {
 			return entities.NewResponse(c).Error(
 				fiber.ErrBadRequest.Code,
 				string(AddProductErr),
-				fmt.Sprintf("file size must less than %d MB", int(math.Ceil(float64(h.cfg.App().FileLimit())/math.Pow(1024, 2)))),
+				err.Error(),
 			).Res()
 		}
-
-		filename := utils.RandFileName(ext)
-		req = append(req, &files.FileReq{
-			File:        file,
-			Destination: fmt.Sprintf("%s/%s", productTitle, filename),
-			FileName:    filename,
-			Extension:   ext,
-		})
+		req = append(req, fileReq)
 	}
 
-	img, err := h.fileUsecase.UploadToGCP(req)
+	img, err := h.fileUsecase.UploadImages(req)
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
@@ -235,16 +230,30 @@ func (h *productHandler) AddProduct(c *fiber.Ctx) error {
 		).Res()
 	}
 
+	if len(uploadIds) > 0 {
+		userId, _ := c.Locals("userId").(string)
+		attached, err := h.fileUsecase.PrepareUploads(userId, uploadIds, &files.AttachOptions{Variants: true})
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(AddProductErr),
+				err.Error(),
+			).Res()
+		}
+		img = append(img, attached...)
+	}
+
 	prod := &product.AddProduct{
 		ProductTitle:    productTitle[0],
 		ProductDesc:     productDesc[0],
 		ProductPrice:    productPriceFloat,
-		ProductColor:    productColor[0],
-		ProductSize:     productSize[0],
 		ProductSex:      productSex[0],
 		ProductCategory: productCategory[0],
-		ProductStock:    stockValue,
 		Images:          img,
+		Variants:        variants,
+		Status:          status,
+		ActorId:         actorId(c),
+		UploadIds:       uploadIds,
 	}
 
 	result, err := h.productUsecase.AddProduct(prod)
@@ -260,7 +269,7 @@ func (h *productHandler) AddProduct(c *fiber.Ctx) error {
 
 func (h *productHandler) DeleteProduct(c *fiber.Ctx) error {
 	prodId := strings.TrimSpace(c.Params("product_id"))
-	result, err := h.productUsecase.DeleteProduct(prodId)
+	result, err := h.productUsecase.DeleteProduct(prodId, actorId(c))
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
@@ -285,7 +294,16 @@ func (h *productHandler) FindProduct(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	products := h.productUsecase.FindProduct(req)
+	req.IncludeHidden = isAdmin(c)
+
+	products, err := h.productUsecase.FindProduct(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findProductErr),
+			err.Error(),
+		).Res()
+	}
 	return entities.NewResponse(c).Success(fiber.StatusOK, products).Res()
 }
 
@@ -343,91 +361,53 @@ func (h *productHandler) UpdateProduct(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	productColor := ""
-	if values, exists := form.Value["product_color"]; exists && len(values) > 0 {
-		productColor = values[0]
-	}
-	productSize := ""
-	if values, exists := form.Value["product_size"]; exists && len(values) > 0 {
-		productSize = values[0]
-	}
 	productSex := ""
 	if values, exists := form.Value["product_sex"]; exists && len(values) > 0 {
 		productSex = values[0]
 	}
 	productCategory := ""
-	if values, exists := form.Value["product_category"]; exists && len(values) > 0 {
+	if values, exists := form.Value["category_id"]; exists && len(values) > 0 {
+		productCategory = values[0]
+	} else if values, exists := form.Value["product_category"]; exists && len(values) > 0 {
 		productCategory = values[0]
 	}
 
-	stockValue := 0
-	productStock, exists := form.Value["product_stock"]
-	if !exists || len(productStock[0]) == 0 {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(AddProductErr),
-			"product_stock is required",
-		).Res()
-	}
-	// convert to int and check if it's 0 then stock is 0
-	stock, err := strconv.Atoi(productStock[0])
-	if err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(AddProductErr),
-			"invalid product stock",
-		).Res()
-	}
-	if stock < 0 {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(AddProductErr),
-			"product stock must be greater than 0",
-		).Res()
+	// ตรวจ If-Match ก่อน upload หรือเตรียมไฟล์ ไม่งั้นได้ 412 ทีหลังก็มีไฟล์ค้างเปล่า ๆ
+	// transaction ยังตรวจซ้ำตอน lock สินค้า กันการแก้ที่เข้ามาระหว่างนี้
+	ifMatch := entities.IfMatch(c)
+	if ifMatch != nil {
+		if current, err := h.productUsecase.FindOneProduct(productId[0], true); err == nil && !ifMatch.Match(current.Version) {
+			return h.preconditionFailed(c, productId[0], string(UpdateProductErr))
+		}
 	}
-	stockValue = stock
 
-	imagesRes := make([]*files.FileRes, len(form.File["images"]))
+	imagesRes := make([]*files.FileRes, 0)
 	if images, exists := form.File["images"]; exists {
-		// files ext validation
-		extMap := map[string]string{
-			"png":  "png",
-			"jpg":  "jpg",
-			"jpeg": "jpeg",
-		}
-
 		req := make([]*files.FileReq, 0)
 
+		dir, err := files.UploadDir(files.NamespaceProducts, productId[0])
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(UpdateProductErr),
+				err.Error(),
+			).Res()
+		}
 		for _, file := range images {
-			// check file extension
-			ext := strings.TrimPrefix(filepath.Ext(file.Filename), ".")
-			if extMap[ext] != ext || extMap[ext] == "" {
-				return entities.NewResponse(c).Error(
-					fiber.ErrBadRequest.Code,
-					string(UpdateProductErr),
-					"invalid file extension",
-				).Res()
-			}
-			// check file size
-			if file.Size > int64(h.cfg.App().FileLimit()) {
+			// ตรวจชนิดไฟล์จากเนื้อหาจริง และขนาดของรูป
+			fileReq, err := files.NewImageReq(h.cfg.App(), file, dir, false)
+			if err != nil {
 				return entities.NewResponse(c).Error(
 					fiber.ErrBadRequest.Code,
 					string(UpdateProductErr),
-					fmt.Sprintf("file size must less than %d MB", int(math.Ceil(float64(h.cfg.App().FileLimit())/math.Pow(1024, 2)))),
+					err.Error(),
 				).Res()
 			}
-
-			filename := utils.RandFileName(ext)
-			req = append(req, &files.FileReq{
-				File:        file,
-				Destination: fmt.Sprintf("%s/%s", productId, filename),
-				FileName:    filename,
-				Extension:   ext,
-			})
+			req = append(req, fileReq)
 			fmt.Println(req)
 		}
 
-		img, err := h.fileUsecase.UploadToGCP(req)
+		img, err := h.fileUsecase.UploadImages(req)
 		if err != nil {
 			return entities.NewResponse(c).Error(
 				fiber.ErrInternalServerError.Code,
@@ -437,10 +417,24 @@ func (h *productHandler) UpdateProduct(c *fiber.Ctx) error {
 		}
 		fmt.Println("img", img)
 
-		copy(imagesRes, img)
+		imagesRes = append(imagesRes, img...)
 
 	}
 
+	uploadIds := form.Value["upload_ids"]
+	if len(uploadIds) > 0 {
+		userId, _ := c.Locals("userId").(string)
+		attached, err := h.fileUsecase.PrepareUploads(userId, uploadIds, &files.AttachOptions{Variants: true})
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(UpdateProductErr),
+				err.Error(),
+			).Res()
+		}
+		imagesRes = append(imagesRes, attached...)
+	}
+
 	// fmt.Println("imagesRes", imagesRes)
 
 	prod := &product.UpdateProduct{
@@ -448,24 +442,28 @@ func (h *productHandler) UpdateProduct(c *fiber.Ctx) error {
 		ProductTitle:    productTitle,
 		ProductDesc:     productDesc,
 		ProductPrice:    productPriceFloat,
-		ProductColor:    productColor,
-		ProductSize:     productSize,
 		ProductSex:      productSex,
 		ProductCategory: productCategory,
-		ProductStock:    stockValue,
 		Images:          imagesRes,
+		ActorId:         actorId(c),
+		IfMatch:         ifMatch,
+		UploadIds:       uploadIds,
 	}
 
 	fmt.Println("prod", prod)
 
 	result, err := h.productUsecase.UpdateProduct(prod)
 	if err != nil {
+		if errors.Is(err, entities.ErrPreconditionFailed) {
+			return h.preconditionFailed(c, prod.Id, string(UpdateProductErr))
+		}
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
 			string(UpdateProductErr),
 			err.Error(),
 		).Res()
 	}
+	c.Set(fiber.HeaderETag, entities.ETag(result.Version))
 	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 }
 
@@ -483,6 +481,345 @@ func (h *productHandler) FindImageByProductId(c *fiber.Ctx) error {
 }
 
 func (h *productHandler) GetAllProduct(c *fiber.Ctx) error {
-	result := h.productUsecase.GetAllProduct()
+	result := h.productUsecase.GetAllProduct(isAdmin(c))
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *productHandler) AddVariant(c *fiber.Ctx) error {
+	req := new(product.VariantReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(AddVariantErr),
+			err.Error(),
+		).Res()
+	}
+	req.ProductId = strings.TrimSpace(c.Params("product_id"))
+	req.ActorId = actorId(c)
+
+	result, err := h.productUsecase.AddVariant(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(AddVariantErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusCreated, result).Res()
+}
+
+func (h *productHandler) UpdateVariant(c *fiber.Ctx) error {
+	req := new(product.VariantReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateVariantErr),
+			err.Error(),
+		).Res()
+	}
+	req.Id = strings.TrimSpace(c.Params("variant_id"))
+	req.ActorId = actorId(c)
+
+	result, err := h.productUsecase.UpdateVariant(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateVariantErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *productHandler) DeleteVariant(c *fiber.Ctx) error {
+	variantId := strings.TrimSpace(c.Params("variant_id"))
+	result, err := h.productUsecase.DeleteVariant(variantId, actorId(c))
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(DeleteVariantErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// UpdateProductStatus เปลี่ยนสถานะและเวลาขึ้น/ลงหน้าร้าน ใช้ archived แทนการลบ และเปลี่ยนกลับเพื่อกู้คืน
+func (h *productHandler) UpdateProductStatus(c *fiber.Ctx) error {
+	req := new(product.ProductStatusReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateProductStatusErr),
+			err.Error(),
+		).Res()
+	}
+	req.Id = strings.TrimSpace(c.Params("product_id"))
+	req.ActorId = actorId(c)
+	req.IfMatch = entities.IfMatch(c)
+
+	result, err := h.productUsecase.UpdateProductStatus(req)
+	if err != nil {
+		if errors.Is(err, entities.ErrPreconditionFailed) {
+			return h.preconditionFailed(c, req.Id, string(UpdateProductStatusErr))
+		}
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateProductStatusErr),
+			err.Error(),
+		).Res()
+	}
+	c.Set(fiber.HeaderETag, entities.ETag(result.Version))
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// isAdmin ผู้ใช้ที่ login เป็น admin (ผ่าน OptionalJwtAuth) เห็นสินค้าที่ยังไม่แสดงหน้าร้าน
+func isAdmin(c *fiber.Ctx) bool {
+	roleId, ok := c.Locals("userRoleId").(int)
+	return ok && roleId == 2
+}
+
+// preconditionFailed ตอบ 412 พร้อมสินค้าปัจจุบันและ ETag ของมัน ให้ client รวมการแก้แล้วส่งใหม่
+func (h *productHandler) preconditionFailed(c *fiber.Ctx, prodId, errCode string) error {
+	current, err := h.productUsecase.FindOneProduct(prodId, true)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.StatusPreconditionFailed,
+			errCode,
+			entities.ErrPreconditionFailed.Error(),
+		).Res()
+	}
+	c.Set(fiber.HeaderETag, entities.ETag(current.Version))
+	return entities.NewResponse(c).Success(fiber.StatusPreconditionFailed, current).Res()
+}
+
+// actorId user ที่ login อยู่ บันทึกเป็นผู้แก้ไขในประวัติของสินค้า
+func actorId(c *fiber.Ctx) string {
+	userId, _ := c.Locals("userId").(string)
+	return userId
+}
+
+func formValue(form *multipart.Form, key string) string {
+	if values := form.Value[key]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// variantsFromForm อ่าน variant จาก field "variants" ที่เป็น JSON array
+// ถ้าไม่มี ใช้ product_size, product_color และ product_stock แบบเดิมเป็น variant เดียว
+func variantsFromForm(form *multipart.Form) ([]*product.VariantReq, error) {
+	variants := make([]*product.VariantReq, 0)
+	if values := form.Value["variants"]; len(values) > 0 && values[0] != "" {
+		if err := json.Unmarshal([]byte(values[0]), &variants); err != nil {
+			return nil, fmt.Errorf("invalid variants: %v", err)
+		}
+	} else {
+		v := &product.VariantReq{}
+		if values := form.Value["product_size"]; len(values) > 0 {
+			v.Size = values[0]
+		}
+		if values := form.Value["product_color"]; len(values) > 0 {
+			v.Color = values[0]
+		}
+		if values := form.Value["product_stock"]; len(values) > 0 && values[0] != "" {
+			stock, err := strconv.Atoi(values[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid product stock")
+			}
+			v.Stock = stock
+		}
+		variants = append(variants, v)
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("variants is required")
+	}
+	seen := make(map[string]bool)
+	for _, v := range variants {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(v.Size + "\x00" + v.Color)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate variant %s/%s", v.Size, v.Color)
+		}
+		seen[key] = true
+	}
+	return variants, nil
+}
+
+// Suggest typeahead จาก index ใน memory ไม่แตะ database
+func (h *productHandler) Suggest(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	limit := min(max(c.QueryInt("limit", 8), 1), 20)
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, h.productUsecase.Suggest(q, limit)).Res()
+}
+
+// ImportProducts รับไฟล์ใน field "file" (multipart) หรือเป็น body ตรง ๆ
+// รูปแบบดูจาก ?format= นามสกุลไฟล์ หรือ content type ส่ง ?dry_run=true เพื่อตรวจอย่างเดียว
+// ถ้ามีแถวที่ผิดตอบ 422 พร้อม report และไม่บันทึกอะไรเลย
+func (h *productHandler) ImportProducts(c *fiber.Ctx) error {
+	format := strings.ToLower(strings.TrimSpace(c.Query("format")))
+
+	var body io.Reader
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(ImportProductErr),
+				err.Error(),
+			).Res()
+		}
+		defer f.Close()
+
+		body = f
+		if format == "" {
+			format = product.DetectFormat(file.Filename, file.Header.Get(fiber.HeaderContentType))
+		}
+	} else {
+		body = bytes.NewReader(c.Body())
+		if format == "" {
+			format = product.DetectFormat("", c.Get(fiber.HeaderContentType))
+		}
+	}
+
+	report, err := h.productUsecase.ImportProducts(body, format, c.QueryBool("dry_run"), actorId(c))
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(ImportProductErr),
+			err.Error(),
+		).Res()
+	}
+	if report.Failed > 0 {
+		return entities.NewResponse(c).Success(fiber.StatusUnprocessableEntity, report).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, report).Res()
+}
+
+// ExportProducts stream สินค้าทั้งหมดพร้อม variant และรูป ?format=csv (ค่าเริ่มต้น) หรือ ndjson
+func (h *productHandler) ExportProducts(c *fiber.Ctx) error {
+	format := strings.ToLower(strings.TrimSpace(c.Query("format", product.FormatCsv)))
+
+	var contentType string
+	switch format {
+	case product.FormatCsv:
+		contentType = "text/csv; charset=utf-8"
+	case product.FormatNdjson:
+		contentType = "application/x-ndjson"
+	default:
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(ExportProductErr),
+			"format must be csv or ndjson",
+		).Res()
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="products-%s.%s"`, time.Now().Format("20060102"), format))
+
+	// header ส่งไปแล้วตอนเริ่ม stream ถ้าผิดกลางทางทำได้แค่ log และตัด response
+	// client หลุดหรือ server กำลังปิด ให้ cancel query แทนที่จะอ่านสินค้าทั้งหมดจนจบ
+	parent := c.UserContext()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(parent)
+		defer cancel()
+
+		if err := h.productUsecase.ExportProducts(ctx, &cancelOnErrorWriter{w: w, cancel: cancel}, format); err != nil {
+			log.Printf("export products failed: %v", err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("flush export products failed: %v", err)
+		}
+	})
+	return nil
+}
+
+// cancelOnErrorWriter cancel ctx ทันทีที่เขียนไม่สำเร็จ เช่น client ปิด connection ไปแล้ว
+type cancelOnErrorWriter struct {
+	w      io.Writer
+	cancel context.CancelFunc
+}
+
+func (cw *cancelOnErrorWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	if err != nil {
+		cw.cancel()
+	}
+	return n, err
+}
+
+// FindRevisions ประวัติการแก้ไขของสินค้า ใหม่สุดก่อน แบ่งหน้าด้วย page หรือ cursor
+func (h *productHandler) FindRevisions(c *fiber.Ctx) error {
+	req := &product.RevisionFilter{
+		PaginationReq: &entities.PaginationReq{},
+	}
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(FindRevisionsErr),
+			err.Error(),
+		).Res()
+	}
+	req.ProductId = strings.TrimSpace(c.Params("product_id"))
+
+	result, err := h.productUsecase.FindRevisions(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(FindRevisionsErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// FindRevision revision เดียวพร้อม snapshot ของสินค้าในตอนนั้น
+func (h *productHandler) FindRevision(c *fiber.Ctx) error {
+	prodId := strings.TrimSpace(c.Params("product_id"))
+	revisionId := strings.TrimSpace(c.Params("revision_id"))
+
+	result, err := h.productUsecase.FindRevision(prodId, revisionId)
+	if err != nil {
+		if err.Error() == "revision not found" {
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(FindRevisionErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(FindRevisionErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// RestoreRevision แก้สินค้ากลับเป็น revision ที่เลือก การกู้คืนถูกบันทึกเป็น revision ใหม่
+func (h *productHandler) RestoreRevision(c *fiber.Ctx) error {
+	prodId := strings.TrimSpace(c.Params("product_id"))
+	revisionId := strings.TrimSpace(c.Params("revision_id"))
+
+	result, err := h.productUsecase.RestoreRevision(prodId, revisionId, actorId(c))
+	if err != nil {
+		if err.Error() == "revision not found" {
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(RestoreRevisionErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(RestoreRevisionErr),
+			err.Error(),
+		).Res()
+	}
 	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 }
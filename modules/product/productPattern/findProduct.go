@@ -5,12 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
-	"github.com/deeptech-kmitl/Cicero-Backend/pkg/utils"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -19,30 +19,59 @@ type IFindProductBuilder interface {
 	initQuery()
 	countQuery()
 	whereQuery()
+	keysetQuery()
 	sort()
 	paginate()
 	closeJsonQuery()
+	facetQuery()
 	resetQuery()
 	Result() []*product.Product
 	Count() int
-	PrintQuery()
+	Facets() *product.ProductFacets
+	Cursors() *entities.Cursors
 }
 
 type findProductBuilder struct {
-	db             *sqlx.DB
-	req            *product.ProductFilter
-	query          string
-	lastStackIndex int
-	values         []any
+	db      *sqlx.DB
+	req     *product.ProductFilter
+	keyset  *entities.Keyset // nil = แบ่งหน้าด้วย OFFSET อย่างเดียว
+	cursors *entities.Cursors
+	query   string
+	sql     *sqlbuilder.Builder
 }
 
-func FindProductBuilder(db *sqlx.DB, req *product.ProductFilter) IFindProductBuilder {
+func FindProductBuilder(db *sqlx.DB, req *product.ProductFilter, keyset *entities.Keyset) IFindProductBuilder {
 	return &findProductBuilder{
-		db:  db,
-		req: req,
+		db:      db,
+		req:     req,
+		keyset:  keyset,
+		cursors: new(entities.Cursors),
+		sql:     sqlbuilder.New(),
 	}
 }
 
+// sort key ที่แบ่งหน้าด้วย cursor ได้ id ต่อท้ายทุกตัวเพื่อให้ลำดับคงที่
+var productSortKeys = map[string]*entities.KeysetColumn{
+	"id":         {Expr: `"p"."id"`, Cast: "VARCHAR"},
+	"title":      {Expr: `"p"."product_title"`, Cast: "VARCHAR"},
+	"price":      {Expr: `"p"."product_price"`, Cast: "FLOAT"},
+	"newest":     {Expr: `"p"."created_at"`, Cast: "TIMESTAMP"},
+	"popularity": {Expr: popularityQuery, Cast: "BIGINT"},
+}
+
+// ProductKeyset สร้าง keyset จาก sort ของ request
+// relevance ขึ้นกับคำค้นจึงแบ่งหน้าได้แค่แบบ OFFSET (คืน nil)
+func ProductKeyset(req *product.ProductFilter) (*entities.Keyset, error) {
+	orderBy := strings.ToLower(req.OrderBy)
+	if _, ok := productSortKeys[orderBy]; !ok {
+		if req.Cursor != "" {
+			return nil, entities.ErrInvalidCursor
+		}
+		return nil, nil
+	}
+	return entities.SortKeyset("product", productSortKeys, orderBy, strings.ToUpper(req.Sort) == "DESC", req.Cursor)
+}
+
 func (b *findProductBuilder) openJsonQuery() {
 	b.query += `SELECT
 		array_to_json(array_agg("t"))
@@ -56,11 +85,39 @@ func (b *findProductBuilder) initQuery() {
 			"p"."product_title",
 			"p"."product_desc",
 			"p"."product_price",
-			"p"."product_color",
-			"p"."product_size",
 			"p"."product_sex",
-			"p"."product_category",
-			"p"."product_stock",
+			"p"."category_id",
+			` + product.StatusColumns(`"p"`) + `,
+			(
+				SELECT
+					"c"."name"
+				FROM "Category" "c"
+				WHERE "c"."id" = "p"."category_id"
+			) AS "product_category",
+			(
+				SELECT
+					COALESCE(SUM("v"."stock"), 0)
+				FROM "ProductVariant" "v"
+				WHERE "v"."product_id" = "p"."id"
+			) AS "product_stock",
+			(
+				SELECT
+					COALESCE(array_to_json(array_agg("vt")), '[]'::json)
+				FROM (
+					SELECT
+						"v"."id",
+						"v"."product_id",
+						"v"."sku",
+						"v"."size",
+						"v"."color",
+						"v"."stock",
+						COALESCE("v"."price", "p"."product_price") AS "price",
+						"v"."price" AS "price_override"
+					FROM "ProductVariant" "v"
+					WHERE "v"."product_id" = "p"."id"
+					ORDER BY "v"."id"
+				) AS "vt"
+			) AS "variants",
 			(
 				SELECT
 					COALESCE(array_to_json(array_agg("it")), '[]'::json)
@@ -68,11 +125,21 @@ func (b *findProductBuilder) initQuery() {
 					SELECT
 						"i"."id",
 						"i"."filename",
-						"i"."url"
+						"i"."url",
+						"i"."width",
+						"i"."height",
+						"i"."variants"
 					FROM "Image" "i"
 					WHERE "i"."product_id" = "p"."id"
 				) AS "it"
-			) AS "images"
+			) AS "images"`
+
+	if b.keyset != nil {
+		b.query += `,
+			` + b.keyset.Select() + ` AS "cursor_values"`
+	}
+
+	b.query += `
 		FROM "Product" "p"
 		WHERE 1 = 1`
 }
@@ -83,76 +150,344 @@ func (b *findProductBuilder) countQuery() {
 		FROM "Product" "p"
 		WHERE 1 = 1`
 }
-func (b *findProductBuilder) whereQuery() {
-	var queryWhere string
-	queryWhereStack := make([]string, 0)
+
+// findCondition เงื่อนไขหนึ่งข้อของ filter ใช้ ? แทน placeholder
+// facet คือชื่อ facet ที่เป็นเจ้าของเงื่อนไข ใช้ข้ามตอนนับ facet นั้น
+type findCondition struct {
+	facet  string
+	query  string
+	values []any
+}
+
+// เงื่อนไขของตัวสินค้า อ้างถึง "p"
+func (b *findProductBuilder) productConditions() []*findCondition {
+	conditions := make([]*findCondition, 0)
+
+	// หน้าร้านเห็นแค่สินค้าที่แสดงอยู่ admin เห็นทั้งหมดและกรองตามสถานะได้
+	if !b.req.IncludeHidden {
+		conditions = append(conditions, &findCondition{
+			query: product.VisibleQuery(`"p"`),
+		})
+	} else if status := product.FilterValues(b.req.Status); len(status) > 0 {
+		conditions = append(conditions, &findCondition{
+			query:  `"p"."status" = ANY(?)`,
+			values: []any{status},
+		})
+	}
 
 	// Id check
 	if b.req.Id != "" {
-		b.values = append(b.values, "%"+strings.ToLower(b.req.Id)+"%")
-
-		queryWhereStack = append(queryWhereStack, `
-		AND (LOWER("p"."id") LIKE ?)`)
+		conditions = append(conditions, &findCondition{
+			query:  `(LOWER("p"."id") LIKE ?)`,
+			values: []any{"%" + strings.ToLower(b.req.Id) + "%"},
+		})
 	}
 
 	// Search check
-	if b.req.Search != "" {
-		b.values = append(
-			b.values,
-			"%"+strings.ToLower(b.req.Search)+"%",
-			"%"+strings.ToLower(b.req.Search)+"%",
-		)
-
-		queryWhereStack = append(queryWhereStack, `
-		AND (LOWER("p"."product_title") LIKE ? OR LOWER("p"."product_desc") LIKE ?)`)
-	}
-
-	for i := range queryWhereStack {
-		if i != len(queryWhereStack)-1 {
-			queryWhere += strings.Replace(queryWhereStack[i], "?", "$"+strconv.Itoa(i+1), 1)
-		} else {
-			queryWhere += strings.Replace(queryWhereStack[i], "?", "$"+strconv.Itoa(i+1), 1)
-			queryWhere = strings.Replace(queryWhere, "?", "$"+strconv.Itoa(i+2), 1)
+	if search := strings.ToLower(strings.TrimSpace(b.req.Search)); search != "" {
+		conditions = append(conditions, searchCondition(search))
+	}
+
+	// Category check (รวมหมวดย่อยทุกชั้น)
+	if b.req.Category != "" {
+		conditions = append(conditions, &findCondition{
+			facet: "category",
+			query: `"p"."category_id" IN (
+			WITH RECURSIVE "tree" AS (
+				SELECT "c"."id" FROM "Category" "c"
+				WHERE "c"."id"::TEXT = ? OR "c"."slug" = ?
+				UNION
+				SELECT "c"."id" FROM "Category" "c"
+				JOIN "tree" "t" ON "c"."parent_id" = "t"."id"
+			)
+			SELECT "id" FROM "tree"
+		)`,
+			values: []any{b.req.Category, strings.ToLower(b.req.Category)},
+		})
+	}
+
+	// Sex check
+	if sex := product.FilterValues(b.req.Sex); len(sex) > 0 {
+		conditions = append(conditions, &findCondition{
+			facet:  "sex",
+			query:  `LOWER("p"."product_sex") = ANY(?)`,
+			values: []any{sex},
+		})
+	}
+	return conditions
+}
+
+// searchCondition ภาษาอังกฤษใช้ search_vector และ trigram สำหรับคำที่พิมพ์ผิดหรือพิมพ์ไม่จบ
+// ภาษาไทยตัดคำไม่ได้จึงค้นแบบ substring บนชื่อและรายละเอียด
+func searchCondition(search string) *findCondition {
+	if product.IsThai(search) {
+		return &findCondition{
+			query:  `(LOWER("p"."product_title") LIKE ? OR LOWER("p"."product_desc") LIKE ?)`,
+			values: []any{"%" + search + "%", "%" + search + "%"},
 		}
 	}
-	// Last stack record
-	b.lastStackIndex = len(b.values)
+	return &findCondition{
+		query: `("p"."search_vector" @@ websearch_to_tsquery('english', ?)
+			OR ? <% LOWER("p"."product_title")
+			OR LOWER("p"."product_title") LIKE ?)`,
+		values: []any{search, search, "%" + search + "%"},
+	}
+}
 
-	// Summary query
-	b.query += queryWhere
+// relevanceQuery คะแนนสำหรับเรียงผลค้นหา ชื่อสินค้าได้คะแนนมากกว่ารายละเอียด
+func relevanceQuery(search string) (string, []any) {
+	if product.IsThai(search) {
+		return `(
+			CASE WHEN LOWER("p"."product_title") LIKE ? THEN 2 ELSE 0 END +
+			CASE WHEN LOWER("p"."product_desc") LIKE ? THEN 1 ELSE 0 END
+		)`, []any{"%" + search + "%", "%" + search + "%"}
+	}
+	return `(
+			ts_rank_cd("p"."search_vector", websearch_to_tsquery('english', ?)) +
+			word_similarity(?, LOWER("p"."product_title"))
+		)`, []any{search, search}
 }
-func (b *findProductBuilder) sort() {
-	orderByMap := map[string]string{
-		"id":    "\"p\".\"id\"",
-		"title": "\"p\".\"product_title\"",
-		"price": "\"p\".\"product_price\"",
+
+// เงื่อนไขของ variant อ้างถึง "v" ต้องเป็นจริงใน variant เดียวกันทั้งหมด
+// เช่น สีแดง size M ที่ยังมีของ
+func (b *findProductBuilder) variantConditions() []*findCondition {
+	conditions := make([]*findCondition, 0)
+
+	if colors := product.FilterValues(b.req.Color); len(colors) > 0 {
+		conditions = append(conditions, &findCondition{
+			facet:  "color",
+			query:  `LOWER("v"."color") = ANY(?)`,
+			values: []any{colors},
+		})
 	}
 
-	if orderByMap[strings.ToLower(b.req.OrderBy)] == "" {
-		b.req.OrderBy = orderByMap["title"]
-	} else {
-		b.req.OrderBy = orderByMap[strings.ToLower(b.req.OrderBy)]
+	if sizes := product.FilterValues(b.req.Size); len(sizes) > 0 {
+		conditions = append(conditions, &findCondition{
+			facet:  "size",
+			query:  `LOWER("v"."size") = ANY(?)`,
+			values: []any{sizes},
+		})
+	}
+
+	// ราคาจริงของ variant (ราคาของ variant หรือราคาสินค้า)
+	if b.req.MinPrice > 0 {
+		conditions = append(conditions, &findCondition{
+			facet:  "price",
+			query:  `COALESCE("v"."price", "p"."product_price") >= ?`,
+			values: []any{b.req.MinPrice},
+		})
+	}
+	if b.req.MaxPrice > 0 {
+		conditions = append(conditions, &findCondition{
+			facet:  "price",
+			query:  `COALESCE("v"."price", "p"."product_price") <= ?`,
+			values: []any{b.req.MaxPrice},
+		})
 	}
 
-	sortMap := map[string]string{
-		"DESC": "DESC",
-		"ASC":  "ASC",
+	if b.req.InStock {
+		conditions = append(conditions, &findCondition{
+			facet: "in_stock",
+			query: `"v"."stock" > "v"."reserved"`, // ขายได้ ไม่นับที่ถูกจอง
+		})
+	}
+	return conditions
+}
+
+// filterQuery รวมเงื่อนไขเป็น AND ... โดยข้ามเงื่อนไขของ facet ที่ระบุ
+// joinVariant = true เมื่อ query join "ProductVariant" "v" ไว้แล้ว
+// ไม่งั้นเงื่อนไขของ variant จะอยู่ใน EXISTS
+func (b *findProductBuilder) filterQuery(skip string, joinVariant bool) (string, []any) {
+	var query string
+	values := make([]any, 0)
+
+	for _, c := range b.productConditions() {
+		if skip != "" && c.facet == skip {
+			continue
+		}
+		query += `
+		AND ` + c.query
+		values = append(values, c.values...)
 	}
-	if sortMap[strings.ToUpper(b.req.Sort)] == "" {
-		b.req.Sort = sortMap["ASC"]
+
+	variantQuery := ""
+	for _, c := range b.variantConditions() {
+		if skip != "" && c.facet == skip {
+			continue
+		}
+		variantQuery += `
+			AND ` + c.query
+		values = append(values, c.values...)
+	}
+	if variantQuery == "" {
+		return query, values
+	}
+
+	if joinVariant {
+		query += variantQuery
 	} else {
-		b.req.Sort = sortMap[strings.ToUpper(b.req.Sort)]
+		query += `
+		AND EXISTS (
+			SELECT 1 FROM "ProductVariant" "v"
+			WHERE "v"."product_id" = "p"."id"` + variantQuery + `
+		)`
 	}
+	return query, values
+}
 
+func (b *findProductBuilder) whereQuery() {
+	queryWhere, values := b.filterQuery("", false)
+	b.query += b.sql.Bind(queryWhere, values...)
+}
+
+// keysetQuery หาแถวถัดจาก cursor ต้องอยู่หลัง whereQuery และก่อน sort
+func (b *findProductBuilder) keysetQuery() {
+	if b.keyset == nil {
+		return
+	}
+	if queryKeyset := b.keyset.Condition(b.sql); queryKeyset != "" {
+		b.query += `
+		AND ` + queryKeyset
+	}
+}
+
+// จำนวนชิ้นที่ขายได้จาก snapshot สินค้าใน order
+const popularityQuery = `(
+			SELECT
+				COALESCE(SUM(COALESCE(("e"->>'qty')::INT, 1)), 0)
+			FROM "Order" "o",
+			jsonb_array_elements(
+				CASE WHEN jsonb_typeof("o"."products"->'Products') = 'array'
+				THEN "o"."products"->'Products' ELSE '[]'::jsonb END
+			) AS "e"
+			WHERE "e"->>'id' = "p"."id"
+		)`
+
+func (b *findProductBuilder) sort() {
+	if b.keyset != nil {
+		b.query += `
+        ORDER BY ` + b.keyset.OrderBy()
+		return
+	}
+
+	orderByMap := make(sqlbuilder.SortColumns)
+	for name, key := range productSortKeys {
+		orderByMap[name] = key.Expr
+	}
+	orderBy := orderByMap.Resolve(b.req.OrderBy, "title")
+
+	// relevance ต้องมีคำค้น ไม่งั้นเรียงตามชื่อ
+	search := strings.ToLower(strings.TrimSpace(b.req.Search))
+	if strings.ToLower(b.req.OrderBy) == "relevance" && search != "" {
+		relevance, values := relevanceQuery(search)
+		orderBy = b.sql.Bind(relevance, values...)
+	}
+
+	// เรียงด้วย id ต่อท้ายเพื่อให้แบ่งหน้าได้คงที่เมื่อค่าซ้ำกัน
 	b.query += fmt.Sprintf(`
-        ORDER BY %s %s`, b.req.OrderBy, b.req.Sort)
+        ORDER BY %s %s, "p"."id" ASC`, orderBy, sqlbuilder.Direction(b.req.Sort, "ASC"))
 }
-func (b *findProductBuilder) paginate() {
-	// offset (page - 1)*limit
-	b.values = append(b.values, (b.req.Page-1)*b.req.Limit, b.req.Limit)
+func (b *findProductBuilder) facetQuery() {
+	category, categoryValues := b.filterQuery("category", false)
+	sex, sexValues := b.filterQuery("sex", false)
+	color, colorValues := b.filterQuery("color", true)
+	size, sizeValues := b.filterQuery("size", true)
+	price, priceValues := b.filterQuery("price", true)
+	inStock, inStockValues := b.filterQuery("in_stock", true)
+
+	// bind ตามลำดับที่ปรากฏใน query
+	category = b.sql.Bind(category, categoryValues...)
+	sex = b.sql.Bind(sex, sexValues...)
+	color = b.sql.Bind(color, colorValues...)
+	size = b.sql.Bind(size, sizeValues...)
+	price = b.sql.Bind(price, priceValues...)
+	inStock = b.sql.Bind(inStock, inStockValues...)
+
+	query := fmt.Sprintf(`
+	SELECT
+		json_build_object(
+			'category', (
+				SELECT COALESCE(json_agg("f"), '[]'::json)
+				FROM (
+					SELECT
+						"c"."slug" AS "value",
+						"c"."name" AS "label",
+						COUNT(*) AS "count"
+					FROM "Product" "p"
+					JOIN "Category" "c" ON "c"."id" = "p"."category_id"
+					WHERE 1 = 1 %s
+					GROUP BY "c"."id", "c"."slug", "c"."name"
+					ORDER BY "count" DESC, "c"."name"
+				) AS "f"
+			),
+			'sex', (
+				SELECT COALESCE(json_agg("f"), '[]'::json)
+				FROM (
+					SELECT
+						LOWER("p"."product_sex") AS "value",
+						MIN("p"."product_sex") AS "label",
+						COUNT(*) AS "count"
+					FROM "Product" "p"
+					WHERE 1 = 1 %s
+					GROUP BY LOWER("p"."product_sex")
+					ORDER BY "count" DESC, "value"
+				) AS "f"
+			),
+			'color', (
+				SELECT COALESCE(json_agg("f"), '[]'::json)
+				FROM (
+					SELECT
+						LOWER("v"."color") AS "value",
+						MIN("v"."color") AS "label",
+						COUNT(DISTINCT "p"."id") AS "count"
+					FROM "Product" "p"
+					JOIN "ProductVariant" "v" ON "v"."product_id" = "p"."id"
+					WHERE "v"."color" <> '' %s
+					GROUP BY LOWER("v"."color")
+					ORDER BY "count" DESC, "value"
+				) AS "f"
+			),
+			'size', (
+				SELECT COALESCE(json_agg("f"), '[]'::json)
+				FROM (
+					SELECT
+						LOWER("v"."size") AS "value",
+						MIN("v"."size") AS "label",
+						COUNT(DISTINCT "p"."id") AS "count"
+					FROM "Product" "p"
+					JOIN "ProductVariant" "v" ON "v"."product_id" = "p"."id"
+					WHERE "v"."size" <> '' %s
+					GROUP BY LOWER("v"."size")
+					ORDER BY "count" DESC, "value"
+				) AS "f"
+			),
+			'price', (
+				SELECT
+					json_build_object(
+						'min', COALESCE(MIN(COALESCE("v"."price", "p"."product_price")), 0),
+						'max', COALESCE(MAX(COALESCE("v"."price", "p"."product_price")), 0)
+					)
+				FROM "Product" "p"
+				JOIN "ProductVariant" "v" ON "v"."product_id" = "p"."id"
+				WHERE 1 = 1 %s
+			),
+			'in_stock', (
+				SELECT
+					COUNT(DISTINCT "p"."id")
+				FROM "Product" "p"
+				JOIN "ProductVariant" "v" ON "v"."product_id" = "p"."id"
+				WHERE "v"."stock" > "v"."reserved" %s
+			)
+		);`, category, sex, color, size, price, inStock)
 
-	b.query += fmt.Sprintf(`	OFFSET $%d LIMIT $%d`, b.lastStackIndex+1, b.lastStackIndex+2)
-	b.lastStackIndex = len(b.values)
+	b.query = query
+}
+func (b *findProductBuilder) paginate() {
+	if b.keyset != nil {
+		b.query += b.keyset.Limit(b.sql, b.req.Page, b.req.Limit)
+		return
+	}
+	b.query += b.sql.Paginate(b.req.Page, b.req.Limit)
 }
 func (b *findProductBuilder) closeJsonQuery() {
 	b.query += `
@@ -160,43 +495,83 @@ func (b *findProductBuilder) closeJsonQuery() {
 }
 func (b *findProductBuilder) resetQuery() {
 	b.query = ""
-	b.values = make([]any, 0)
-	b.lastStackIndex = 0
+	b.sql = sqlbuilder.New()
 }
 func (b *findProductBuilder) Result() []*product.Product {
 	_, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
 	bytes := make([]byte, 0)
-	productsData := make([]*product.Product, 0)
+	rows := make([]*productRow, 0)
 
-	if err := b.db.Get(&bytes, b.query, b.values...); err != nil {
+	if err := b.db.Get(&bytes, b.query, b.sql.Args()...); err != nil {
 		log.Printf("find products failed: %v\n", err)
 		return make([]*product.Product, 0)
 	}
 
-	if err := json.Unmarshal(bytes, &productsData); err != nil {
+	if err := json.Unmarshal(bytes, &rows); err != nil {
 		log.Printf("unmarshal products failed: %v\n", err)
 		return make([]*product.Product, 0)
 	}
 	b.resetQuery()
+
+	if b.keyset != nil {
+		rows, b.cursors = entities.KeysetPage(b.keyset, rows, b.req.Limit, (b.req.Page-1)*b.req.Limit, func(r *productRow) []string {
+			return r.CursorValues
+		})
+	}
+
+	productsData := make([]*product.Product, 0, len(rows))
+	for _, r := range rows {
+		productsData = append(productsData, &r.Product)
+	}
 	return productsData
 }
+
+// productRow สินค้าหนึ่งแถวพร้อมค่าของ sort key สำหรับสร้าง cursor
+type productRow struct {
+	product.Product
+	CursorValues []string `json:"cursor_values"`
+}
+
+func (b *findProductBuilder) Cursors() *entities.Cursors {
+	return b.cursors
+}
 func (b *findProductBuilder) Count() int {
 	_, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
 	var count int
-	if err := b.db.Get(&count, b.query, b.values...); err != nil {
+	if err := b.db.Get(&count, b.query, b.sql.Args()...); err != nil {
 		log.Printf("count products failed: %v\n", err)
 		return 0
 	}
 	b.resetQuery()
 	return count
 }
-func (b *findProductBuilder) PrintQuery() {
-	utils.Debug(b.values)
-	fmt.Println(b.query)
+func (b *findProductBuilder) Facets() *product.ProductFacets {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	bytes := make([]byte, 0)
+	facets := &product.ProductFacets{
+		Category: make([]*product.FacetCount, 0),
+		Sex:      make([]*product.FacetCount, 0),
+		Color:    make([]*product.FacetCount, 0),
+		Size:     make([]*product.FacetCount, 0),
+		Price:    &product.PriceRange{},
+	}
+
+	if err := b.db.Get(&bytes, b.query, b.sql.Args()...); err != nil {
+		log.Printf("find product facets failed: %v\n", err)
+		return facets
+	}
+
+	if err := json.Unmarshal(bytes, facets); err != nil {
+		log.Printf("unmarshal product facets failed: %v\n", err)
+	}
+	b.resetQuery()
+	return facets
 }
 
 type findProductEngineer struct {
@@ -211,10 +586,10 @@ func (en *findProductEngineer) FindProduct() IFindProductBuilder {
 	en.builder.openJsonQuery()
 	en.builder.initQuery()
 	en.builder.whereQuery()
+	en.builder.keysetQuery()
 	en.builder.sort()
 	en.builder.paginate()
 	en.builder.closeJsonQuery()
-	en.builder.PrintQuery()
 	return en.builder
 }
 
@@ -223,3 +598,8 @@ func (en *findProductEngineer) CountProduct() IFindProductBuilder {
 	en.builder.whereQuery()
 	return en.builder
 }
+
+func (en *findProductEngineer) FacetProduct() IFindProductBuilder {
+	en.builder.facetQuery()
+	return en.builder
+}
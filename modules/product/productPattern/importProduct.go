@@ -0,0 +1,324 @@
+package productPattern
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
+	"github.com/jmoiron/sqlx"
+)
+
+// ImportCategoryQuery คืนค่าหมวดใน $1 (TEXT[]) ที่หาเจอด้วย id, slug หรือชื่อ
+func ImportCategoryQuery() string {
+	return `
+	SELECT
+		"x"."value"
+	FROM unnest($1::TEXT[]) AS "x"("value")
+	WHERE ` + categoryIdQuery(`"x"."value"`) + ` IS NOT NULL;`
+}
+
+type IImportProductBuilder interface {
+	initTransaction() error
+	upsertProduct(p *product.ImportProduct) error
+	upsertVariants(p *product.ImportProduct) error
+	insertImages(p *product.ImportProduct) error
+	claimImages(p *product.ImportProduct) error
+	recordRevision(p *product.ImportProduct) error
+	rollback()
+	commit() error
+}
+
+type importProductBuilder struct {
+	db      *sqlx.DB
+	tx      *sqlx.Tx
+	ctx     context.Context
+	actorId string                   // ว่าง = import จาก CLI
+	before  *product.ProductSnapshot // สินค้าก่อน import ของสินค้าที่กำลังทำ
+}
+
+func ImportProductBuilder(ctx context.Context, db *sqlx.DB, actorId string) IImportProductBuilder {
+	return &importProductBuilder{
+		db:      db,
+		ctx:     ctx,
+		actorId: actorId,
+	}
+}
+
+func (b *importProductBuilder) initTransaction() error {
+	tx, err := b.db.BeginTxx(b.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction import products failed: %v", err)
+	}
+	b.tx = tx
+	return nil
+}
+
+// upsertProduct หาสินค้าจาก sku ของ variant ก่อน (เปลี่ยนชื่อสินค้าได้) แล้วจากชื่อ ถ้าไม่เจอสร้างใหม่
+func (b *importProductBuilder) upsertProduct(p *product.ImportProduct) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+
+	skus := make([]string, 0, len(p.Variants))
+	for _, v := range p.Variants {
+		if v.Sku != "" {
+			skus = append(skus, v.Sku)
+		}
+	}
+
+	query := `
+	SELECT
+		"v"."product_id",
+		1 AS "priority"
+	FROM "ProductVariant" "v"
+	WHERE "v"."sku" = ANY($1)
+	UNION ALL
+	SELECT
+		"p"."id",
+		2 AS "priority"
+	FROM "Product" "p"
+	WHERE LOWER("p"."product_title") = LOWER($2)
+	ORDER BY "priority", "product_id"
+	LIMIT 1;`
+
+	p.Id = ""
+	b.before = nil
+	var priority int
+	if err := b.tx.QueryRowxContext(ctx, query, skus, p.ProductTitle).Scan(&p.Id, &priority); err != nil && err.Error() != "sql: no rows in result set" {
+		return fmt.Errorf("find product to import failed: %v", err)
+	}
+
+	if p.Id != "" {
+		before, err := SnapshotProduct(ctx, b.tx, p.Id)
+		if err != nil {
+			return err
+		}
+		b.before = before
+
+		query = `
+		UPDATE "Product" SET
+			"product_title" = $1,
+			"product_desc" = $2,
+			"product_price" = $3,
+			"product_sex" = $4,
+			"category_id" = ` + categoryIdQuery("$5") + `,
+			"status" = COALESCE(NULLIF($6, ''), "status")
+		WHERE "id" = $7;`
+
+		if _, err := b.tx.ExecContext(ctx, query, p.ProductTitle, p.ProductDesc, p.ProductPrice, p.ProductSex, p.ProductCategory, p.Status, p.Id); err != nil {
+			p.Fail("%v", importProductErr(err))
+			return fmt.Errorf("update product failed: %v", err)
+		}
+		p.Action = "updated"
+		return nil
+	}
+
+	query = `
+	INSERT INTO "Product" (
+		"product_title",
+		"product_desc",
+		"product_price",
+		"product_sex",
+		"category_id",
+		"status"
+	)
+	VALUES ($1, $2, $3, $4, ` + categoryIdQuery("$5") + `, COALESCE(NULLIF($6, ''), 'published'))
+	RETURNING "id";`
+
+	if err := b.tx.QueryRowxContext(ctx, query, p.ProductTitle, p.ProductDesc, p.ProductPrice, p.ProductSex, p.ProductCategory, p.Status).Scan(&p.Id); err != nil {
+		p.Fail("%v", importProductErr(err))
+		return fmt.Errorf("insert product failed: %v", err)
+	}
+	p.Action = "created"
+	return nil
+}
+
+func importProductErr(err error) error {
+	if isCategoryNotFound(err) {
+		return fmt.Errorf("category not found")
+	}
+	return err
+}
+
+// upsertVariants แก้ variant ที่ sku ตรงกัน (หรือ size และสีตรงกันถ้าไม่ใส่ sku) ไม่เจอเพิ่มใหม่
+// variant ที่ไม่มีในไฟล์ไม่ถูกลบ
+func (b *importProductBuilder) upsertVariants(p *product.ImportProduct) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+
+	update := `
+	UPDATE "ProductVariant" SET
+		"sku" = COALESCE(NULLIF($1, ''), "sku"),
+		"size" = $2,
+		"color" = $3,
+		"price" = $4
+	WHERE "product_id" = $5
+	AND (
+		"sku" = $1
+		OR ($1 = '' AND "size" = $2 AND "color" = $3)
+	)
+	RETURNING "id", "sku";`
+
+	insert := `
+	INSERT INTO "ProductVariant" (
+		"product_id",
+		"sku",
+		"size",
+		"color",
+		"price"
+	)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING "id";`
+
+	for _, v := range p.Variants {
+		v.Result.ProductId = p.Id
+		v.Result.ProductTitle = p.ProductTitle
+
+		var variantId, sku string
+		err := b.tx.QueryRowxContext(ctx, update, v.Sku, v.Size, v.Color, v.PriceOverride, p.Id).Scan(&variantId, &sku)
+		switch {
+		case err == nil:
+			v.Sku = sku
+			v.Result.Status = "updated"
+		case err.Error() == "sql: no rows in result set":
+			if v.Sku == "" {
+				v.Sku = product.DefaultSku(p.Id, v.Size, v.Color)
+			}
+			if err := b.tx.QueryRowxContext(ctx, insert, p.Id, v.Sku, v.Size, v.Color, v.PriceOverride).Scan(&variantId); err != nil {
+				v.Fail("%v", importVariantErr(err))
+				return fmt.Errorf("insert variant failed: %v", err)
+			}
+			v.Result.Status = "created"
+		default:
+			v.Fail("%v", importVariantErr(err))
+			return fmt.Errorf("update variant failed: %v", err)
+		}
+		v.Result.Sku = v.Sku
+
+		// stock ในไฟล์คือยอด on hand ส่วนต่างถูกบันทึกลง ledger
+		if err := inventoryRepository.SetStock(ctx, b.tx, variantId, v.Stock, b.actorId, "import"); err != nil {
+			v.Fail("%v", err)
+			return fmt.Errorf("set variant stock failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func importVariantErr(err error) error {
+	switch {
+	case strings.Contains(err.Error(), "ProductVariant_sku_key"):
+		return fmt.Errorf("sku already exists")
+	case strings.Contains(err.Error(), "ProductVariant_product_id_size_color_key"):
+		return fmt.Errorf("variant with this size and color already exists with another sku")
+	default:
+		return err
+	}
+}
+
+// insertImages เพิ่มรูปที่ยังไม่มีในสินค้า รูปเดิมที่ไม่มีในไฟล์ไม่ถูกลบ
+// รูปจาก url ภายนอกไม่มีรูปย่อและขนาด
+func (b *importProductBuilder) insertImages(p *product.ImportProduct) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+
+	query := `
+	INSERT INTO "Image" (
+		"filename",
+		"url",
+		"product_id"
+	)
+	SELECT $1, $2, $3
+	WHERE NOT EXISTS (
+		SELECT 1 FROM "Image" "i"
+		WHERE "i"."product_id" = $3
+		AND "i"."url" = $2
+	);`
+
+	for _, url := range p.Images {
+		if _, err := b.tx.ExecContext(ctx, query, path.Base(url), url, p.Id); err != nil {
+			p.Fail("insert image %s failed", url)
+			return fmt.Errorf("insert images failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// รูปที่เป็นไฟล์ใน storage ของเราถูกผูกกับสินค้า ไม่ให้ sweeper ลบ
+func (b *importProductBuilder) claimImages(p *product.ImportProduct) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+
+	return filesRepository.ClaimProductImages(ctx, b.tx, p.Id)
+}
+
+func (b *importProductBuilder) recordRevision(p *product.ImportProduct) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+
+	action := product.RevisionUpdate
+	if p.Action == "created" {
+		action = product.RevisionCreate
+	}
+	if err := RecordRevision(ctx, b.tx, p.Id, b.actorId, action, nil, b.before); err != nil {
+		p.Fail("%v", err)
+		return err
+	}
+	return nil
+}
+
+func (b *importProductBuilder) rollback() {
+	b.tx.Rollback()
+}
+
+func (b *importProductBuilder) commit() error {
+	if err := b.tx.Commit(); err != nil {
+		return fmt.Errorf("commit import products failed: %v", err)
+	}
+	return nil
+}
+
+type importProductEngineer struct {
+	builder IImportProductBuilder
+}
+
+func ImportProductEngineer(builder IImportProductBuilder) *importProductEngineer {
+	return &importProductEngineer{
+		builder: builder,
+	}
+}
+
+// ImportProducts บันทึกทุกสินค้าใน transaction เดียว ถ้าสินค้าไหนผิด rollback ทั้งหมด
+// error ของแถวถูกบันทึกลงผลของแถวนั้นด้วย
+func (en *importProductEngineer) ImportProducts(products []*product.ImportProduct) error {
+	if err := en.builder.initTransaction(); err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		if err := en.importProduct(p); err != nil {
+			en.builder.rollback()
+			return fmt.Errorf("row %d: %v", p.Row, err)
+		}
+	}
+	return en.builder.commit()
+}
+
+func (en *importProductEngineer) importProduct(p *product.ImportProduct) error {
+	if err := en.builder.upsertProduct(p); err != nil {
+		return err
+	}
+	if err := en.builder.upsertVariants(p); err != nil {
+		return err
+	}
+	if err := en.builder.insertImages(p); err != nil {
+		return err
+	}
+	if err := en.builder.claimImages(p); err != nil {
+		return err
+	}
+	return en.builder.recordRevision(p)
+}
@@ -3,16 +3,72 @@ package productPattern
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
 	"github.com/jmoiron/sqlx"
 )
 
+// insertImagesQuery คือ insert รูปทั้งหมดของสินค้าใน statement เดียว images ต้องไม่ว่าง
+func insertImagesQuery(productId string, images []*files.FileRes) (string, []any) {
+	sql := sqlbuilder.New()
+	values := make([]string, 0, len(images))
+	for _, img := range images {
+		values = append(values, sql.Bind(`(?, ?, ?, ?, ?, ?)`,
+			img.FileName,
+			img.Url,
+			productId,
+			img.Width,
+			img.Height,
+			img.Variants,
+		))
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO "Image" (
+		"filename",
+		"url",
+		"product_id",
+		"width",
+		"height",
+		"variants"
+	)
+	VALUES
+		%s;`, strings.Join(values, ",\n\t\t"))
+	return query, sql.Args()
+}
+
+// categoryIdQuery คือ subquery หา id ของหมวดจาก id, slug หรือชื่อ ที่ placeholder param
+// ได้ NULL ถ้าไม่เจอ ซึ่งจะชน NOT NULL ของ "category_id"
+func categoryIdQuery(param string) string {
+	return fmt.Sprintf(`(
+		SELECT
+			"c"."id"
+		FROM "Category" "c"
+		WHERE "c"."id"::TEXT = %[1]s
+		OR "c"."slug" = LOWER(%[1]s)
+		OR LOWER("c"."name") = LOWER(%[1]s)
+		ORDER BY ("c"."id"::TEXT = %[1]s) DESC, ("c"."slug" = LOWER(%[1]s)) DESC
+		LIMIT 1
+	)`, param)
+}
+
+func isCategoryNotFound(err error) bool {
+	return strings.Contains(err.Error(), `null value in column "category_id"`)
+}
+
 type IInsertProductBuilder interface {
 	initTransaction() error
 	insertProduct() error
+	insertVariants() error
 	insertImages() error
+	claimImages() error
+	recordRevision() error
 	commit() error
 	getProductId() string
 }
@@ -54,68 +110,84 @@ func (b *insertProductBuilder) insertProduct() error {
 		"product_title",
 		"product_desc",
 		"product_price",
-		"product_color",
-		"product_size",
 		"product_sex",
-		"product_category",
-		"product_stock"
+		"category_id",
+		"status",
+		"publish_at",
+		"unpublish_at"
 	)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	VALUES ($1, $2, $3, $4, ` + categoryIdQuery("$5") + `, $6, $7, $8)
 	RETURNING "id";`
 
+	status := b.req.Status
+	if status == nil {
+		status = &product.ProductStatusReq{Status: product.StatusPublished}
+	}
+
 	if err := b.tx.QueryRowxContext(
 		ctx,
 		query,
 		b.req.ProductTitle,
 		b.req.ProductDesc,
 		b.req.ProductPrice,
-		b.req.ProductColor,
-		b.req.ProductSize,
 		b.req.ProductSex,
 		b.req.ProductCategory,
-		b.req.ProductStock,
+		status.Status,
+		status.PublishTime,
+		status.UnpublishTime,
 	).Scan(&b.req.Id); err != nil {
 		b.tx.Rollback()
+		if isCategoryNotFound(err) {
+			return fmt.Errorf("category not found")
+		}
 		return fmt.Errorf("insert product failed: %v", err)
 	}
 	return nil
 }
 
-func (b *insertProductBuilder) insertImages() error {
+func (b *insertProductBuilder) insertVariants() error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
 	query := `
-	INSERT INTO "Image" (
-		"filename",
-		"url",
-		"product_id"
+	INSERT INTO "ProductVariant" (
+		"product_id",
+		"sku",
+		"size",
+		"color",
+		"price"
 	)
-	VALUES`
-
-	valueStack := make([]any, 0)
-	var index int
-	for i := range b.req.Images {
-		valueStack = append(valueStack,
-			b.req.Images[i].FileName,
-			b.req.Images[i].Url,
-			b.req.Id,
-		)
-
-		if i != len(b.req.Images)-1 {
-			query += fmt.Sprintf(`
-			($%d, $%d, $%d),`, index+1, index+2, index+3)
-		} else {
-			query += fmt.Sprintf(`
-			($%d, $%d, $%d);`, index+1, index+2, index+3)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING "id";`
+
+	// สร้างด้วย stock 0 แล้วบันทึก stock เริ่มต้นลง ledger
+	for _, v := range b.req.Variants {
+		if v.Sku == "" {
+			v.Sku = product.DefaultSku(b.req.Id, v.Size, v.Color)
+		}
+
+		var variantId string
+		if err := b.tx.QueryRowxContext(ctx, query, b.req.Id, v.Sku, v.Size, v.Color, v.PriceOverride).Scan(&variantId); err != nil {
+			b.tx.Rollback()
+			return fmt.Errorf("insert variants failed: %v", err)
+		}
+		if err := inventoryRepository.SetStock(ctx, b.tx, variantId, v.Stock, b.req.ActorId, "initial stock"); err != nil {
+			b.tx.Rollback()
+			return fmt.Errorf("insert variants failed: %v", err)
 		}
-		index += 3
 	}
+	return nil
+}
+
+func (b *insertProductBuilder) insertImages() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
 
+	query, args := insertImagesQuery(b.req.Id, b.req.Images)
 	if _, err := b.tx.ExecContext(
 		ctx,
 		query,
-		valueStack...,
+		args...,
 	); err != nil {
 		b.tx.Rollback()
 		return fmt.Errorf("insert images failed: %v", err)
@@ -123,6 +195,33 @@ func (b *insertProductBuilder) insertImages() error {
 	return nil
 }
 
+// ผูกไฟล์รูปกับสินค้าและ mark upload ว่าใช้แล้วใน transaction เดียวกัน insert ไม่สำเร็จ upload ก็ยังใช้ซ้ำได้
+func (b *insertProductBuilder) claimImages() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := filesRepository.ClaimProductImages(ctx, b.tx, b.req.Id); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	if err := filesRepository.AttachUploads(ctx, b.tx, b.req.UploadIds); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+func (b *insertProductBuilder) recordRevision() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := RecordRevision(ctx, b.tx, b.req.Id, b.req.ActorId, product.RevisionCreate, nil, nil); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
 func (b *insertProductBuilder) commit() error {
 	if err := b.tx.Commit(); err != nil {
 		return fmt.Errorf("commit failed: %v", err)
@@ -149,10 +248,22 @@ func (en *insertProductEngineer) InsertProduct() (string, error) {
 		return "", err
 	}
 
+	if err := en.builder.insertVariants(); err != nil {
+		return "", err
+	}
+
 	if err := en.builder.insertImages(); err != nil {
 		return "", err
 	}
 
+	if err := en.builder.claimImages(); err != nil {
+		return "", err
+	}
+
+	if err := en.builder.recordRevision(); err != nil {
+		return "", err
+	}
+
 	if err := en.builder.commit(); err != nil {
 		return "", err
 	}
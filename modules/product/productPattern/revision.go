@@ -0,0 +1,234 @@
+package productPattern
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
+	"github.com/jmoiron/sqlx"
+)
+
+// SnapshotProduct อ่านสินค้าพร้อมรูปและ variant เป็น snapshot สำหรับเก็บประวัติ
+// ใช้ tx ของการแก้ไขเพื่อให้เห็นข้อมูลก่อน/หลังแก้ใน transaction เดียวกัน
+func SnapshotProduct(ctx context.Context, db sqlx.ExtContext, productId string) (*product.ProductSnapshot, error) {
+	query := `
+	SELECT
+		jsonb_build_object(
+			'product_title', "p"."product_title",
+			'product_desc', "p"."product_desc",
+			'product_price', "p"."product_price",
+			'product_sex', "p"."product_sex",
+			'category_id', "p"."category_id",
+			'status', "p"."status",
+			'publish_at', to_char("p"."publish_at", 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+			'unpublish_at', to_char("p"."unpublish_at", 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+			'images', COALESCE((
+				SELECT
+					jsonb_agg(
+						jsonb_build_object(
+							'url', "i"."url",
+							'filename', "i"."filename",
+							'width', "i"."width",
+							'height', "i"."height",
+							'variants', "i"."variants"
+						)
+						ORDER BY "i"."created_at", "i"."id"
+					)
+				FROM "Image" "i"
+				WHERE "i"."product_id" = "p"."id"
+			), '[]'::jsonb),
+			'variants', COALESCE((
+				SELECT
+					jsonb_agg(
+						jsonb_build_object(
+							'id', "v"."id",
+							'sku', "v"."sku",
+							'size', "v"."size",
+							'color', "v"."color",
+							'price_override', "v"."price"
+						)
+						ORDER BY "v"."id"
+					)
+				FROM "ProductVariant" "v"
+				WHERE "v"."product_id" = "p"."id"
+			), '[]'::jsonb)
+		)
+	FROM "Product" "p"
+	WHERE "p"."id" = $1;`
+
+	raw := make([]byte, 0)
+	if err := db.QueryRowxContext(ctx, query, productId).Scan(&raw); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return nil, fmt.Errorf("product not found")
+		default:
+			return nil, fmt.Errorf("snapshot product failed: %v", err)
+		}
+	}
+
+	snapshot := new(product.ProductSnapshot)
+	if err := json.Unmarshal(raw, snapshot); err != nil {
+		return nil, fmt.Errorf("unmarshal product snapshot failed: %v", err)
+	}
+	return snapshot, nil
+}
+
+// RecordRevision บันทึกสินค้าหลังแก้ไขเทียบกับ before (nil ตอนสร้าง) ลง "ProductRevision"
+// ต้องเรียกใน transaction เดียวกับการแก้ไข การ update ที่ไม่มีอะไรเปลี่ยนไม่ถูกบันทึก
+func RecordRevision(ctx context.Context, tx sqlx.ExtContext, productId, actorId, action string, restoredFrom *int64, before *product.ProductSnapshot) error {
+	after, err := SnapshotProduct(ctx, tx, productId)
+	if err != nil {
+		return err
+	}
+
+	diff, err := product.DiffSnapshots(before, after)
+	if err != nil {
+		return fmt.Errorf("diff product snapshot failed: %v", err)
+	}
+	if action == product.RevisionUpdate && len(diff) == 0 {
+		return nil
+	}
+
+	snapshotJson, err := json.Marshal(after)
+	if err != nil {
+		return fmt.Errorf("marshal product snapshot failed: %v", err)
+	}
+	diffJson, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Errorf("marshal product diff failed: %v", err)
+	}
+
+	query := `
+	INSERT INTO "ProductRevision" (
+		"product_id",
+		"actor_id",
+		"action",
+		"restored_from",
+		"snapshot",
+		"diff"
+	)
+	VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6);`
+
+	if _, err := tx.ExecContext(ctx, query, productId, actorId, action, restoredFrom, snapshotJson, diffJson); err != nil {
+		return fmt.Errorf("insert product revision failed: %v", err)
+	}
+	return nil
+}
+
+// RestoreSnapshot แก้สินค้าให้ตรงกับ snapshot ทั้ง field รูป และ variant
+// variant ที่ไม่มีใน snapshot ถูกลบ (ตะกร้าและ wishlist ลบตาม cascade) variant ที่ถูกลบไปแล้วถูกสร้างใหม่ด้วย id เดิมและ stock 0
+// รูปใน storage ของเราที่ sweeper ลบไปแล้วกู้คืนไม่ได้ url จะยังอยู่แต่เปิดไม่ได้
+func RestoreSnapshot(ctx context.Context, tx *sqlx.Tx, productId, actorId string, s *product.ProductSnapshot) error {
+	query := `
+	UPDATE "Product" SET
+		"product_title" = $1,
+		"product_desc" = $2,
+		"product_price" = $3,
+		"product_sex" = $4,
+		"category_id" = $5,
+		"status" = $6,
+		"publish_at" = $7::TIMESTAMP,
+		"unpublish_at" = $8::TIMESTAMP
+	WHERE "id" = $9;`
+
+	res, err := tx.ExecContext(ctx, query, s.ProductTitle, s.ProductDesc, s.ProductPrice, s.ProductSex, s.CategoryId, s.Status, s.PublishAt, s.UnpublishAt, productId)
+	if err != nil {
+		if isCategoryNotFound(err) || strings.Contains(err.Error(), "category_id_fkey") {
+			return fmt.Errorf("category not found")
+		}
+		return fmt.Errorf("restore product failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("product not found")
+	}
+
+	if err := restoreImages(ctx, tx, productId, s.Images); err != nil {
+		return err
+	}
+	return restoreVariants(ctx, tx, productId, actorId, s.Variants)
+}
+
+// restoreImages แทนรูปทั้งหมดด้วยรูปใน snapshot ไฟล์ที่ไม่ได้ใช้แล้วถูกปล่อยให้ sweeper
+func restoreImages(ctx context.Context, tx *sqlx.Tx, productId string, images []*product.SnapshotImage) error {
+	if err := filesRepository.ReleaseAssets(ctx, tx, files.AssetOwnerProduct, productId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "Image" WHERE "product_id" = $1;`, productId); err != nil {
+		return fmt.Errorf("delete images failed: %v", err)
+	}
+
+	query := `
+	INSERT INTO "Image" (
+		"filename",
+		"url",
+		"product_id",
+		"width",
+		"height",
+		"variants"
+	)
+	VALUES ($1, $2, $3, $4, $5, $6);`
+
+	for _, img := range images {
+		if _, err := tx.ExecContext(ctx, query, img.Filename, img.Url, productId, img.Width, img.Height, img.Variants); err != nil {
+			return fmt.Errorf("restore images failed: %v", err)
+		}
+	}
+	return filesRepository.ClaimProductImages(ctx, tx, productId)
+}
+
+func restoreVariants(ctx context.Context, tx *sqlx.Tx, productId, actorId string, variants []*product.SnapshotVariant) error {
+	ids := make([]string, 0, len(variants))
+	for _, v := range variants {
+		ids = append(ids, v.Id)
+	}
+
+	// variant ที่ไม่มีใน snapshot ถูกตัดยอดใน ledger ก่อนลบ
+	query := `
+	SELECT
+		"id"
+	FROM "ProductVariant"
+	WHERE "product_id" = $1
+	AND NOT ("id" = ANY($2));`
+
+	removed := make([]string, 0)
+	if err := tx.SelectContext(ctx, &removed, query, productId, ids); err != nil {
+		return fmt.Errorf("find removed variants failed: %v", err)
+	}
+	if err := inventoryRepository.WriteOffVariants(ctx, tx, removed, actorId, "variant removed by restore"); err != nil {
+		return err
+	}
+
+	// ลบก่อนเพื่อคืน sku และ size/สี ให้ variant ใน snapshot
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "ProductVariant" WHERE "id" = ANY($1);`, removed); err != nil {
+		return fmt.Errorf("delete variants failed: %v", err)
+	}
+
+	upsert := `
+	INSERT INTO "ProductVariant" (
+		"id",
+		"product_id",
+		"sku",
+		"size",
+		"color",
+		"price"
+	)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT ("id") DO UPDATE SET
+		"sku" = EXCLUDED."sku",
+		"size" = EXCLUDED."size",
+		"color" = EXCLUDED."color",
+		"price" = EXCLUDED."price"
+	WHERE "ProductVariant"."product_id" = EXCLUDED."product_id";`
+
+	for _, v := range variants {
+		if _, err := tx.ExecContext(ctx, upsert, v.Id, productId, v.Sku, v.Size, v.Color, v.PriceOverride); err != nil {
+			return fmt.Errorf("restore variant %s failed: %v", v.Sku, importVariantErr(err))
+		}
+	}
+	return nil
+}
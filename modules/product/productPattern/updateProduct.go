@@ -6,8 +6,11 @@ import (
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -19,42 +22,63 @@ type IUpdateProductBuilder interface {
 	updatePriceQuery()
 	updateCategory()
 	updateSexQuery()
-	updateSizeQuery()
-	updateColorQuery()
-	updateStockQuery()
+	updateImagesQuery()
 	insertImages() error
 	getOldImages() []*entities.ImageRes
 	deleteOldImages() error
 	closeQuery()
 	updateProduct() error
-	getQueryFields() []string
-	getQuery() string
-	setQuery(query string)
+	hasFields() bool
 	getImagesLen() int
+	lock() error
+	snapshot() error
+	recordRevision() error
 	commit() error
 }
 
 type updateProductBuilder struct {
-	db             *sqlx.DB
-	tx             *sqlx.Tx
-	req            *product.UpdateProduct
-	filesUsecases  filesUsecase.IFilesUsecase
-	query          string
-	queryFields    []string
-	lastStackIndex int
-	values         []any
-	cfg            config.IConfig
+	db            *sqlx.DB
+	tx            *sqlx.Tx
+	req           *product.UpdateProduct
+	filesUsecases filesUsecase.IFilesUsecase
+	query         string
+	sql           *sqlbuilder.Builder
+	cfg           config.IConfig
+	before        *product.ProductSnapshot
+}
+
+// LockProduct lock สินค้าไว้จนจบ transaction แล้วตรวจ version กับ If-Match
+// การแก้สินค้าเดียวกันพร้อมกันจึงทำทีละคน คนที่มาทีหลังได้ entities.ErrPreconditionFailed
+func LockProduct(ctx context.Context, tx *sqlx.Tx, productId string, pre *entities.Precondition) error {
+	query := `
+	SELECT
+		"version"
+	FROM "Product"
+	WHERE "id" = $1
+	FOR UPDATE;`
+
+	var version int
+	if err := tx.QueryRowxContext(ctx, query, productId).Scan(&version); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return fmt.Errorf("product not found")
+		default:
+			return fmt.Errorf("lock product failed: %v", err)
+		}
+	}
+	if !pre.Match(version) {
+		return entities.ErrPreconditionFailed
+	}
+	return nil
 }
 
 func UpdateProductBuilder(db *sqlx.DB, req *product.UpdateProduct, fileUsecase filesUsecase.IFilesUsecase, cfg config.IConfig) IUpdateProductBuilder {
 	return &updateProductBuilder{
-		db:             db,
-		req:            req,
-		filesUsecases:  fileUsecase,
-		queryFields:    make([]string, 0),
-		values:         make([]any, 0),
-		lastStackIndex: 0,
-		cfg:            cfg,
+		db:            db,
+		req:           req,
+		filesUsecases: fileUsecase,
+		sql:           sqlbuilder.New(),
+		cfg:           cfg,
 	}
 }
 
@@ -85,118 +109,60 @@ func (b *updateProductBuilder) initQuery() {
 
 func (b *updateProductBuilder) updateTitleQuery() {
 	if b.req.ProductTitle != "" {
-		b.values = append(b.values, b.req.ProductTitle)
-		b.lastStackIndex = len(b.values)
-
-		b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_title" = $%d`, b.lastStackIndex))
+		b.sql.Set("product_title", b.req.ProductTitle)
 	}
 }
 
 func (b *updateProductBuilder) updateDescriptionQuery() {
 	if b.req.ProductDesc != "" {
-		b.values = append(b.values, b.req.ProductDesc)
-		b.lastStackIndex = len(b.values)
-
-		b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_desc" = $%d`, b.lastStackIndex))
+		b.sql.Set("product_desc", b.req.ProductDesc)
 	}
 }
 
 func (b *updateProductBuilder) updatePriceQuery() {
 	if b.req.ProductPrice != 0 {
-		b.values = append(b.values, b.req.ProductPrice)
-		b.lastStackIndex = len(b.values)
-
-		b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_price" = $%d`, b.lastStackIndex))
+		b.sql.Set("product_price", b.req.ProductPrice)
 	}
 }
 
 func (b *updateProductBuilder) updateCategory() {
 	if b.req.ProductCategory != "" {
-		b.values = append(b.values, b.req.ProductCategory)
-		b.lastStackIndex = len(b.values)
-
-		b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_category" = $%d`, b.lastStackIndex))
+		b.sql.SetExpr("category_id", categoryIdQuery(b.sql.Arg(b.req.ProductCategory)))
 	}
 }
 
 func (b *updateProductBuilder) updateSexQuery() {
 	if b.req.ProductSex != "" {
-		b.values = append(b.values, b.req.ProductSex)
-		b.lastStackIndex = len(b.values)
-
-		b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_sex" = $%d`, b.lastStackIndex))
+		b.sql.Set("product_sex", b.req.ProductSex)
 	}
 }
 
-func (b *updateProductBuilder) updateSizeQuery() {
-	if b.req.ProductSize != "" {
-		b.values = append(b.values, b.req.ProductSize)
-		b.lastStackIndex = len(b.values)
-
-		b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_size" = $%d`, b.lastStackIndex))
+// รูปไม่มี trigger ที่เปลี่ยน version ของสินค้า แก้รูปจึงต้อง update สินค้าด้วยเพื่อให้ ETag เปลี่ยนครั้งเดียว
+func (b *updateProductBuilder) updateImagesQuery() {
+	if len(b.req.Images) > 0 {
+		b.sql.SetExpr("updated_at", "now()")
 	}
 }
 
-func (b *updateProductBuilder) updateColorQuery() {
-	if b.req.ProductColor != "" {
-		b.values = append(b.values, b.req.ProductColor)
-		b.lastStackIndex = len(b.values)
-
-		b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_color" = $%d`, b.lastStackIndex))
-	}
-}
-
-func (b *updateProductBuilder) updateStockQuery() {
-	b.values = append(b.values, b.req.ProductStock)
-	b.lastStackIndex = len(b.values)
-
-	b.queryFields = append(b.queryFields, fmt.Sprintf(`
-		"product_stock" = $%d`, b.lastStackIndex))
-}
-
 func (b *updateProductBuilder) insertImages() error {
-	query := `
-	INSERT INTO "Image" (
-		"filename",
-		"url",
-		"product_id"
-	)
-	VALUES`
-
-	valueStack := make([]any, 0)
-	var index int
-	for i := range b.req.Images {
-		valueStack = append(valueStack,
-			b.req.Images[i].FileName,
-			b.req.Images[i].Url,
-			b.req.Id,
-		)
-
-		if i != len(b.req.Images)-1 {
-			query += fmt.Sprintf(`
-			($%d, $%d, $%d),`, index+1, index+2, index+3)
-		} else {
-			query += fmt.Sprintf(`
-			($%d, $%d, $%d);`, index+1, index+2, index+3)
-		}
-		index += 3
-	}
-
+	query, args := insertImagesQuery(b.req.Id, b.req.Images)
 	if _, err := b.tx.ExecContext(
 		context.Background(),
 		query,
-		valueStack...,
+		args...,
 	); err != nil {
 		b.tx.Rollback()
 		return fmt.Errorf("insert images failed: %v", err)
 	}
+
+	if err := filesRepository.ClaimProductImages(context.Background(), b.tx, b.req.Id); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	if err := filesRepository.AttachUploads(context.Background(), b.tx, b.req.UploadIds); err != nil {
+		b.tx.Rollback()
+		return err
+	}
 	return nil
 }
 
@@ -205,7 +171,10 @@ func (b *updateProductBuilder) getOldImages() []*entities.ImageRes {
 	SELECT
 		"id",
 		"filename",
-		"url"
+		"url",
+		"width",
+		"height",
+		"variants"
 	FROM "Image"
 	WHERE "product_id" = $1;`
 
@@ -225,33 +194,11 @@ func (b *updateProductBuilder) deleteOldImages() error {
 	DELETE FROM "Image"
 	WHERE "product_id" = $1;`
 
-	// images := b.getOldImages()
-	// if len(images) > 0 {
-	// 	deleteFileReq := make([]*files.DeleteFileReq, 0)
-	// 	for _, img := range images {
-	// 		parsedURL, err := url.Parse(img.Url)
-	// 		if err != nil {
-	// 			fmt.Println("Error parsing URL:", err)
-	// 		}
-
-	// 		// Get the path from the parsed URL
-	// 		path := parsedURL.Path
-
-	// 		// Remove the leading '/' character from the path
-	// 		path = strings.TrimPrefix(path, fmt.Sprintf("/%s/", b.cfg.App().GCPBucket()))
-	// 		fmt.Println("path", path)
-	// 		deleteFileReq = append(deleteFileReq, &files.DeleteFileReq{
-	// 			Destination: fmt.Sprint(path),
-	// 		})
-	// 	}
-
-	// 	fmt.Println("deleteFileReq", deleteFileReq)
-
-	// 	if err := b.filesUsecases.DeleteFileOnGCP(deleteFileReq); err != nil {
-	// 		return fmt.Errorf("delete old images failed: %v", err)
-	// 	}
-
-	// }
+	// รูปเก่าจะถูก sweeper ลบหลัง grace period เมื่อ transaction นี้ commit
+	if err := filesRepository.ReleaseAssets(context.Background(), b.tx, files.AssetOwnerProduct, b.req.Id); err != nil {
+		b.tx.Rollback()
+		return err
+	}
 
 	if _, err := b.tx.ExecContext(
 		context.Background(),
@@ -265,35 +212,54 @@ func (b *updateProductBuilder) deleteOldImages() error {
 }
 
 func (b *updateProductBuilder) closeQuery() {
-	b.values = append(b.values, b.req.Id)
-	b.lastStackIndex = len(b.values)
-
-	b.query += fmt.Sprintf(`
-	WHERE "id" = $%d`, b.lastStackIndex)
+	b.query += b.sql.SetClause() + `
+	WHERE "id" = ` + b.sql.Arg(b.req.Id)
 }
 
 func (b *updateProductBuilder) updateProduct() error {
-	if _, err := b.tx.ExecContext(context.Background(), b.query, b.values...); err != nil {
+	if _, err := b.tx.ExecContext(context.Background(), b.query, b.sql.Args()...); err != nil {
 		b.tx.Rollback()
+		if isCategoryNotFound(err) {
+			return fmt.Errorf("category not found")
+		}
 		return fmt.Errorf("update product failed: %v", err)
 	}
 	return nil
 }
 
-func (b *updateProductBuilder) getQueryFields() []string {
-	return b.queryFields
+func (b *updateProductBuilder) hasFields() bool {
+	return b.sql.HasSet()
 }
 
-func (b *updateProductBuilder) getQuery() string {
-	return b.query
+func (b *updateProductBuilder) getImagesLen() int {
+	return len(b.req.Images)
 }
 
-func (b *updateProductBuilder) setQuery(query string) {
-	b.query = query
+func (b *updateProductBuilder) lock() error {
+	if err := LockProduct(context.Background(), b.tx, b.req.Id, b.req.IfMatch); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
 }
 
-func (b *updateProductBuilder) getImagesLen() int {
-	return len(b.req.Images)
+// snapshot เก็บสินค้าก่อนแก้ไว้เทียบตอนบันทึกประวัติ
+func (b *updateProductBuilder) snapshot() error {
+	before, err := SnapshotProduct(context.Background(), b.tx, b.req.Id)
+	if err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	b.before = before
+	return nil
+}
+
+func (b *updateProductBuilder) recordRevision() error {
+	if err := RecordRevision(context.Background(), b.tx, b.req.Id, b.req.ActorId, product.RevisionUpdate, nil, b.before); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
 }
 
 func (b *updateProductBuilder) commit() error {
@@ -305,17 +271,27 @@ func (b *updateProductBuilder) commit() error {
 
 func (en *updateProductEngineer) UpdateProduct() error {
 
-	en.builder.initTransaction()
+	if err := en.builder.initTransaction(); err != nil {
+		return fmt.Errorf("begin transaction failed: %v", err)
+	}
+	// ไม่ wrap error เพื่อให้ handler ตรวจ entities.ErrPreconditionFailed ได้
+	if err := en.builder.lock(); err != nil {
+		return err
+	}
+	if err := en.builder.snapshot(); err != nil {
+		return err
+	}
 	en.builder.initQuery()
 	en.sumQueryFields()
 	en.builder.closeQuery()
 
-	// update product
-	if err := en.builder.updateProduct(); err != nil {
-		return fmt.Errorf("update product failed: %v", err)
+	// update product (size, สี และ stock อยู่ที่ variant แล้ว จึงอาจไม่มี field ให้แก้เลยถ้าไม่ได้แก้รูป)
+	if en.builder.hasFields() {
+		if err := en.builder.updateProduct(); err != nil {
+			return fmt.Errorf("update product failed: %v", err)
+		}
 	}
 
-	fmt.Print("len image XD", en.builder.getImagesLen())
 	if en.builder.getImagesLen() > 0 {
 		// delete old images
 		if err := en.builder.deleteOldImages(); err != nil {
@@ -328,6 +304,10 @@ func (en *updateProductEngineer) UpdateProduct() error {
 		}
 	}
 
+	if err := en.builder.recordRevision(); err != nil {
+		return fmt.Errorf("record revision failed: %v", err)
+	}
+
 	// commit transaction
 	if err := en.builder.commit(); err != nil {
 		return fmt.Errorf("commit failed: %v", err)
@@ -342,19 +322,5 @@ func (en *updateProductEngineer) sumQueryFields() {
 	en.builder.updatePriceQuery()
 	en.builder.updateCategory()
 	en.builder.updateSexQuery()
-	en.builder.updateSizeQuery()
-	en.builder.updateColorQuery()
-	en.builder.updateStockQuery()
-
-	fields := en.builder.getQueryFields()
-
-	for i := range fields {
-		query := en.builder.getQuery()
-		if i != len(fields)-1 {
-			en.builder.setQuery(query + fields[i] + ",")
-		} else {
-			en.builder.setQuery(query + fields[i])
-		}
-	}
-
+	en.builder.updateImagesQuery()
 }
@@ -5,24 +5,47 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productPattern"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/suggest"
 	"github.com/jmoiron/sqlx"
 )
 
 type IProductRepository interface {
-	FindOneProduct(prodId string) (*product.Product, error)
+	FindOneProduct(prodId string, includeHidden bool) (*product.Product, error)
 	InsertProduct(req *product.AddProduct) (*product.Product, error)
-	DeleteProduct(productId string) error
-	FindProduct(req *product.ProductFilter) ([]*product.Product, int)
+	ArchiveProduct(productId, actorId string) error
+	UpdateProductStatus(req *product.ProductStatusReq) (*product.Product, error)
+	FindProduct(req *product.ProductFilter) ([]*product.Product, *entities.Cursors, error)
+	CountProduct(req *product.ProductFilter) int
+	FindProductFacets(req *product.ProductFilter) *product.ProductFacets
+	FindSearchSuggestion(search string) string
+	FindSuggestEntries() ([]*suggest.Entry, error)
 	UpdateProduct(req *product.UpdateProduct) (*product.Product, error)
 	FindImageByProductId(productId string) ([]*entities.ImageRes, error)
-	GetAllProduct() []*product.GetAllProduct
+	GetAllProduct(includeHidden bool) []*product.GetAllProduct
+	FindImagesWithoutVariants(afterId string, limit int) ([]*entities.ImageRes, error)
+	UpdateImageVariants(img *entities.ImageRes) error
+	FindVariant(variantId string) (*product.Variant, error)
+	InsertVariant(req *product.VariantReq) (*product.Variant, error)
+	UpdateVariant(req *product.VariantReq) (*product.Variant, error)
+	DeleteVariant(variantId, actorId string) error
+	FindImportRefs(categories, skus []string) (*product.ImportRefs, error)
+	ImportProducts(products []*product.ImportProduct, actorId string) error
+	ExportProducts(ctx context.Context, fn func(p *product.ImportProduct) error) error
+	FindRevisions(req *product.RevisionFilter) ([]*product.ProductRevision, *entities.Cursors, error)
+	CountRevisions(productId string) int
+	FindRevision(productId string, revisionId int64) (*product.ProductRevision, error)
+	RestoreRevision(productId string, revisionId int64, actorId string) (*product.Product, error)
 }
 
 type productRepository struct {
@@ -37,7 +60,14 @@ func ProductRepository(db *sqlx.DB) IProductRepository {
 	}
 }
 
-func (r *productRepository) FindOneProduct(prodId string) (*product.Product, error) {
+// FindOneProduct includeHidden = false หาเฉพาะสินค้าที่แสดงหน้าร้าน
+func (r *productRepository) FindOneProduct(prodId string, includeHidden bool) (*product.Product, error) {
+	visible := ""
+	if !includeHidden {
+		visible = `
+		AND ` + product.VisibleQuery(`"p"`)
+	}
+
 	query := `
 	SELECT
 		to_jsonb("t")
@@ -47,11 +77,40 @@ func (r *productRepository) FindOneProduct(prodId string) (*product.Product, err
 			"p"."product_title",
 			"p"."product_desc",
 			"p"."product_price",
-			"p"."product_color",
-			"p"."product_size",
 			"p"."product_sex",
-			"p"."product_category",
-			"p"."product_stock",
+			"p"."category_id",
+			"p"."version",
+			` + product.StatusColumns(`"p"`) + `,
+			(
+				SELECT
+					"c"."name"
+				FROM "Category" "c"
+				WHERE "c"."id" = "p"."category_id"
+			) AS "product_category",
+			(
+				SELECT
+					COALESCE(SUM("v"."stock"), 0)
+				FROM "ProductVariant" "v"
+				WHERE "v"."product_id" = "p"."id"
+			) AS "product_stock",
+			(
+				SELECT
+					COALESCE(array_to_json(array_agg("vt")), '[]'::json)
+				FROM (
+					SELECT
+						"v"."id",
+						"v"."product_id",
+						"v"."sku",
+						"v"."size",
+						"v"."color",
+						"v"."stock",
+						COALESCE("v"."price", "p"."product_price") AS "price",
+						"v"."price" AS "price_override"
+					FROM "ProductVariant" "v"
+					WHERE "v"."product_id" = "p"."id"
+					ORDER BY "v"."id"
+				) AS "vt"
+			) AS "variants",
 			(
 				SELECT
 					COALESCE(array_to_json(array_agg("it")), '[]'::json)
@@ -59,13 +118,16 @@ func (r *productRepository) FindOneProduct(prodId string) (*product.Product, err
 					SELECT
 						"i"."id",
 						"i"."filename",
-						"i"."url"
+						"i"."url",
+						"i"."width",
+						"i"."height",
+						"i"."variants"
 					FROM "Image" "i"
 					WHERE "i"."product_id" = "p"."id"
 				) AS "it"
 			) AS "images"
 		FROM "Product" "p"
-		WHERE "p"."id" = $1
+		WHERE "p"."id" = $1` + visible + `
 		LIMIT 1
 	) AS "t";
 	`
@@ -104,7 +166,7 @@ func (r *productRepository) InsertProduct(req *product.AddProduct) (*product.Pro
 		return nil, fmt.Errorf("insert product failed: %v", err)
 	}
 
-	product, err := r.FindOneProduct(productId)
+	product, err := r.FindOneProduct(productId, true)
 	if err != nil {
 		return nil, fmt.Errorf("find product failed: %v", err)
 	}
@@ -121,7 +183,7 @@ func (r *productRepository) UpdateProduct(req *product.UpdateProduct) (*product.
 		return nil, err
 	}
 
-	product, err := r.FindOneProduct(req.Id)
+	product, err := r.FindOneProduct(req.Id, true)
 	if err != nil {
 		return nil, err
 	}
@@ -129,28 +191,194 @@ func (r *productRepository) UpdateProduct(req *product.UpdateProduct) (*product.
 
 }
 
-func (r *productRepository) DeleteProduct(productId string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15) // Timeout of 15 seconds
+// ArchiveProduct เลิกขายสินค้าแทนการลบ ตะกร้า wishlist และ order ที่อ้างถึงยังอยู่
+// รูปยังผูกกับสินค้าเพราะเปลี่ยนสถานะกลับมาขายได้
+func (r *productRepository) ArchiveProduct(productId, actorId string) error {
+	query := `
+	UPDATE "Product" SET
+		"status" = 'archived'
+	WHERE "id" = $1;`
+
+	return r.withRevision(productId, actorId, product.RevisionDelete, nil, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, productId); err != nil {
+			return fmt.Errorf("archive product failed: %v", err)
+		}
+		return nil
+	})
+}
+
+func (r *productRepository) UpdateProductStatus(req *product.ProductStatusReq) (*product.Product, error) {
+	query := `
+	UPDATE "Product" SET
+		"status" = $1,
+		"publish_at" = $2,
+		"unpublish_at" = $3
+	WHERE "id" = $4;`
+
+	if err := r.withRevision(req.Id, req.ActorId, product.RevisionUpdate, nil, req.IfMatch, func(ctx context.Context, tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, req.Status, req.PublishTime, req.UnpublishTime, req.Id); err != nil {
+			return fmt.Errorf("update product status failed: %v", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return r.FindOneProduct(req.Id, true)
+}
+
+// withRevision ทำ fn ใน transaction แล้วบันทึกประวัติของสินค้าใน transaction เดียวกัน
+// สินค้าไม่มีอยู่ได้ error "product not found" ก่อนเรียก fn
+// สินค้าถูก lock ตลอด transaction ถ้า version ไม่ตรงกับ pre ได้ entities.ErrPreconditionFailed
+func (r *productRepository) withRevision(productId, actorId, action string, restoredFrom *int64, pre *entities.Precondition, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
-	query := `DELETE FROM "Product" WHERE "id" = $1;`
 
-	if _, err := r.db.ExecContext(ctx, query, productId); err != nil {
-		return fmt.Errorf("delete product failed: %v", err)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %v", err)
 	}
+	defer tx.Rollback()
 
+	if err := productPattern.LockProduct(ctx, tx, productId, pre); err != nil {
+		return err
+	}
+	before, err := productPattern.SnapshotProduct(ctx, tx, productId)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	if err := productPattern.RecordRevision(ctx, tx, productId, actorId, action, restoredFrom, before); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %v", err)
+	}
 	return nil
 }
 
-func (r *productRepository) FindProduct(req *product.ProductFilter) ([]*product.Product, int) {
-	builder := productPattern.FindProductBuilder(r.db, req)
+func (r *productRepository) FindProduct(req *product.ProductFilter) ([]*product.Product, *entities.Cursors, error) {
+	keyset, err := productPattern.ProductKeyset(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	builder := productPattern.FindProductBuilder(r.db, req, keyset)
 	engineer := productPattern.FindProductEngineer(builder)
 
 	result := engineer.FindProduct().Result()
-	count := engineer.CountProduct().Count()
+	return result, builder.Cursors(), nil
+}
+
+func (r *productRepository) CountProduct(req *product.ProductFilter) int {
+	builder := productPattern.FindProductBuilder(r.db, req, nil)
+	engineer := productPattern.FindProductEngineer(builder)
+
+	return engineer.CountProduct().Count()
+}
+
+func (r *productRepository) FindProductFacets(req *product.ProductFilter) *product.ProductFacets {
+	builder := productPattern.FindProductBuilder(r.db, req, nil)
+	engineer := productPattern.FindProductEngineer(builder)
+
+	return engineer.FacetProduct().Facets()
+}
+
+// FindSearchSuggestion แก้คำค้นทีละคำเป็นคำในชื่อสินค้าที่ใกล้เคียงที่สุด
+// คืนค่าว่างถ้าไม่มีคำไหนต้องแก้ (ภาษาไทยไม่มีคำให้เทียบเพราะตัดคำไม่ได้)
+func (r *productRepository) FindSearchSuggestion(search string) string {
+	words := `SELECT to_tsvector('simple', "p"."product_title") FROM "Product" "p" WHERE ` + product.VisibleQuery(`"p"`)
+	query := `
+	SELECT
+		"word"
+	FROM ts_stat('` + strings.ReplaceAll(words, "'", "''") + `')
+	WHERE similarity("word", $1) >= 0.3
+	ORDER BY similarity("word", $1) DESC, "nentry" DESC
+	LIMIT 1;`
+
+	terms := strings.Fields(strings.ToLower(search))
+	changed := false
+	for i, term := range terms {
+		if product.IsThai(term) {
+			continue
+		}
 
-	engineer.FindProduct().PrintQuery()
+		var word string
+		if err := r.db.Get(&word, query, term); err != nil {
+			continue
+		}
+		if word != term {
+			terms[i] = word
+			changed = true
+		}
+	}
+
+	if !changed {
+		return ""
+	}
+	return strings.Join(terms, " ")
+}
+
+// FindSuggestEntries ชื่อสินค้าและชื่อหมวดพร้อมความนิยมสำหรับ index ของ autocomplete
+// ความนิยมของสินค้าคือจำนวนชิ้นที่ขายได้ ของหมวดคือยอดขายรวมบวกจำนวนสินค้าในหมวด
+// ยังไม่มี brand ในตาราง "Product" จึงมีแค่ title และ category
+func (r *productRepository) FindSuggestEntries() ([]*suggest.Entry, error) {
+	query := `
+	WITH "sold" AS (
+		SELECT
+			"e"->>'id' AS "product_id",
+			SUM(COALESCE(("e"->>'qty')::INT, 1)) AS "qty"
+		FROM "Order" "o",
+		jsonb_array_elements(
+			CASE WHEN jsonb_typeof("o"."products"->'Products') = 'array'
+			THEN "o"."products"->'Products' ELSE '[]'::jsonb END
+		) AS "e"
+		GROUP BY "e"->>'id'
+	)
+	SELECT
+		'title' AS "type",
+		"p"."product_title" AS "value",
+		"p"."id" AS "ref",
+		COALESCE("s"."qty", 0) AS "popularity"
+	FROM "Product" "p"
+	LEFT JOIN "sold" "s" ON "s"."product_id" = "p"."id"
+	WHERE ` + product.VisibleQuery(`"p"`) + `
+	UNION ALL
+	SELECT
+		'category',
+		"c"."name",
+		"c"."slug",
+		COALESCE(SUM("s"."qty"), 0) + COUNT("p"."id")
+	FROM "Category" "c"
+	JOIN "Product" "p" ON "p"."category_id" = "c"."id"
+	LEFT JOIN "sold" "s" ON "s"."product_id" = "p"."id"
+	WHERE "c"."is_active" = TRUE
+	AND ` + product.VisibleQuery(`"p"`) + `
+	GROUP BY "c"."id", "c"."name", "c"."slug";`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("find suggest entries failed: %v", err)
+	}
+	defer rows.Close()
 
-	return result, count
+	entries := make([]*suggest.Entry, 0)
+	for rows.Next() {
+		e := new(suggest.Entry)
+		if err := rows.Scan(&e.Type, &e.Value, &e.Ref, &e.Popularity); err != nil {
+			return nil, fmt.Errorf("scan suggest entry failed: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find suggest entries failed: %v", err)
+	}
+	return entries, nil
 }
 
 func (r *productRepository) FindImageByProductId(productId string) ([]*entities.ImageRes, error) {
@@ -158,7 +386,10 @@ func (r *productRepository) FindImageByProductId(productId string) ([]*entities.
 	SELECT
 		"id",
 		"filename",
-		"url"
+		"url",
+		"width",
+		"height",
+		"variants"
 	FROM "Image"
 	WHERE "product_id" = $1;`
 
@@ -169,38 +400,74 @@ func (r *productRepository) FindImageByProductId(productId string) ([]*entities.
 	return images, nil
 }
 
-func (r *productRepository) GetAllProduct() []*product.GetAllProduct {
+func (r *productRepository) GetAllProduct(includeHidden bool) []*product.GetAllProduct {
+	visible := ""
+	if !includeHidden {
+		visible = `
+		WHERE ` + product.VisibleQuery(`"p"`)
+	}
+
 	query := `
 	SELECT
-                array_to_json(array_agg("t"))
-        FROM (
-                SELECT
-                        MAX("p"."id") AS "id",
-                        "p"."product_title",
-                        MAX("p"."product_desc") AS "product_desc",
-                        MAX("p"."product_price") AS "product_price",
-                        MAX("p"."product_color") AS "product_color",
-                        jsonb_agg(DISTINCT "p"."product_size") AS "product_size",
-                        MAX("p"."product_sex") AS "product_sex",
-                        MAX("p"."product_category") AS "product_category",
-                        MAX("p"."product_stock") AS "product_stock",
-						MAX("p"."created_at") AS "created_at",
-                        (
-                                SELECT
-                                        COALESCE(array_to_json(array_agg("it")), '[]'::json)
-                                FROM (
-                                        SELECT
-                                                "i"."id",
-                                                "i"."filename",
-                                                "i"."url"
-                                        FROM "Image" "i"
-                                        WHERE "i"."product_id" = MAX("p"."id")
-                                ) AS "it"
-                        ) AS "images"
-                FROM "Product" "p"
-                WHERE 1 = 1
-                GROUP BY "p"."product_title"
-        ) AS "t";`
+		COALESCE(array_to_json(array_agg("t")), '[]'::json)
+	FROM (
+		SELECT
+			"p"."id",
+			"p"."product_title",
+			"p"."product_desc",
+			"p"."product_price",
+			"p"."product_sex",
+			"p"."category_id",
+			` + product.StatusColumns(`"p"`) + `,
+			(
+				SELECT
+					"c"."name"
+				FROM "Category" "c"
+				WHERE "c"."id" = "p"."category_id"
+			) AS "product_category",
+			"p"."created_at",
+			(
+				SELECT
+					COALESCE(SUM("v"."stock"), 0)
+				FROM "ProductVariant" "v"
+				WHERE "v"."product_id" = "p"."id"
+			) AS "product_stock",
+			(
+				SELECT
+					COALESCE(array_to_json(array_agg("vt")), '[]'::json)
+				FROM (
+					SELECT
+						"v"."id",
+						"v"."product_id",
+						"v"."sku",
+						"v"."size",
+						"v"."color",
+						"v"."stock",
+						COALESCE("v"."price", "p"."product_price") AS "price",
+						"v"."price" AS "price_override"
+					FROM "ProductVariant" "v"
+					WHERE "v"."product_id" = "p"."id"
+					ORDER BY "v"."id"
+				) AS "vt"
+			) AS "variants",
+			(
+				SELECT
+					COALESCE(array_to_json(array_agg("it")), '[]'::json)
+				FROM (
+					SELECT
+						"i"."id",
+						"i"."filename",
+						"i"."url",
+						"i"."width",
+						"i"."height",
+						"i"."variants"
+					FROM "Image" "i"
+					WHERE "i"."product_id" = "p"."id"
+				) AS "it"
+			) AS "images"
+		FROM "Product" "p"` + visible + `
+		ORDER BY "p"."id"
+	) AS "t";`
 
 	bytes := make([]byte, 0)
 	productsData := make([]*product.GetAllProduct, 0)
@@ -218,3 +485,459 @@ func (r *productRepository) GetAllProduct() []*product.GetAllProduct {
 	return productsData
 
 }
+
+// FindImagesWithoutVariants หารูปที่ยังไม่มีรูปย่อ ไล่ตาม id ทีละ limit รูป ใช้ตอน backfill
+func (r *productRepository) FindImagesWithoutVariants(afterId string, limit int) ([]*entities.ImageRes, error) {
+	query := `
+	SELECT
+		"id",
+		"filename",
+		"url",
+		"width",
+		"height",
+		"variants"
+	FROM "Image"
+	WHERE "variants" = '{}'::jsonb
+	AND "id"::TEXT > $1
+	ORDER BY "id"::TEXT
+	LIMIT $2;`
+
+	images := make([]*entities.ImageRes, 0)
+	if err := r.db.Select(&images, query, afterId, limit); err != nil {
+		return nil, fmt.Errorf("find images failed: %v", err)
+	}
+	return images, nil
+}
+
+// UpdateImageVariants บันทึกรูปย่อแล้วผูกไฟล์รูปย่อกับสินค้าใน transaction เดียวกัน
+// รูปย่อที่เพิ่ง upload ยัง orphaned อยู่ ถ้าไม่ผูก sweeper จะลบทิ้งหลัง grace period
+func (r *productRepository) UpdateImageVariants(img *entities.ImageRes) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	query := `
+	UPDATE "Image" SET
+		"width" = $1,
+		"height" = $2,
+		"variants" = $3
+	WHERE "id" = $4
+	RETURNING "product_id";`
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %v", err)
+	}
+
+	var productId string
+	if err := tx.QueryRowxContext(ctx, query, img.Width, img.Height, img.Variants, img.Id).Scan(&productId); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update image variants failed: %v", err)
+	}
+	if err := filesRepository.ClaimProductImages(ctx, tx, productId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %v", err)
+	}
+	return nil
+}
+
+func (r *productRepository) FindVariant(variantId string) (*product.Variant, error) {
+	query := `
+	SELECT
+		"v"."id",
+		"v"."product_id",
+		"v"."sku",
+		"v"."size",
+		"v"."color",
+		"v"."stock",
+		COALESCE("v"."price", "p"."product_price") AS "price",
+		"v"."price" AS "price_override"
+	FROM "ProductVariant" "v"
+	JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+	WHERE "v"."id" = $1;`
+
+	variant := new(product.Variant)
+	if err := r.db.Get(variant, query, variantId); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return nil, fmt.Errorf("variant not found")
+		default:
+			return nil, fmt.Errorf("get variant failed: %v", err)
+		}
+	}
+	return variant, nil
+}
+
+func (r *productRepository) InsertVariant(req *product.VariantReq) (*product.Variant, error) {
+	if req.Sku == "" {
+		req.Sku = product.DefaultSku(req.ProductId, req.Size, req.Color)
+	}
+
+	query := `
+	INSERT INTO "ProductVariant" (
+		"product_id",
+		"sku",
+		"size",
+		"color",
+		"price"
+	)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING "id";`
+
+	// สร้างด้วย stock 0 แล้วบันทึก stock เริ่มต้นลง ledger
+	if err := r.withRevision(req.ProductId, req.ActorId, product.RevisionUpdate, nil, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		if err := tx.QueryRowxContext(ctx, query, req.ProductId, req.Sku, req.Size, req.Color, req.PriceOverride).Scan(&req.Id); err != nil {
+			return variantErr("insert variant failed", err)
+		}
+		return inventoryRepository.SetStock(ctx, tx, req.Id, req.Stock, req.ActorId, "initial stock")
+	}); err != nil {
+		return nil, err
+	}
+	return r.FindVariant(req.Id)
+}
+
+func (r *productRepository) UpdateVariant(req *product.VariantReq) (*product.Variant, error) {
+	variant, err := r.FindVariant(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	UPDATE "ProductVariant" SET
+		"sku" = COALESCE(NULLIF($1, ''), "sku"),
+		"size" = $2,
+		"color" = $3,
+		"price" = $4
+	WHERE "id" = $5;`
+
+	// stock ไม่อยู่ในประวัติ แก้แค่ stock จึงไม่มี revision ใหม่ แต่ส่วนต่างถูกบันทึกลง ledger
+	if err := r.withRevision(variant.ProductId, req.ActorId, product.RevisionUpdate, nil, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, query, req.Sku, req.Size, req.Color, req.PriceOverride, req.Id)
+		if err != nil {
+			return variantErr("update variant failed", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("variant not found")
+		}
+		return inventoryRepository.SetStock(ctx, tx, req.Id, req.Stock, req.ActorId, "variant update")
+	}); err != nil {
+		return nil, err
+	}
+	return r.FindVariant(req.Id)
+}
+
+// DeleteVariant ลบ variant ตะกร้าและ wishlist ที่อ้างถึงจะถูกลบตาม cascade
+// สินค้าต้องเหลืออย่างน้อย 1 variant
+func (r *productRepository) DeleteVariant(variantId, actorId string) error {
+	variant, err := r.FindVariant(variantId)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	DELETE FROM "ProductVariant" "v"
+	WHERE "v"."id" = $1
+	AND EXISTS (
+		SELECT 1 FROM "ProductVariant" "o"
+		WHERE "o"."product_id" = "v"."product_id"
+		AND "o"."id" <> "v"."id"
+	);`
+
+	return r.withRevision(variant.ProductId, actorId, product.RevisionUpdate, nil, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		if err := inventoryRepository.WriteOffVariants(ctx, tx, []string{variantId}, actorId, "variant deleted"); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, query, variantId)
+		if err != nil {
+			return fmt.Errorf("delete variant failed: %v", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("product must have at least one variant")
+		}
+		return nil
+	})
+}
+
+func variantErr(msg string, err error) error {
+	switch {
+	case strings.Contains(err.Error(), "ProductVariant_sku_key"):
+		return fmt.Errorf("sku already exists")
+	case strings.Contains(err.Error(), "ProductVariant_product_id_size_color_key"):
+		return fmt.Errorf("variant with this size and color already exists")
+	case strings.Contains(err.Error(), "ProductVariant_product_id_fkey"):
+		return fmt.Errorf("product not found")
+	default:
+		return fmt.Errorf("%s: %v", msg, err)
+	}
+}
+
+// FindImportRefs หาหมวดที่มีอยู่จริงและสินค้าที่เป็นเจ้าของ sku สำหรับตรวจไฟล์ import ก่อนบันทึก
+func (r *productRepository) FindImportRefs(categories, skus []string) (*product.ImportRefs, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	refs := &product.ImportRefs{
+		Categories: make(map[string]bool),
+		SkuOwners:  make(map[string]*product.ImportSkuOwner),
+	}
+
+	found := make([]string, 0)
+	if err := r.db.SelectContext(ctx, &found, productPattern.ImportCategoryQuery(), categories); err != nil {
+		return nil, fmt.Errorf("find import categories failed: %v", err)
+	}
+	for _, c := range found {
+		refs.Categories[strings.ToLower(c)] = true
+	}
+
+	query := `
+	SELECT
+		"v"."sku",
+		"p"."id",
+		"p"."product_title"
+	FROM "ProductVariant" "v"
+	JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+	WHERE "v"."sku" = ANY($1);`
+
+	owners := make([]*product.ImportSkuOwner, 0)
+	if err := r.db.SelectContext(ctx, &owners, query, skus); err != nil {
+		return nil, fmt.Errorf("find import skus failed: %v", err)
+	}
+	for _, o := range owners {
+		refs.SkuOwners[o.Sku] = o
+	}
+	return refs, nil
+}
+
+func (r *productRepository) ImportProducts(products []*product.ImportProduct, actorId string) error {
+	builder := productPattern.ImportProductBuilder(context.Background(), r.db, actorId)
+	if err := productPattern.ImportProductEngineer(builder).ImportProducts(products); err != nil {
+		return fmt.Errorf("import products failed: %v", err)
+	}
+	return nil
+}
+
+// ExportProducts อ่านสินค้าทั้งหมดพร้อม variant และรูปทีละแถว แล้วส่งให้ fn ทีละสินค้า
+// ไม่โหลดทั้ง catalog เข้า memory
+func (r *productRepository) ExportProducts(ctx context.Context, fn func(p *product.ImportProduct) error) error {
+	query := `
+	SELECT
+		"p"."id",
+		"p"."product_title",
+		"p"."product_desc",
+		"p"."product_price",
+		"p"."product_sex",
+		COALESCE("c"."slug", '') AS "product_category",
+		"p"."status",
+		COALESCE((
+			SELECT
+				array_to_json(array_agg("i"."url" ORDER BY "i"."created_at", "i"."id"))
+			FROM "Image" "i"
+			WHERE "i"."product_id" = "p"."id"
+		), '[]'::json) AS "images",
+		"v"."sku",
+		"v"."size",
+		"v"."color",
+		"v"."stock",
+		"v"."price" AS "price_override"
+	FROM "Product" "p"
+	LEFT JOIN "Category" "c" ON "c"."id" = "p"."category_id"
+	JOIN "ProductVariant" "v" ON "v"."product_id" = "p"."id"
+	ORDER BY "p"."id", "v"."id";`
+
+	rows, err := r.db.QueryxContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("export products failed: %v", err)
+	}
+	defer rows.Close()
+
+	var current *product.ImportProduct
+	for rows.Next() {
+		row := new(exportRow)
+		if err := rows.StructScan(row); err != nil {
+			return fmt.Errorf("scan export product failed: %v", err)
+		}
+
+		if current == nil || current.Id != row.Id {
+			if current != nil {
+				if err := fn(current); err != nil {
+					return err
+				}
+			}
+			current = &product.ImportProduct{
+				Id:              row.Id,
+				ProductTitle:    row.ProductTitle,
+				ProductDesc:     row.ProductDesc,
+				ProductPrice:    row.ProductPrice,
+				ProductSex:      row.ProductSex,
+				ProductCategory: row.ProductCategory,
+				Status:          row.Status,
+				Images:          make([]string, 0),
+				Variants:        make([]*product.ImportVariant, 0),
+			}
+			if err := json.Unmarshal(row.Images, &current.Images); err != nil {
+				return fmt.Errorf("unmarshal export images failed: %v", err)
+			}
+		}
+
+		v := new(product.ImportVariant)
+		v.Sku = row.Sku
+		v.Size = row.Size
+		v.Color = row.Color
+		v.Stock = row.Stock
+		v.PriceOverride = row.PriceOverride
+		current.Variants = append(current.Variants, v)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("export products failed: %v", err)
+	}
+	if current != nil {
+		return fn(current)
+	}
+	return nil
+}
+
+// exportRow หนึ่ง variant ของสินค้าใน export
+type exportRow struct {
+	Id              string   `db:"id"`
+	ProductTitle    string   `db:"product_title"`
+	ProductDesc     string   `db:"product_desc"`
+	ProductPrice    float64  `db:"product_price"`
+	ProductSex      string   `db:"product_sex"`
+	ProductCategory string   `db:"product_category"`
+	Status          string   `db:"status"`
+	Images          []byte   `db:"images"`
+	Sku             string   `db:"sku"`
+	Size            string   `db:"size"`
+	Color           string   `db:"color"`
+	Stock           int      `db:"stock"`
+	PriceOverride   *float64 `db:"price_override"`
+}
+
+// revisionColumns คอลัมน์ของ "ProductRevision" "r" พร้อม email ของผู้แก้ไข (ต้อง LEFT JOIN "User" "u")
+const revisionColumns = `
+			"r"."id",
+			"r"."product_id",
+			"r"."actor_id",
+			"u"."email" AS "actor_email",
+			"r"."action",
+			"r"."restored_from",
+			"r"."diff",
+			"r"."created_at"`
+
+// FindRevisions ประวัติของสินค้า ใหม่สุดก่อน ไม่มี snapshot
+func (r *productRepository) FindRevisions(req *product.RevisionFilter) ([]*product.ProductRevision, *entities.Cursors, error) {
+	keyset, err := entities.NewKeyset("revision", true, req.Cursor, &entities.KeysetColumn{Expr: `"r"."id"`, Cast: "BIGINT"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := sqlbuilder.New()
+	b.Where(`"r"."product_id" = ?`, req.ProductId)
+	b.WhereExpr(keyset.Condition(b))
+
+	query := fmt.Sprintf(`
+	SELECT
+		COALESCE(array_to_json(array_agg("t")), '[]'::json)
+	FROM (
+		SELECT%s,
+			%s AS "cursor_values"
+		FROM "ProductRevision" "r"
+		LEFT JOIN "User" "u" ON "u"."id" = "r"."actor_id"
+		WHERE 1 = 1%s
+		ORDER BY %s%s
+	) AS "t";`, revisionColumns, keyset.Select(), b.Conditions(), keyset.OrderBy(), keyset.Limit(b, req.Page, req.Limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	raw := make([]byte, 0)
+	if err := r.db.GetContext(ctx, &raw, query, b.Args()...); err != nil {
+		return nil, nil, fmt.Errorf("find product revisions failed: %v", err)
+	}
+
+	rows := make([]*revisionRow, 0)
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal product revisions failed: %v", err)
+	}
+
+	rows, cursors := entities.KeysetPage(keyset, rows, req.Limit, (req.Page-1)*req.Limit, func(r *revisionRow) []string {
+		return r.CursorValues
+	})
+
+	revisions := make([]*product.ProductRevision, 0, len(rows))
+	for _, r := range rows {
+		revisions = append(revisions, &r.ProductRevision)
+	}
+	return revisions, cursors, nil
+}
+
+// revisionRow revision หนึ่งแถวพร้อมค่าของ sort key สำหรับสร้าง cursor
+type revisionRow struct {
+	product.ProductRevision
+	CursorValues []string `json:"cursor_values"`
+}
+
+func (r *productRepository) CountRevisions(productId string) int {
+	query := `
+	SELECT
+		COUNT(*)
+	FROM "ProductRevision"
+	WHERE "product_id" = $1;`
+
+	var count int
+	if err := r.db.Get(&count, query, productId); err != nil {
+		log.Printf("count product revisions failed: %v", err)
+		return 0
+	}
+	return count
+}
+
+// FindRevision revision ของสินค้าพร้อม snapshot
+func (r *productRepository) FindRevision(productId string, revisionId int64) (*product.ProductRevision, error) {
+	query := `
+	SELECT
+		row_to_json("t")
+	FROM (
+		SELECT` + revisionColumns + `,
+			"r"."snapshot"
+		FROM "ProductRevision" "r"
+		LEFT JOIN "User" "u" ON "u"."id" = "r"."actor_id"
+		WHERE "r"."product_id" = $1
+		AND "r"."id" = $2
+	) AS "t";`
+
+	raw := make([]byte, 0)
+	if err := r.db.Get(&raw, query, productId, revisionId); err != nil {
+		switch err.Error() {
+		case "sql: no rows in result set":
+			return nil, fmt.Errorf("revision not found")
+		default:
+			return nil, fmt.Errorf("get product revision failed: %v", err)
+		}
+	}
+
+	revision := new(product.ProductRevision)
+	if err := json.Unmarshal(raw, revision); err != nil {
+		return nil, fmt.Errorf("unmarshal product revision failed: %v", err)
+	}
+	return revision, nil
+}
+
+// RestoreRevision แก้สินค้ากลับเป็น snapshot ของ revision แล้วบันทึกเป็น revision "restore" ใหม่
+// ประวัติเดิมไม่ถูกลบ stock ของ variant ไม่เปลี่ยน
+func (r *productRepository) RestoreRevision(productId string, revisionId int64, actorId string) (*product.Product, error) {
+	revision, err := r.FindRevision(productId, revisionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.withRevision(productId, actorId, product.RevisionRestore, &revision.Id, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		return productPattern.RestoreSnapshot(ctx, tx, productId, actorId, revision.Snapshot)
+	}); err != nil {
+		return nil, err
+	}
+	return r.FindOneProduct(productId, true)
+}
@@ -1,46 +1,68 @@
 package productUsecase
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"math"
+	"strconv"
+	"strings"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/suggest"
 )
 
 type IProductUsecase interface {
-	FindOneProduct(prodId string) (*product.Product, error)
+	FindOneProduct(prodId string, includeHidden bool) (*product.Product, error)
 	AddProduct(req *product.AddProduct) (*product.Product, error)
-	DeleteProduct(prodId string) (string, error)
-	FindProduct(req *product.ProductFilter) *entities.PaginateRes
+	DeleteProduct(prodId, actorId string) (string, error)
+	FindProduct(req *product.ProductFilter) (*entities.PaginateRes, error)
 	UpdateProduct(req *product.UpdateProduct) (*product.Product, error)
+	UpdateProductStatus(req *product.ProductStatusReq) (*product.Product, error)
 	FindImageByProductId(productId string) ([]*entities.ImageRes, error)
-	GetAllProduct() []*product.GetAllProduct
+	GetAllProduct(includeHidden bool) []*product.GetAllProduct
+	AddVariant(req *product.VariantReq) (*product.Variant, error)
+	UpdateVariant(req *product.VariantReq) (*product.Variant, error)
+	DeleteVariant(variantId, actorId string) (string, error)
+	Suggest(q string, limit int) []*suggest.Entry
+	RefreshSuggestIndex() error
+	SuggestIndexStale() <-chan struct{}
+	ImportProducts(r io.Reader, format string, dryRun bool, actorId string) (*product.ImportReport, error)
+	ExportProducts(ctx context.Context, w io.Writer, format string) error
+	FindRevisions(req *product.RevisionFilter) (*entities.PaginateRes, error)
+	FindRevision(productId, revisionId string) (*product.ProductRevision, error)
+	RestoreRevision(productId, revisionId, actorId string) (*product.Product, error)
 }
 
 type productUsecase struct {
 	cfg                config.IConfig
 	productsRepository productRepository.IProductRepository
+	suggest            suggest.IIndex
+	suggestStale       chan struct{} // มีสัญญาณเมื่อสินค้าเปลี่ยนและ index ต้องสร้างใหม่
 }
 
 func ProductUsecase(productsRepository productRepository.IProductRepository, cfg config.IConfig) IProductUsecase {
 	return &productUsecase{
 		productsRepository: productsRepository,
 		cfg:                cfg,
+		suggest:            suggest.NewIndex(),
+		suggestStale:       make(chan struct{}, 1),
 	}
 }
 
-func (u *productUsecase) FindOneProduct(prodId string) (*product.Product, error) {
-	result, err := u.productsRepository.FindOneProduct(prodId)
+func (u *productUsecase) FindOneProduct(prodId string, includeHidden bool) (*product.Product, error) {
+	result, err := u.productsRepository.FindOneProduct(prodId, includeHidden)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (u *productUsecase) FindProduct(req *product.ProductFilter) *entities.PaginateRes {
-	if req.Page < 1 {
+func (u *productUsecase) FindProduct(req *product.ProductFilter) (*entities.PaginateRes, error) {
+	if req.Page < 1 || req.Cursor != "" {
 		req.Page = 1
 	}
 	if req.Limit < 3 {
@@ -49,20 +71,49 @@ func (u *productUsecase) FindProduct(req *product.ProductFilter) *entities.Pagin
 
 	if req.OrderBy == "" {
 		req.OrderBy = "title"
+		if strings.TrimSpace(req.Search) != "" {
+			req.OrderBy = "relevance"
+		}
 	}
 	if req.Sort == "" {
-		req.Sort = "ASC"
+		// ใหม่สุด ขายดีสุด และตรงคำค้นที่สุดขึ้นก่อน
+		switch strings.ToLower(req.OrderBy) {
+		case "newest", "popularity", "relevance":
+			req.Sort = "DESC"
+		default:
+			req.Sort = "ASC"
+		}
 	}
 
-	products, count := u.productsRepository.FindProduct(req)
-	return &entities.PaginateRes{
-		Data:      products,
-		TotalItem: count,
-		Page:      req.Page,
-		Limit:     req.Limit,
-		TotalPage: int(math.Ceil(float64(count) / float64(req.Limit))),
+	products, cursors, err := u.productsRepository.FindProduct(req)
+	if err != nil {
+		return nil, err
+	}
+	facets := u.productsRepository.FindProductFacets(req)
+
+	var suggestion string
+	if len(products) == 0 && req.Cursor == "" && strings.TrimSpace(req.Search) != "" {
+		suggestion = u.productsRepository.FindSearchSuggestion(req.Search)
 	}
 
+	res := &entities.PaginateRes{
+		Data:       products,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		Facets:     facets,
+		Suggestion: suggestion,
+		NextCursor: cursors.Next,
+		PrevCursor: cursors.Prev,
+	}
+	if req.Cursor != "" {
+		// หน้าแบบ cursor ไม่มีเลขหน้า
+		res.Page = 0
+	}
+	if req.CountTotal() {
+		res.TotalItem = u.productsRepository.CountProduct(req)
+		res.TotalPage = int(math.Ceil(float64(res.TotalItem) / float64(req.Limit)))
+	}
+	return res, nil
 }
 
 func (u *productUsecase) AddProduct(req *product.AddProduct) (*product.Product, error) {
@@ -70,15 +121,30 @@ func (u *productUsecase) AddProduct(req *product.AddProduct) (*product.Product,
 	if err != nil {
 		return nil, err
 	}
+	u.markSuggestStale()
 	return product, nil
 }
 
-func (u *productUsecase) DeleteProduct(prodId string) (string, error) {
-	if err := u.productsRepository.DeleteProduct(prodId); err != nil {
+// DeleteProduct เปลี่ยนสถานะเป็น archived แทนการลบ
+func (u *productUsecase) DeleteProduct(prodId, actorId string) (string, error) {
+	if err := u.productsRepository.ArchiveProduct(prodId, actorId); err != nil {
 		return "", err
 	}
 
-	return "Product deleted", nil
+	u.markSuggestStale()
+	return "Product archived", nil
+}
+
+func (u *productUsecase) UpdateProductStatus(req *product.ProductStatusReq) (*product.Product, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	product, err := u.productsRepository.UpdateProductStatus(req)
+	if err != nil {
+		return nil, err
+	}
+	u.markSuggestStale()
+	return product, nil
 }
 
 func (u *productUsecase) UpdateProduct(req *product.UpdateProduct) (*product.Product, error) {
@@ -86,6 +152,7 @@ func (u *productUsecase) UpdateProduct(req *product.UpdateProduct) (*product.Pro
 	if err != nil {
 		return nil, err
 	}
+	u.markSuggestStale()
 	return product, nil
 }
 
@@ -97,7 +164,219 @@ func (u *productUsecase) FindImageByProductId(productId string) ([]*entities.Ima
 	return result, nil
 }
 
-func (u *productUsecase) GetAllProduct() []*product.GetAllProduct {
-	result := u.productsRepository.GetAllProduct()
+func (u *productUsecase) GetAllProduct(includeHidden bool) []*product.GetAllProduct {
+	result := u.productsRepository.GetAllProduct(includeHidden)
 	return result
 }
+
+func (u *productUsecase) AddVariant(req *product.VariantReq) (*product.Variant, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.productsRepository.InsertVariant(req)
+}
+
+func (u *productUsecase) UpdateVariant(req *product.VariantReq) (*product.Variant, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return u.productsRepository.UpdateVariant(req)
+}
+
+func (u *productUsecase) DeleteVariant(variantId, actorId string) (string, error) {
+	if err := u.productsRepository.DeleteVariant(variantId, actorId); err != nil {
+		return "", err
+	}
+	return "Variant deleted", nil
+}
+
+func (u *productUsecase) Suggest(q string, limit int) []*suggest.Entry {
+	return u.suggest.Search(q, limit)
+}
+
+func (u *productUsecase) RefreshSuggestIndex() error {
+	entries, err := u.productsRepository.FindSuggestEntries()
+	if err != nil {
+		return err
+	}
+	u.suggest.Replace(entries)
+	return nil
+}
+
+func (u *productUsecase) SuggestIndexStale() <-chan struct{} {
+	return u.suggestStale
+}
+
+// ไม่ block ถ้ามีสัญญาณค้างอยู่แล้ว การสร้างใหม่ครั้งเดียวครอบคลุมทุกการเปลี่ยนแปลงก่อนหน้า
+func (u *productUsecase) markSuggestStale() {
+	select {
+	case u.suggestStale <- struct{}{}:
+	default:
+	}
+}
+
+// ImportProducts ตรวจทุกแถวก่อน ถ้าผิดแม้แต่แถวเดียว (หรือเป็น dry run) ไม่บันทึกอะไรเลย
+// error คือไฟล์ที่อ่านไม่ได้หรือ database ผิดพลาด ส่วนแถวที่ผิดอยู่ใน report
+// actorId ว่างได้ (import จาก CLI) ประวัติจะไม่มีผู้แก้ไข
+func (u *productUsecase) ImportProducts(r io.Reader, format string, dryRun bool, actorId string) (*product.ImportReport, error) {
+	products, report, err := product.ParseImport(r, format)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = dryRun
+
+	product.ValidateImport(products)
+	if err := u.checkImportRefs(products); err != nil {
+		return nil, err
+	}
+	if report.Tally(products) > 0 || dryRun {
+		return notImported(report, products), nil
+	}
+
+	if err := u.productsRepository.ImportProducts(products, actorId); err != nil {
+		if report.Tally(products) > 0 {
+			// rollback แล้ว แถวที่ทำให้ล้มอยู่ใน report
+			return notImported(report, products), nil
+		}
+		return nil, err
+	}
+	u.markSuggestStale()
+
+	report.Imported = true
+	report.Tally(products)
+	return report, nil
+}
+
+func notImported(report *product.ImportReport, products []*product.ImportProduct) *product.ImportReport {
+	for _, p := range products {
+		p.Action = ""
+	}
+	for _, row := range report.Rows {
+		if len(row.Errors) == 0 {
+			row.Status = "valid"
+			row.ProductId = ""
+		}
+	}
+	report.Tally(products)
+	return report
+}
+
+// checkImportRefs ตรวจหมวดที่ไม่มีอยู่จริง และ sku ที่เป็นของสินค้าอื่น
+// (sku ทุกตัวของสินค้าหนึ่งต้องเป็นของสินค้าเดียวกันใน database ถ้ามีอยู่แล้ว)
+func (u *productUsecase) checkImportRefs(products []*product.ImportProduct) error {
+	categories := make([]string, 0)
+	skus := make([]string, 0)
+	for _, p := range products {
+		if p.ProductCategory != "" {
+			categories = append(categories, p.ProductCategory)
+		}
+		for _, v := range p.Variants {
+			if v.Sku != "" {
+				skus = append(skus, v.Sku)
+			}
+		}
+	}
+
+	refs, err := u.productsRepository.FindImportRefs(categories, skus)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		if p.ProductCategory != "" && !refs.Categories[strings.ToLower(p.ProductCategory)] {
+			p.Fail("category %q not found", p.ProductCategory)
+		}
+
+		var owner *product.ImportSkuOwner
+		for _, v := range p.Variants {
+			o, ok := refs.SkuOwners[v.Sku]
+			if !ok {
+				continue
+			}
+			if owner == nil {
+				owner = o
+				continue
+			}
+			if o.ProductId != owner.ProductId {
+				v.Fail("sku %s belongs to product %s (%s) but sku %s belongs to %s (%s)",
+					v.Sku, o.ProductId, o.ProductTitle, owner.Sku, owner.ProductId, owner.ProductTitle)
+			}
+		}
+	}
+	return nil
+}
+
+// ExportProducts เขียนสินค้าทั้งหมดลง w ทีละสินค้า
+func (u *productUsecase) ExportProducts(ctx context.Context, w io.Writer, format string) error {
+	ew, err := product.NewExportWriter(w, format)
+	if err != nil {
+		return err
+	}
+	if err := u.productsRepository.ExportProducts(ctx, ew.Write); err != nil {
+		return err
+	}
+	if err := ew.Flush(); err != nil {
+		return fmt.Errorf("write export failed: %v", err)
+	}
+	return nil
+}
+
+func (u *productUsecase) FindRevisions(req *product.RevisionFilter) (*entities.PaginateRes, error) {
+	if req.Page < 1 || req.Cursor != "" {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	revisions, cursors, err := u.productsRepository.FindRevisions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entities.PaginateRes{
+		Data:       revisions,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		NextCursor: cursors.Next,
+		PrevCursor: cursors.Prev,
+	}
+	if req.Cursor != "" {
+		// หน้าแบบ cursor ไม่มีเลขหน้า
+		res.Page = 0
+	}
+	if req.CountTotal() {
+		res.TotalItem = u.productsRepository.CountRevisions(req.ProductId)
+		res.TotalPage = int(math.Ceil(float64(res.TotalItem) / float64(req.Limit)))
+	}
+	return res, nil
+}
+
+func (u *productUsecase) FindRevision(productId, revisionId string) (*product.ProductRevision, error) {
+	id, err := parseRevisionId(revisionId)
+	if err != nil {
+		return nil, err
+	}
+	return u.productsRepository.FindRevision(productId, id)
+}
+
+func (u *productUsecase) RestoreRevision(productId, revisionId, actorId string) (*product.Product, error) {
+	id, err := parseRevisionId(revisionId)
+	if err != nil {
+		return nil, err
+	}
+	product, err := u.productsRepository.RestoreRevision(productId, id, actorId)
+	if err != nil {
+		return nil, err
+	}
+	u.markSuggestStale()
+	return product, nil
+}
+
+func parseRevisionId(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("revision not found")
+	}
+	return id, nil
+}
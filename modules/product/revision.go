@@ -0,0 +1,114 @@
+package product
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+)
+
+// action ของประวัติการแก้ไขสินค้า (archive นับเป็น delete)
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// ProductSnapshot สถานะของสินค้าหนึ่งครั้งใน "ProductRevision" ใช้กู้คืนได้
+// ไม่เก็บ stock เพราะ stock เปลี่ยนจากการขาย ไม่ใช่การแก้ไขของ admin
+type ProductSnapshot struct {
+	ProductTitle string             `json:"product_title"`
+	ProductDesc  string             `json:"product_desc"`
+	ProductPrice float64            `json:"product_price"`
+	ProductSex   string             `json:"product_sex"`
+	CategoryId   int                `json:"category_id"`
+	Status       string             `json:"status"`
+	PublishAt    *string            `json:"publish_at"`
+	UnpublishAt  *string            `json:"unpublish_at"`
+	Images       []*SnapshotImage   `json:"images"`
+	Variants     []*SnapshotVariant `json:"variants"`
+}
+
+// SnapshotImage ไม่มี id เพราะ id ของรูปเปลี่ยนทุกครั้งที่แก้รูป เทียบกันด้วย url
+type SnapshotImage struct {
+	Url      string                 `json:"url"`
+	Filename string                 `json:"filename"`
+	Width    int                    `json:"width"`
+	Height   int                    `json:"height"`
+	Variants entities.ImageVariants `json:"variants"`
+}
+
+type SnapshotVariant struct {
+	Id            string   `json:"id"`
+	Sku           string   `json:"sku"`
+	Size          string   `json:"size"`
+	Color         string   `json:"color"`
+	PriceOverride *float64 `json:"price_override"`
+}
+
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// RevisionDiff field ที่เปลี่ยน key เป็นชื่อ field ของ ProductSnapshot
+type RevisionDiff map[string]*FieldChange
+
+// DiffSnapshots เทียบ field ต่อ field before เป็น nil ได้ (สินค้าใหม่)
+func DiffSnapshots(before, after *ProductSnapshot) (RevisionDiff, error) {
+	beforeFields, err := snapshotFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := snapshotFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(RevisionDiff)
+	for name, a := range afterFields {
+		if b := beforeFields[name]; !bytes.Equal(a, b) {
+			diff[name] = &FieldChange{Before: b, After: a}
+		}
+	}
+	for name, b := range beforeFields {
+		if _, ok := afterFields[name]; !ok {
+			diff[name] = &FieldChange{Before: b}
+		}
+	}
+	return diff, nil
+}
+
+func snapshotFields(s *ProductSnapshot) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if s == nil {
+		return fields, nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ProductRevision หนึ่งการเปลี่ยนแปลงของสินค้า Snapshot มีเฉพาะตอนดูทีละ revision
+type ProductRevision struct {
+	Id           int64            `json:"id"`
+	ProductId    string           `json:"product_id"`
+	ActorId      *string          `json:"actor_id"` // null = ระบบหรือ CLI
+	ActorEmail   *string          `json:"actor_email"`
+	Action       string           `json:"action"`
+	RestoredFrom *int64           `json:"restored_from"`
+	Diff         RevisionDiff     `json:"diff"`
+	Snapshot     *ProductSnapshot `json:"snapshot,omitempty"`
+	CreatedAt    string           `json:"created_at"`
+}
+
+type RevisionFilter struct {
+	ProductId string `json:"-" query:"-"`
+	*entities.PaginationReq
+}
@@ -17,6 +17,15 @@ type User struct {
 	RoleId    int    `db:"role_id" json:"role_id"`
 	Avatar    string `db:"avatar" json:"avatar"`
 	Dob       string `db:"dob" json:"dob" form:"dob"`
+	Version   int    `db:"version" json:"version,omitempty"` // ETag ของ profile
+}
+
+// UserFilter รายการผู้ใช้สำหรับ admin order_by: newest, email, id
+type UserFilter struct {
+	Search string `json:"search" query:"search"` // email หรือชื่อ
+	RoleId int    `json:"role_id" query:"role_id"`
+	*entities.PaginationReq
+	*entities.SortReq
 }
 
 type UserRegisterReq struct {
@@ -99,44 +108,56 @@ type UserRemoveCredential struct {
 // }
 
 type UserUpdate struct {
-	Id        string `db:"id" json:"id"`
-	Email     string `db:"email" json:"email"`
-	FirstName string `db:"fname" json:"fname"`
-	LastName  string `db:"lname" json:"lname"`
-	Phone     string `db:"phone" json:"phone"`
-	Avatar    string `db:"avatar" json:"avatar"`
-	Dob       string `db:"dob" json:"dob"`
+	Id        string                 `db:"id" json:"id"`
+	Email     string                 `db:"email" json:"email"`
+	FirstName string                 `db:"fname" json:"fname"`
+	LastName  string                 `db:"lname" json:"lname"`
+	Phone     string                 `db:"phone" json:"phone"`
+	Avatar    string                 `db:"avatar" json:"avatar"`
+	Dob       string                 `db:"dob" json:"dob"`
+	IfMatch   *entities.Precondition `db:"-" json:"-"`
+	UploadId  string                 `db:"-" json:"-"` // upload ของ avatar ถูก mark attached ตอน update สำเร็จ
 }
 
 type WishlistRes []*ProductWishlistRes
 
 type ProductWishlistRes struct {
 	Id           string               `db:"id" json:"id"`
+	VariantId    string               `db:"variant_id" json:"variant_id"`
+	Sku          string               `db:"sku" json:"sku"`
 	ProductTitle string               `db:"product_title" json:"product_title"`
 	ProductPrice float64              `db:"product_price" json:"product_price"`
-	ProductSize  string               `db:"product_size" json:"product_size"`
+	Size         string               `db:"size" json:"size"`
+	Color        string               `db:"color" json:"color"`
+	Stock        int                  `db:"stock" json:"stock"`
+	Available    bool                 `db:"available" json:"available"` // false ถ้าสินค้าเลิกขายหรือยังไม่แสดงหน้าร้าน
 	Images       []*entities.ImageRes `json:"images"`
 }
 
 type AddCartReq struct {
-	ProductId string `json:"product_id" form:"product_id"`
+	VariantId string `json:"variant_id" form:"variant_id"`
 	UserId    string `json:"user_id" form:"user_id"`
-	Size      string `json:"size" form:"size"`
 }
 
+// Cart คือสินค้าในตะกร้า Id คือ id ของสินค้า ส่วน size สี และราคามาจาก variant
 type Cart struct {
 	CartId       string               `db:"cart_id" json:"cart_id"`
 	Id           string               `db:"id" json:"id"`
+	VariantId    string               `db:"variant_id" json:"variant_id"`
+	Sku          string               `db:"sku" json:"sku"`
 	Size         string               `db:"size" json:"size"`
+	Color        string               `db:"color" json:"color"`
 	Qty          int                  `db:"qty" json:"qty"`
 	ProductTitle string               `db:"product_title" json:"product_title"`
 	ProductPrice float64              `db:"product_price" json:"product_price"`
 	ProductDesc  string               `db:"product_desc" json:"product_desc"`
+	Available    bool                 `db:"available" json:"available"` // false ถ้าสินค้าเลิกขายหรือยังไม่แสดงหน้าร้าน สั่งซื้อไม่ได้
 	Images       []*entities.ImageRes `json:"images"`
 }
 
+// UpdateSizeReq เปลี่ยน size/สี ของสินค้าในตะกร้าเป็น variant อื่นของสินค้าเดียวกัน
 type UpdateSizeReq struct {
-	UserId string `json:"user_id" form:"user_id"`
-	CartId string `json:"cart_id" form:"cart_id"`
-	Size   string `json:"size" form:"size"`
+	UserId    string `json:"user_id" form:"user_id"`
+	CartId    string `json:"cart_id" form:"cart_id"`
+	VariantId string `json:"variant_id" form:"variant_id"`
 }
@@ -1,9 +1,7 @@
 package usersHandlers
 
 import (
-	"fmt"
-	"math"
-	"path/filepath"
+	"errors"
 	"strings"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
@@ -12,7 +10,6 @@ import (
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users/usersUsecases"
-	"github.com/deeptech-kmitl/Cicero-Backend/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -33,6 +30,8 @@ const (
 	DecreaseQtyCartErr   userHandlerErrCode = "users-012"
 	IncreaseQtyCartErr   userHandlerErrCode = "users-013"
 	UpdateSizeCartErr    userHandlerErrCode = "users-014"
+	FindUsersErr         userHandlerErrCode = "users-015"
+	StockSubscriptionErr userHandlerErrCode = "users-016"
 )
 
 type IUsersHandler interface {
@@ -44,12 +43,14 @@ type IUsersHandler interface {
 	UpdateUserProfile(c *fiber.Ctx) error
 	Wishlist(c *fiber.Ctx) error
 	GetWishlist(c *fiber.Ctx) error
+	StockSubscription(c *fiber.Ctx) error
 	AddCart(c *fiber.Ctx) error
 	RemoveCart(c *fiber.Ctx) error
 	GetCart(c *fiber.Ctx) error
 	DecreaseQtyCart(c *fiber.Ctx) error
 	IncreaseQtyCart(c *fiber.Ctx) error
 	UpdateSizeCart(c *fiber.Ctx) error
+	FindUsers(c *fiber.Ctx) error
 }
 
 type usersHandler struct {
@@ -231,6 +232,7 @@ func (h *usersHandler) GetUserProfile(c *fiber.Ctx) error {
 
 	}
 
+	c.Set(fiber.HeaderETag, entities.ETag(result.Version))
 	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 }
 
@@ -271,8 +273,18 @@ func (h *usersHandler) UpdateUserProfile(c *fiber.Ctx) error {
 		dob = values[0]
 	}
 
+	// ตรวจ If-Match ก่อน upload หรือเตรียม avatar ไม่งั้นได้ 412 ทีหลังก็มีไฟล์ค้างเปล่า ๆ
+	// transaction ยังตรวจซ้ำตอน lock user
+	ifMatch := entities.IfMatch(c)
+	if ifMatch != nil {
+		if current, err := h.userUsecase.GetUserProfile(userId); err == nil && !ifMatch.Match(current.Version) {
+			return h.profilePreconditionFailed(c, userId)
+		}
+	}
+
 	// avatar := make([]*multipart.FileHeader, 0)
 	avatarUrl := ""
+	avatarUploadId := ""
 	if avatar, exists := form.File["avatar"]; exists {
 		// avatar = file
 
@@ -284,40 +296,27 @@ func (h *usersHandler) UpdateUserProfile(c *fiber.Ctx) error {
 			).Res()
 		}
 
-		// // files ext validation
-		extMap := map[string]string{
-			"png":  "png",
-			"jpg":  "jpg",
-			"jpeg": "jpeg",
-		}
-
-		// check file extension
-		ext := strings.TrimPrefix(filepath.Ext(avatar[0].Filename), ".")
-		if extMap[ext] != ext || extMap[ext] == "" {
+		dir, err := files.UploadDir(files.NamespaceAvatars, userId)
+		if err != nil {
 			return entities.NewResponse(c).Error(
 				fiber.ErrBadRequest.Code,
 				string(updateUserProfileErr),
-				"invalid file extension",
+				err.Error(),
 			).Res()
 		}
-		// 	// check file size
-		if avatar[0].Size > int64(h.cfg.App().FileLimit()) {
+
+		// avatar ของลูกค้าต้องลบ EXIF ออก เพราะอาจมีพิกัด GPS ของรูปติดมา
+		fileReq, err := files.NewImageReq(h.cfg.App(), avatar[0], dir, true)
+		if err != nil {
 			return entities.NewResponse(c).Error(
 				fiber.ErrBadRequest.Code,
 				string(updateUserProfileErr),
-				fmt.Sprintf("file size must less than %d MB", int(math.Ceil(float64(h.cfg.App().FileLimit())/math.Pow(1024, 2)))),
+				err.Error(),
 			).Res()
 		}
+		avatarFile = append(avatarFile, fileReq)
 
-		filename := utils.RandFileName(ext)
-		avatarFile = append(avatarFile, &files.FileReq{
-			File:        avatar[0],
-			Destination: fmt.Sprintf("%s/%s", userId, filename),
-			FileName:    filename,
-			Extension:   ext,
-		})
-
-		result, err := h.fileUsecase.UploadToGCP(avatarFile)
+		result, err := h.fileUsecase.UploadFiles(avatarFile)
 		if err != nil {
 			return entities.NewResponse(c).Error(
 				fiber.ErrInternalServerError.Code,
@@ -327,6 +326,19 @@ func (h *usersHandler) UpdateUserProfile(c *fiber.Ctx) error {
 		}
 
 		avatarUrl = result[0].Url
+	} else if values, exists := form.Value["avatar_upload_id"]; exists && len(values) > 0 {
+		// avatar ที่ upload ตรงเข้า storage และ confirm แล้ว
+		result, err := h.fileUsecase.PrepareUploads(userId, values[:1], &files.AttachOptions{StripMetadata: true})
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(updateUserProfileErr),
+				err.Error(),
+			).Res()
+		}
+
+		avatarUrl = result[0].Url
+		avatarUploadId = values[0]
 	}
 
 	req := &users.UserUpdate{
@@ -337,10 +349,15 @@ func (h *usersHandler) UpdateUserProfile(c *fiber.Ctx) error {
 		Email:     email,
 		Phone:     phone,
 		Dob:       dob,
+		IfMatch:   ifMatch,
+		UploadId:  avatarUploadId,
 	}
 
 	res, err := h.userUsecase.UpdateUserProfile(req)
 	if err != nil {
+		if errors.Is(err, entities.ErrPreconditionFailed) {
+			return h.profilePreconditionFailed(c, userId)
+		}
 		return entities.NewResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(updateUserProfileErr),
@@ -348,14 +365,29 @@ func (h *usersHandler) UpdateUserProfile(c *fiber.Ctx) error {
 		).Res()
 	}
 
+	c.Set(fiber.HeaderETag, entities.ETag(res.Version))
 	return entities.NewResponse(c).Success(fiber.StatusOK, res).Res()
 }
 
+// ตอบ profile ปัจจุบันพร้อม ETag ให้ client รวมการแก้แล้วส่งใหม่
+func (h *usersHandler) profilePreconditionFailed(c *fiber.Ctx, userId string) error {
+	current, err := h.userUsecase.GetUserProfile(userId)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.StatusPreconditionFailed,
+			string(updateUserProfileErr),
+			entities.ErrPreconditionFailed.Error(),
+		).Res()
+	}
+	c.Set(fiber.HeaderETag, entities.ETag(current.Version))
+	return entities.NewResponse(c).Success(fiber.StatusPreconditionFailed, current).Res()
+}
+
 func (h *usersHandler) Wishlist(c *fiber.Ctx) error {
 	userId := strings.Trim(c.Params("user_id"), " ")
-	prodId := strings.Trim(c.Params("product_id"), " ")
+	variantId := strings.Trim(c.Params("variant_id"), " ")
 
-	result, err := h.userUsecase.Wishlist(userId, prodId)
+	result, err := h.userUsecase.Wishlist(userId, variantId)
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
@@ -368,6 +400,22 @@ func (h *usersHandler) Wishlist(c *fiber.Ctx) error {
 
 }
 
+func (h *usersHandler) StockSubscription(c *fiber.Ctx) error {
+	userId := strings.Trim(c.Params("user_id"), " ")
+	variantId := strings.Trim(c.Params("variant_id"), " ")
+
+	result, err := h.userUsecase.StockSubscription(userId, variantId)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(StockSubscriptionErr),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
 func (h *usersHandler) GetWishlist(c *fiber.Ctx) error {
 	userId := strings.Trim(c.Params("user_id"), " ")
 
@@ -481,7 +529,7 @@ func (h *usersHandler) UpdateSizeCart(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	size, err := h.userUsecase.UpdateSizeCart(req)
+	cartId, err := h.userUsecase.UpdateSizeCart(req)
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
@@ -490,5 +538,30 @@ func (h *usersHandler) UpdateSizeCart(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	return entities.NewResponse(c).Success(fiber.StatusOK, size).Res()
+	return entities.NewResponse(c).Success(fiber.StatusOK, cartId).Res()
+}
+
+func (h *usersHandler) FindUsers(c *fiber.Ctx) error {
+	req := &users.UserFilter{
+		PaginationReq: &entities.PaginationReq{},
+		SortReq:       &entities.SortReq{},
+	}
+
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(FindUsersErr),
+			err.Error(),
+		).Res()
+	}
+
+	result, err := h.userUsecase.FindUsers(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(FindUsersErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 }
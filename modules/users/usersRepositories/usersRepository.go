@@ -4,11 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/product"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users/usersPattern"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/sqlbuilder"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -19,11 +25,14 @@ type IUsersRepository interface {
 	GetProfile(userId string) (*users.User, error)
 	DeleteOauth(oauthId string) error
 	UpdateProfile(req *users.UserUpdate) error
-	AddWishlist(userId, prodId string) error
-	RemoveWishlist(userId, prodId string) error
-	CheckWishlist(userId, prodId string) (bool, error)
+	AddWishlist(userId, variantId string) error
+	RemoveWishlist(userId, variantId string) error
+	CheckWishlist(userId, variantId string) (bool, error)
 	FindWishlist(userId string) (*users.WishlistRes, error)
-	CheckCart(userId, prodId, size string) (bool, error)
+	AddStockSubscription(userId, variantId string) error
+	RemoveStockSubscription(userId, variantId string) error
+	CheckStockSubscription(userId, variantId string) (bool, error)
+	CheckCart(userId, variantId string) (bool, error)
 	AddCart(req *users.AddCartReq) (string, error)
 	AddCartAgain(req *users.AddCartReq) (string, error)
 	RemoveCart(userId, cartId string) error
@@ -31,6 +40,8 @@ type IUsersRepository interface {
 	DecreaseQtyCart(userId, cartId string) (int, error)
 	IncreaseQtyCart(userId, cartId string) (int, error)
 	UpdateSizeCart(req *users.UpdateSizeReq) (string, error)
+	FindUsers(req *users.UserFilter) ([]*users.User, *entities.Cursors, error)
+	CountUsers(req *users.UserFilter) int
 }
 
 type usersRepository struct {
@@ -120,7 +131,8 @@ func (r *usersRepository) GetProfile(userId string) (*users.User, error) {
 		"phone",
 		"role_id",
 		"avatar",
-		"dob"
+		"dob",
+		"version"
 	FROM "User"
 	WHERE "id" = $1;`
 
@@ -149,143 +161,211 @@ func (r *usersRepository) UpdateProfile(req *users.UserUpdate) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	queryWhereStack := make([]string, 0)
-	values := make([]any, 0)
-	lastIndex := 1
-
-	query := `
-	UPDATE "User" SET`
-
+	b := sqlbuilder.New()
 	if req.FirstName != "" {
-		values = append(values, req.FirstName)
-
-		queryWhereStack = append(queryWhereStack, fmt.Sprintf(`
-		"fname" = $%d?`, lastIndex))
-
-		lastIndex++
+		b.Set("fname", req.FirstName)
 	}
-
 	if req.LastName != "" {
-		values = append(values, req.LastName)
-
-		queryWhereStack = append(queryWhereStack, fmt.Sprintf(`
-		"lname" = $%d?`, lastIndex))
-
-		lastIndex++
+		b.Set("lname", req.LastName)
 	}
-
 	if req.Email != "" {
-		values = append(values, req.Email)
-
-		queryWhereStack = append(queryWhereStack, fmt.Sprintf(`
-		"email" = $%d?`, lastIndex))
-
-		lastIndex++
+		b.Set("email", req.Email)
 	}
-
 	if req.Phone != "" {
-		values = append(values, req.Phone)
-
-		queryWhereStack = append(queryWhereStack, fmt.Sprintf(`
-		"phone" = $%d?`, lastIndex))
-
-		lastIndex++
+		b.Set("phone", req.Phone)
 	}
-
 	if req.Dob != "" {
-		values = append(values, req.Dob)
-
-		queryWhereStack = append(queryWhereStack, fmt.Sprintf(`
-		"dob" = $%d?`, lastIndex))
+		b.Set("dob", req.Dob)
+	}
+	if req.Avatar != "" {
+		b.Set("avatar", req.Avatar)
+	}
 
-		lastIndex++
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction update profile failed: %v", err)
 	}
 
-	if req.Avatar != "" {
-		values = append(values, req.Avatar)
+	// lock user จนจบ transaction แล้วตรวจ version กับ If-Match
+	lock := `
+	SELECT
+		"version"
+	FROM "User"
+	WHERE "id" = $1
+	FOR UPDATE;`
 
-		queryWhereStack = append(queryWhereStack, fmt.Sprintf(`
-		"avatar" = $%d?`, lastIndex))
+	var version int
+	if err := tx.QueryRowxContext(ctx, lock, req.Id).Scan(&version); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("get user failed: %v", err)
+	}
+	if !req.IfMatch.Match(version) {
+		tx.Rollback()
+		return entities.ErrPreconditionFailed
+	}
 
-		lastIndex++
+	// ไม่มี field ให้แก้ก็ไม่ต้อง update
+	if !b.HasSet() {
+		tx.Rollback()
+		return nil
 	}
 
-	values = append(values, req.Id)
+	query := `
+	UPDATE "User" SET` + b.SetClause() + `
+	WHERE "id" = ` + b.Arg(req.Id) + `;`
 
-	queryClose := fmt.Sprintf(`
-	WHERE "id" = $%d;`, lastIndex)
+	if _, err := tx.ExecContext(ctx, query, b.Args()...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update profile user failed: %v", err)
+	}
 
-	for i := range queryWhereStack {
-		if i != len(queryWhereStack)-1 {
-			query += strings.Replace(queryWhereStack[i], "?", ",", 1)
-		} else {
-			query += strings.Replace(queryWhereStack[i], "?", "", 1)
+	// avatar เก่าจะถูก sweeper ลบหลัง grace period
+	if req.Avatar != "" {
+		if err := filesRepository.ReleaseAssets(ctx, tx, files.AssetOwnerUser, req.Id, req.Avatar); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := filesRepository.ClaimAssets(ctx, tx, files.AssetOwnerUser, req.Id, []string{req.Avatar}); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if req.UploadId != "" {
+			if err := filesRepository.AttachUploads(ctx, tx, []string{req.UploadId}); err != nil {
+				tx.Rollback()
+				return err
+			}
 		}
 	}
-	query += queryClose
 
-	if _, err := r.db.ExecContext(ctx, query, values...); err != nil {
-		return fmt.Errorf("update profile user failed: %v", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit update profile failed: %v", err)
 	}
 	return nil
 }
 
-func (r *usersRepository) AddWishlist(userId, prodId string) error {
+// visibleVariantQuery variant ใน $2 ที่สินค้าแสดงหน้าร้านอยู่ สินค้าที่ซ่อนอยู่เพิ่มลงตะกร้าหรือ wishlist ไม่ได้
+var visibleVariantQuery = `
+		SELECT 1 FROM "ProductVariant" "v"
+		JOIN "Product" "p" ON "p"."id" = "v"."product_id"
+		WHERE "v"."id" = $2
+		AND ` + product.VisibleQuery(`"p"`)
+
+func (r *usersRepository) AddWishlist(userId, variantId string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	query := `
 	INSERT INTO "Wishlist" (
 		"user_id",
-		"product_id"
+		"variant_id"
 	)
-	VALUES ($1, $2);
+	SELECT $1, $2
+	WHERE EXISTS (` + visibleVariantQuery + `);
 	`
 
-	if _, err := r.db.ExecContext(ctx, query, userId, prodId); err != nil {
+	res, err := r.db.ExecContext(ctx, query, userId, variantId)
+	if err != nil {
 		switch err.Error() {
-		case "ERROR: insert or update on table \"Wishlist\" violates foreign key constraint \"Wishlist_product_id_fkey\" (SQLSTATE 23503)":
-			return fmt.Errorf("product not found")
+		case "ERROR: insert or update on table \"Wishlist\" violates foreign key constraint \"Wishlist_variant_id_fkey\" (SQLSTATE 23503)":
+			return fmt.Errorf("product variant not found")
 		default:
 			return fmt.Errorf("add wishlist failed: %v", err)
 		}
 
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("product variant not found")
+	}
 	return nil
 
 }
 
-func (r *usersRepository) RemoveWishlist(userId, prodId string) error {
+func (r *usersRepository) RemoveWishlist(userId, variantId string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	query := `
 	DELETE FROM "Wishlist"
 	WHERE "user_id" = $1
-	AND "product_id" = $2
+	AND "variant_id" = $2
 	`
 
-	if _, err := r.db.ExecContext(ctx, query, userId, prodId); err != nil {
+	if _, err := r.db.ExecContext(ctx, query, userId, variantId); err != nil {
 		return fmt.Errorf("remove wishlist failed: %v", err)
 	}
 	return nil
 }
 
-func (r *usersRepository) CheckWishlist(userId, prodId string) (bool, error) {
+func (r *usersRepository) CheckWishlist(userId, variantId string) (bool, error) {
 	query := `
 	SELECT
 		(CASE WHEN COUNT(*) = 1 THEN TRUE ELSE FALSE END)
 	FROM "Wishlist"
 	WHERE "user_id" = $1
-	AND "product_id" = $2;`
+	AND "variant_id" = $2;`
 
 	var check bool
-	if err := r.db.Get(&check, query, userId, prodId); err != nil {
+	if err := r.db.Get(&check, query, userId, variantId); err != nil {
 		return false, fmt.Errorf("check wishlist failed: %v", err)
 	}
 	return check, nil
 }
 
+// AddStockSubscription ขอให้แจ้งเมื่อ variant กลับมามีของ ถูกลบหลังแจ้งแล้ว
+func (r *usersRepository) AddStockSubscription(userId, variantId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+	INSERT INTO "StockSubscription" (
+		"user_id",
+		"variant_id"
+	)
+	SELECT $1, $2
+	WHERE EXISTS (` + visibleVariantQuery + `)
+	ON CONFLICT DO NOTHING;
+	`
+
+	res, err := r.db.ExecContext(ctx, query, userId, variantId)
+	if err != nil {
+		return fmt.Errorf("add stock subscription failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("product variant not found")
+	}
+	return nil
+}
+
+func (r *usersRepository) RemoveStockSubscription(userId, variantId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+	DELETE FROM "StockSubscription"
+	WHERE "user_id" = $1
+	AND "variant_id" = $2;`
+
+	if _, err := r.db.ExecContext(ctx, query, userId, variantId); err != nil {
+		return fmt.Errorf("remove stock subscription failed: %v", err)
+	}
+	return nil
+}
+
+func (r *usersRepository) CheckStockSubscription(userId, variantId string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM "StockSubscription"
+		WHERE "user_id" = $1
+		AND "variant_id" = $2
+	);`
+
+	var check bool
+	if err := r.db.Get(&check, query, userId, variantId); err != nil {
+		return false, fmt.Errorf("check stock subscription failed: %v", err)
+	}
+	return check, nil
+}
+
 func (r *usersRepository) FindWishlist(userId string) (*users.WishlistRes, error) {
 	query := `
 	SELECT
@@ -293,9 +373,14 @@ func (r *usersRepository) FindWishlist(userId string) (*users.WishlistRes, error
 	FROM (
 		SELECT
 			"p"."id",
+			"v"."id" AS "variant_id",
+			"v"."sku",
 			"p"."product_title",
-			"p"."product_price",
-			"p"."product_size",
+			COALESCE("v"."price", "p"."product_price") AS "product_price",
+			"v"."size",
+			"v"."color",
+			"v"."stock",
+			` + product.VisibleQuery(`p`) + ` AS "available",
 			(
 				SELECT
 					COALESCE(array_to_json(array_agg("it")), '[]'::json)
@@ -303,14 +388,18 @@ func (r *usersRepository) FindWishlist(userId string) (*users.WishlistRes, error
 					SELECT
 						"i"."id",
 						"i"."filename",
-						"i"."url"
+						"i"."url",
+						"i"."width",
+						"i"."height",
+						"i"."variants"
 					FROM "Image" "i"
 					WHERE "i"."product_id" = "p"."id"
 				) AS "it"
 			) AS "images"
 		FROM
 			"Wishlist" wl
-		JOIN "Product" p ON wl."product_id" = p."id"
+		JOIN "ProductVariant" v ON wl."variant_id" = v."id"
+		JOIN "Product" p ON v."product_id" = p."id"
 		WHERE wl."user_id" = $1
 	) AS "wishlist";
 	`
@@ -335,18 +424,20 @@ func (r *usersRepository) AddCart(req *users.AddCartReq) (string, error) {
 	query := `
 	INSERT INTO "Cart" (
 		"user_id",
-		"product_id",
-		"size"
+		"variant_id"
 	)
-	VALUES ($1, $2, $3)
+	SELECT $1, $2
+	WHERE EXISTS (` + visibleVariantQuery + `)
 	RETURNING "id";
 	`
 
 	var cartId string
-	if err := r.db.QueryRowContext(ctx, query, req.UserId, req.ProductId, req.Size).Scan(&cartId); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, req.UserId, req.VariantId).Scan(&cartId); err != nil {
 		switch err.Error() {
-		case "ERROR: insert or update on table \"Cart\" violates foreign key constraint \"Cart_product_id_fkey\" (SQLSTATE 23503)":
-			return "", fmt.Errorf("product not found")
+		case "sql: no rows in result set":
+			return "", fmt.Errorf("product variant not found")
+		case "ERROR: insert or update on table \"Cart\" violates foreign key constraint \"Cart_variant_id_fkey\" (SQLSTATE 23503)":
+			return "", fmt.Errorf("product variant not found")
 		default:
 			return "", fmt.Errorf("add cart failed: %v", err)
 		}
@@ -388,17 +479,16 @@ func (r *usersRepository) RemoveCart(userId, cartId string) error {
 	return nil
 }
 
-func (r *usersRepository) CheckCart(userId, prodId, size string) (bool, error) {
+func (r *usersRepository) CheckCart(userId, variantId string) (bool, error) {
 	query := `
 	SELECT
 		(CASE WHEN COUNT(*) = 1 THEN TRUE ELSE FALSE END)
 	FROM "Cart"
 	WHERE "user_id" = $1
-	AND "product_id" = $2
-	AND "size" = $3;`
+	AND "variant_id" = $2;`
 
 	var check bool
-	if err := r.db.Get(&check, query, userId, prodId, size); err != nil {
+	if err := r.db.Get(&check, query, userId, variantId); err != nil {
 		return false, fmt.Errorf("check cart failed: %v", err)
 	}
 	return check, nil
@@ -412,13 +502,12 @@ func (r *usersRepository) AddCartAgain(req *users.AddCartReq) (string, error) {
 	UPDATE "Cart"
 	SET "qty" = "qty" + 1
 	WHERE "user_id" = $1
-	AND "product_id" = $2
-	AND "size" = $3
+	AND "variant_id" = $2
 	RETURNING "id";
 	`
 
 	var cartId string
-	if err := r.db.QueryRowContext(ctx, query, req.UserId, req.ProductId, req.Size).Scan(&cartId); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, req.UserId, req.VariantId).Scan(&cartId); err != nil {
 		switch err.Error() {
 		case "sql: no rows in result set":
 			return "", fmt.Errorf("no permission to add cart again")
@@ -439,11 +528,15 @@ func (r *usersRepository) FindCart(userId string) ([]*users.Cart, error) {
 		SELECT
 			"c"."id" AS "cart_id",
 			"p"."id",
+			"v"."id" AS "variant_id",
+			"v"."sku",
+			"v"."size",
+			"v"."color",
 			"p"."product_title",
-			"p"."product_price",
+			COALESCE("v"."price", "p"."product_price") AS "product_price",
 			"p"."product_desc",
 			"c"."qty",
-			"c"."size",
+			` + product.VisibleQuery(`p`) + ` AS "available",
 			(
 				SELECT
 					COALESCE(array_to_json(array_agg("it")), '[]'::json)
@@ -451,14 +544,18 @@ func (r *usersRepository) FindCart(userId string) ([]*users.Cart, error) {
 					SELECT
 						"i"."id",
 						"i"."filename",
-						"i"."url"
+						"i"."url",
+						"i"."width",
+						"i"."height",
+						"i"."variants"
 					FROM "Image" "i"
 					WHERE "i"."product_id" = "p"."id"
 				) AS "it"
 			) AS "images"
 		FROM
 			"Cart" c
-		JOIN "Product" p ON c."product_id" = p."id"
+		JOIN "ProductVariant" v ON c."variant_id" = v."id"
+		JOIN "Product" p ON v."product_id" = p."id"
 		WHERE c."user_id" = $1
 	) AS "cart";
 	`
@@ -538,23 +635,165 @@ func (r *usersRepository) IncreaseQtyCart(userId, cartId string) (int, error) {
 
 }
 
+// UpdateSizeCart เปลี่ยนสินค้าในตะกร้าเป็น variant อื่นของสินค้าเดียวกัน
+// ถ้าในตะกร้ามี variant นั้นอยู่แล้วจะรวม qty เข้าด้วยกัน คืน id ของรายการในตะกร้าหลังเปลี่ยน
 func (r *usersRepository) UpdateSizeCart(req *users.UpdateSizeReq) (string, error) {
-	query := `
-	UPDATE "Cart"
-	SET "size" = $1
-	WHERE "user_id" = $2
-	AND "id" = $3
-	RETURNING "size";
-	`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	var size string
-	if err := r.db.Get(&size, query, req.Size, req.UserId, req.CartId); err != nil {
-		switch err.Error() {
-		case "sql: no rows in result set":
-			return "", fmt.Errorf("no permission to update size")
-		default:
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction update size cart failed: %v", err)
+	}
+
+	queryCheck := `
+	SELECT
+		(CASE WHEN COUNT(*) = 1 THEN TRUE ELSE FALSE END)
+	FROM "Cart" "c"
+	JOIN "ProductVariant" "cur" ON "cur"."id" = "c"."variant_id"
+	JOIN "ProductVariant" "next" ON "next"."product_id" = "cur"."product_id"
+	WHERE "c"."id"::TEXT = $1
+	AND "c"."user_id" = $2
+	AND "next"."id" = $3;`
+
+	var check bool
+	if err := tx.GetContext(ctx, &check, queryCheck, req.CartId, req.UserId, req.VariantId); err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("check cart failed: %v", err)
+	}
+	if !check {
+		tx.Rollback()
+		return "", fmt.Errorf("no permission to update size")
+	}
+
+	queryMerge := `
+	UPDATE "Cart" "dst" SET "qty" = "dst"."qty" + "src"."qty"
+	FROM "Cart" "src"
+	WHERE "src"."id"::TEXT = $1
+	AND "dst"."user_id" = "src"."user_id"
+	AND "dst"."variant_id" = $2
+	AND "dst"."id" <> "src"."id"
+	RETURNING "dst"."id";`
+
+	var cartId string
+	err = tx.QueryRowxContext(ctx, queryMerge, req.CartId, req.VariantId).Scan(&cartId)
+	switch {
+	case err == nil:
+		if _, err := tx.ExecContext(ctx, `DELETE FROM "Cart" WHERE "id"::TEXT = $1;`, req.CartId); err != nil {
+			tx.Rollback()
+			return "", fmt.Errorf("update size cart failed: %v", err)
+		}
+	case err.Error() == "sql: no rows in result set":
+		query := `
+		UPDATE "Cart"
+		SET "variant_id" = $1
+		WHERE "id"::TEXT = $2
+		RETURNING "id";`
+
+		if err := tx.QueryRowxContext(ctx, query, req.VariantId, req.CartId).Scan(&cartId); err != nil {
+			tx.Rollback()
 			return "", fmt.Errorf("update size cart failed: %v", err)
 		}
+	default:
+		tx.Rollback()
+		return "", fmt.Errorf("update size cart failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit update size cart failed: %v", err)
+	}
+	return cartId, nil
+}
+
+// sort key ของรายการผู้ใช้
+var userSortKeys = map[string]*entities.KeysetColumn{
+	"id":     {Expr: `"u"."id"`, Cast: "VARCHAR"},
+	"newest": {Expr: `"u"."created_at"`, Cast: "TIMESTAMP"},
+	"email":  {Expr: `"u"."email"`, Cast: "VARCHAR"},
+}
+
+func userWhere(b *sqlbuilder.Builder, req *users.UserFilter) {
+	if search := strings.ToLower(strings.TrimSpace(req.Search)); search != "" {
+		b.Where(`(LOWER("u"."email") LIKE ? OR LOWER("u"."fname" || ' ' || "u"."lname") LIKE ?)`, "%"+search+"%", "%"+search+"%")
+	}
+	if req.RoleId != 0 {
+		b.Where(`"u"."role_id" = ?`, req.RoleId)
+	}
+}
+
+func (r *usersRepository) FindUsers(req *users.UserFilter) ([]*users.User, *entities.Cursors, error) {
+	keyset, err := entities.SortKeyset("user", userSortKeys, req.OrderBy, strings.ToUpper(req.Sort) == "DESC", req.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := sqlbuilder.New()
+	userWhere(b, req)
+	b.WhereExpr(keyset.Condition(b))
+
+	query := fmt.Sprintf(`
+	SELECT
+		COALESCE(array_to_json(array_agg("t")), '[]'::json)
+	FROM (
+		SELECT
+			"u"."id",
+			"u"."email",
+			"u"."fname",
+			"u"."lname",
+			"u"."phone",
+			"u"."role_id",
+			"u"."avatar",
+			"u"."dob",
+			%s AS "cursor_values"
+		FROM "User" "u"
+		WHERE 1 = 1%s
+		ORDER BY %s%s
+	) AS "t";`, keyset.Select(), b.Conditions(), keyset.OrderBy(), keyset.Limit(b, req.Page, req.Limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bytes := make([]byte, 0)
+	if err := r.db.GetContext(ctx, &bytes, query, b.Args()...); err != nil {
+		return nil, nil, fmt.Errorf("find users failed: %v", err)
+	}
+
+	rows := make([]*userRow, 0)
+	if err := json.Unmarshal(bytes, &rows); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal users failed: %v", err)
+	}
+
+	rows, cursors := entities.KeysetPage(keyset, rows, req.Limit, (req.Page-1)*req.Limit, func(r *userRow) []string {
+		return r.CursorValues
+	})
+
+	result := make([]*users.User, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, &r.User)
+	}
+	return result, cursors, nil
+}
+
+// userRow ผู้ใช้หนึ่งแถวพร้อมค่าของ sort key สำหรับสร้าง cursor
+type userRow struct {
+	users.User
+	CursorValues []string `json:"cursor_values"`
+}
+
+func (r *usersRepository) CountUsers(req *users.UserFilter) int {
+	b := sqlbuilder.New()
+	userWhere(b, req)
+
+	query := `
+	SELECT
+		COUNT(*)
+	FROM "User" "u"
+	WHERE 1 = 1` + b.Conditions() + `;`
+
+	var count int
+	if err := r.db.Get(&count, query, b.Args()...); err != nil {
+		log.Printf("count users failed: %v\n", err)
+		return 0
 	}
-	return size, nil
+	return count
 }
@@ -2,8 +2,10 @@ package usersUsecases
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/entities"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users/usersRepositories"
 	"github.com/deeptech-kmitl/Cicero-Backend/pkg/auth"
@@ -17,14 +19,16 @@ type IUserUsecase interface {
 	DeleteOauth(oauthId string) error
 	GetUserProfile(userId string) (*users.User, error)
 	UpdateUserProfile(req *users.UserUpdate) (*users.User, error)
-	Wishlist(userId, prodId string) (string, error)
+	Wishlist(userId, variantId string) (string, error)
 	GetWishlist(userId string) (*users.WishlistRes, error)
+	StockSubscription(userId, variantId string) (string, error)
 	AddCart(req *users.AddCartReq) (string, error)
 	RemoveCart(userId, cartId string) (string, error)
 	GetCart(userId string) ([]*users.Cart, error)
 	DecreaseQtyCart(userId, cartId string) (int, error)
 	IncreaseQtyCart(userId, cartId string) (int, error)
 	UpdateSizeCart(req *users.UpdateSizeReq) (string, error)
+	FindUsers(req *users.UserFilter) (*entities.PaginateRes, error)
 }
 
 type userUsecase struct {
@@ -140,21 +144,21 @@ func (u *userUsecase) UpdateUserProfile(req *users.UserUpdate) (*users.User, err
 
 }
 
-func (u *userUsecase) Wishlist(userId, prodId string) (string, error) {
+func (u *userUsecase) Wishlist(userId, variantId string) (string, error) {
 	var result string
 	// check if it is already add into wishlist or not
-	check, err := u.usersRepository.CheckWishlist(userId, prodId)
+	check, err := u.usersRepository.CheckWishlist(userId, variantId)
 	if err != nil {
 		return "", err
 	}
 
 	if check {
-		if err := u.usersRepository.RemoveWishlist(userId, prodId); err != nil {
+		if err := u.usersRepository.RemoveWishlist(userId, variantId); err != nil {
 			return "", err
 		}
 		result = "Removed"
 	} else {
-		if err := u.usersRepository.AddWishlist(userId, prodId); err != nil {
+		if err := u.usersRepository.AddWishlist(userId, variantId); err != nil {
 			return "", err
 		}
 		result = "Added"
@@ -163,6 +167,25 @@ func (u *userUsecase) Wishlist(userId, prodId string) (string, error) {
 	return result, nil
 }
 
+// StockSubscription เปิด/ปิดการแจ้งเตือนเมื่อ variant กลับมามีของ เหมือน wishlist
+func (u *userUsecase) StockSubscription(userId, variantId string) (string, error) {
+	check, err := u.usersRepository.CheckStockSubscription(userId, variantId)
+	if err != nil {
+		return "", err
+	}
+
+	if check {
+		if err := u.usersRepository.RemoveStockSubscription(userId, variantId); err != nil {
+			return "", err
+		}
+		return "Unsubscribed", nil
+	}
+	if err := u.usersRepository.AddStockSubscription(userId, variantId); err != nil {
+		return "", err
+	}
+	return "Subscribed", nil
+}
+
 func (u *userUsecase) GetWishlist(userId string) (*users.WishlistRes, error) {
 	result, err := u.usersRepository.FindWishlist(userId)
 	if err != nil {
@@ -173,7 +196,7 @@ func (u *userUsecase) GetWishlist(userId string) (*users.WishlistRes, error) {
 
 func (u *userUsecase) AddCart(req *users.AddCartReq) (string, error) {
 	result := ""
-	check, err := u.usersRepository.CheckCart(req.UserId, req.ProductId, req.Size)
+	check, err := u.usersRepository.CheckCart(req.UserId, req.VariantId)
 	if err != nil {
 		return "", err
 	}
@@ -236,9 +259,46 @@ func (u *userUsecase) IncreaseQtyCart(userId, cartId string) (int, error) {
 }
 
 func (u *userUsecase) UpdateSizeCart(req *users.UpdateSizeReq) (string, error) {
-	size, err := u.usersRepository.UpdateSizeCart(req)
+	cartId, err := u.usersRepository.UpdateSizeCart(req)
 	if err != nil {
 		return "", err
 	}
-	return size, nil
+	return cartId, nil
+}
+
+func (u *userUsecase) FindUsers(req *users.UserFilter) (*entities.PaginateRes, error) {
+	if req.Page < 1 || req.Cursor != "" {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	if req.OrderBy == "" {
+		req.OrderBy = "newest"
+	}
+	if req.Sort == "" {
+		req.Sort = "DESC"
+	}
+
+	result, cursors, err := u.usersRepository.FindUsers(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entities.PaginateRes{
+		Data:       result,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		NextCursor: cursors.Next,
+		PrevCursor: cursors.Prev,
+	}
+	if req.Cursor != "" {
+		// หน้าแบบ cursor ไม่มีเลขหน้า
+		res.Page = 0
+	}
+	if req.CountTotal() {
+		res.TotalItem = u.usersRepository.CountUsers(req)
+		res.TotalPage = int(math.Ceil(float64(res.TotalItem) / float64(req.Limit)))
+	}
+	return res, nil
 }
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE "Image" DROP COLUMN IF EXISTS "updated_at";
+ALTER TABLE "Image" DROP COLUMN IF EXISTS "variants";
+ALTER TABLE "Image" DROP COLUMN IF EXISTS "height";
+ALTER TABLE "Image" DROP COLUMN IF EXISTS "width";
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+--ขนาดของรูปต้นฉบับ และรูปย่อ (thumb, medium, large) ในรูปแบบ {"thumb": {"url": "...", "width": 200, "height": 150}}
+ALTER TABLE "Image" ADD COLUMN "width" INT NOT NULL DEFAULT 0;
+ALTER TABLE "Image" ADD COLUMN "height" INT NOT NULL DEFAULT 0;
+ALTER TABLE "Image" ADD COLUMN "variants" jsonb NOT NULL DEFAULT '{}'::jsonb;
+
+--trigger set_updated_at_timestamp_image_table มีมาตั้งแต่แรกแต่ตารางไม่มีคอลัมน์ ทำให้ UPDATE "Image" ไม่ได้
+ALTER TABLE "Image" ADD COLUMN "updated_at" TIMESTAMP NOT NULL DEFAULT now();
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_upload_table ON "Upload";
+DROP TABLE IF EXISTS "Upload" CASCADE;
+
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+
+--ไฟล์ที่ client upload ตรงเข้า storage ผ่าน signed url
+--pending: ออก url แล้ว รอ client upload, confirmed: ตรวจไฟล์ใน storage แล้ว, attached: ผูกกับสินค้าหรือ avatar แล้ว
+CREATE TABLE "Upload" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "user_id" VARCHAR NOT NULL,
+  "key" VARCHAR NOT NULL UNIQUE,
+  "content_type" VARCHAR NOT NULL,
+  "max_size" BIGINT NOT NULL,
+  "size" BIGINT NOT NULL DEFAULT 0,
+  "width" INT NOT NULL DEFAULT 0,
+  "height" INT NOT NULL DEFAULT 0,
+  "status" VARCHAR NOT NULL DEFAULT 'pending',
+  "expires_at" TIMESTAMP NOT NULL,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "Upload" ADD FOREIGN KEY ("user_id") REFERENCES "User" ("id") ON DELETE CASCADE;
+
+CREATE TRIGGER set_updated_at_timestamp_upload_table BEFORE UPDATE ON "Upload" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_asset_table ON "Asset";
+DROP TABLE IF EXISTS "Asset" CASCADE;
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+--ทะเบียนไฟล์ทุกไฟล์ที่ upload เข้า storage
+--owner_type: product, user (avatar), manual (upload ผ่าน /files/upload) หรือ NULL ถ้ายังไม่มีเจ้าของ
+--orphaned_at: เวลาที่ไฟล์ไม่ถูกใช้แล้ว sweeper จะลบไฟล์ที่ orphaned_at เก่ากว่า grace period
+--ไฟล์ที่ upload ก่อนมีตารางนี้จะไม่ถูกลบโดย sweeper
+CREATE TABLE "Asset" (
+  "key" VARCHAR PRIMARY KEY,
+  "url" VARCHAR NOT NULL UNIQUE,
+  "owner_type" VARCHAR,
+  "owner_id" VARCHAR,
+  "orphaned_at" TIMESTAMP DEFAULT now(),
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX asset_owner_idx ON "Asset" ("owner_type", "owner_id");
+CREATE INDEX asset_orphaned_at_idx ON "Asset" ("orphaned_at") WHERE "orphaned_at" IS NOT NULL;
+
+CREATE TRIGGER set_updated_at_timestamp_asset_table BEFORE UPDATE ON "Asset" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
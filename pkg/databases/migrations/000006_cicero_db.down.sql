@@ -0,0 +1,45 @@
+BEGIN;
+
+--ย้อนกลับได้ไม่ครบ: สินค้าที่มีหลาย variant จะเหลือ size/สี/stock ของ variant แรกเท่านั้น
+--และตะกร้า/wishlist ของ variant อื่นจะชี้ไปที่สินค้าหลัก
+ALTER TABLE "Product" ADD COLUMN "product_size" VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "Product" ADD COLUMN "product_color" VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "Product" ADD COLUMN "product_stock" INT NOT NULL DEFAULT 0;
+
+UPDATE "Product" "p" SET
+  "product_size" = "v"."size",
+  "product_color" = "v"."color",
+  "product_stock" = "v"."stock"
+FROM (
+  SELECT DISTINCT ON ("product_id") *
+  FROM "ProductVariant"
+  ORDER BY "product_id", "id"
+) AS "v"
+WHERE "v"."product_id" = "p"."id";
+
+ALTER TABLE "Product" ALTER COLUMN "product_size" DROP DEFAULT;
+ALTER TABLE "Product" ALTER COLUMN "product_color" DROP DEFAULT;
+
+ALTER TABLE "Cart" ADD COLUMN "product_id" VARCHAR;
+ALTER TABLE "Cart" ADD COLUMN "size" VARCHAR;
+UPDATE "Cart" "c" SET "product_id" = "v"."product_id", "size" = "v"."size"
+FROM "ProductVariant" "v"
+WHERE "v"."id" = "c"."variant_id";
+ALTER TABLE "Cart" ALTER COLUMN "product_id" SET NOT NULL;
+ALTER TABLE "Cart" ALTER COLUMN "size" SET NOT NULL;
+ALTER TABLE "Cart" DROP COLUMN "variant_id";
+ALTER TABLE "Cart" ADD FOREIGN KEY ("product_id") REFERENCES "Product" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "Wishlist" ADD COLUMN "product_id" VARCHAR;
+UPDATE "Wishlist" "w" SET "product_id" = "v"."product_id"
+FROM "ProductVariant" "v"
+WHERE "v"."id" = "w"."variant_id";
+ALTER TABLE "Wishlist" ALTER COLUMN "product_id" SET NOT NULL;
+ALTER TABLE "Wishlist" DROP COLUMN "variant_id";
+ALTER TABLE "Wishlist" ADD FOREIGN KEY ("product_id") REFERENCES "Product" ("id") ON DELETE CASCADE;
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_product_variant_table ON "ProductVariant";
+DROP TABLE IF EXISTS "ProductVariant" CASCADE;
+DROP SEQUENCE IF EXISTS product_variants_id_seq;
+
+COMMIT;
@@ -0,0 +1,145 @@
+BEGIN;
+
+--variant_id -> V000001
+CREATE SEQUENCE product_variants_id_seq START WITH 1 INCREMENT BY 1;
+
+--แต่ละ size/สี ของสินค้าเป็น variant ที่มี sku และ stock ของตัวเอง
+--price เป็น NULL ถ้าใช้ราคาเดียวกับ "Product"
+CREATE TABLE "ProductVariant" (
+  "id" VARCHAR(7) PRIMARY KEY DEFAULT CONCAT('V', LPAD(NEXTVAL('product_variants_id_seq')::TEXT, 6, '0')),
+  "product_id" VARCHAR NOT NULL,
+  "sku" VARCHAR NOT NULL UNIQUE,
+  "size" VARCHAR NOT NULL,
+  "color" VARCHAR NOT NULL,
+  "stock" INT NOT NULL DEFAULT 0 CHECK ("stock" >= 0),
+  "price" FLOAT CHECK ("price" >= 0),
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now(),
+  UNIQUE ("product_id", "size", "color")
+);
+
+ALTER TABLE "ProductVariant" ADD FOREIGN KEY ("product_id") REFERENCES "Product" ("id") ON DELETE CASCADE;
+CREATE TRIGGER set_updated_at_timestamp_product_variant_table BEFORE UPDATE ON "ProductVariant" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+--เดิมแต่ละ size เป็น "Product" คนละ row ที่ใช้ชื่อเดียวกัน
+--รวม row ที่ชื่อเดียวกันเป็นสินค้าเดียว (id น้อยสุดเป็นตัวหลัก) แล้วแต่ละ row เดิมกลายเป็น variant
+--row ที่ size และสีซ้ำกันจะรวมเป็น variant เดียวและรวม stock
+CREATE TEMP TABLE "product_fold" ON COMMIT DROP AS
+SELECT
+  "p"."id" AS "old_id",
+  MIN("p"."id") OVER (PARTITION BY "p"."product_title") AS "parent_id",
+  "p"."product_size" AS "size",
+  "p"."product_color" AS "color",
+  "p"."product_stock" AS "stock",
+  "p"."product_price" AS "price"
+FROM "Product" "p";
+
+INSERT INTO "ProductVariant" ("product_id", "sku", "size", "color", "stock", "price")
+SELECT
+  "f"."parent_id",
+  CONCAT('SKU-', MIN("f"."old_id")),
+  "f"."size",
+  "f"."color",
+  SUM("f"."stock"),
+  NULLIF(MIN("f"."price"), MIN("p"."product_price"))
+FROM "product_fold" "f"
+JOIN "Product" "p" ON "p"."id" = "f"."parent_id"
+GROUP BY "f"."parent_id", "f"."size", "f"."color"
+ORDER BY MIN("f"."old_id");
+
+ALTER TABLE "product_fold" ADD COLUMN "variant_id" VARCHAR;
+UPDATE "product_fold" "f" SET "variant_id" = "v"."id"
+FROM "ProductVariant" "v"
+WHERE "v"."product_id" = "f"."parent_id"
+AND "v"."size" = "f"."size"
+AND "v"."color" = "f"."color";
+
+--ตะกร้าอ้างถึง variant แทนสินค้าและ size ถ้าตะกร้ามี variant เดียวกันหลายรายการให้รวม qty
+ALTER TABLE "Cart" ADD COLUMN "variant_id" VARCHAR;
+UPDATE "Cart" "c" SET "variant_id" = "f"."variant_id"
+FROM "product_fold" "f"
+WHERE "f"."old_id" = "c"."product_id";
+
+UPDATE "Cart" "c" SET "qty" = "d"."qty"
+FROM (
+  SELECT MIN("id"::TEXT) AS "id", SUM("qty") AS "qty"
+  FROM "Cart"
+  GROUP BY "user_id", "variant_id"
+) AS "d"
+WHERE "c"."id"::TEXT = "d"."id";
+DELETE FROM "Cart" "c"
+WHERE "c"."id"::TEXT <> (
+  SELECT MIN("c2"."id"::TEXT) FROM "Cart" "c2"
+  WHERE "c2"."user_id" = "c"."user_id" AND "c2"."variant_id" = "c"."variant_id"
+);
+
+ALTER TABLE "Cart" ALTER COLUMN "variant_id" SET NOT NULL;
+ALTER TABLE "Cart" DROP COLUMN "product_id";
+ALTER TABLE "Cart" DROP COLUMN "size";
+ALTER TABLE "Cart" ADD FOREIGN KEY ("variant_id") REFERENCES "ProductVariant" ("id") ON DELETE CASCADE;
+ALTER TABLE "Cart" ADD UNIQUE ("user_id", "variant_id");
+
+--wishlist อ้างถึง variant (ใช้แจ้งเตือนเมื่อ size ที่อยากได้กลับมามีของ)
+ALTER TABLE "Wishlist" ADD COLUMN "variant_id" VARCHAR;
+UPDATE "Wishlist" "w" SET "variant_id" = "f"."variant_id"
+FROM "product_fold" "f"
+WHERE "f"."old_id" = "w"."product_id";
+DELETE FROM "Wishlist" "w"
+WHERE "w"."id"::TEXT <> (
+  SELECT MIN("w2"."id"::TEXT) FROM "Wishlist" "w2"
+  WHERE "w2"."user_id" = "w"."user_id" AND "w2"."variant_id" = "w"."variant_id"
+);
+
+ALTER TABLE "Wishlist" ALTER COLUMN "variant_id" SET NOT NULL;
+ALTER TABLE "Wishlist" DROP COLUMN "product_id";
+ALTER TABLE "Wishlist" ADD FOREIGN KEY ("variant_id") REFERENCES "ProductVariant" ("id") ON DELETE CASCADE;
+ALTER TABLE "Wishlist" ADD UNIQUE ("user_id", "variant_id");
+
+--สินค้าใน order เป็น snapshot ของตะกร้า ชี้ไปที่สินค้าหลักและเติม variant
+UPDATE "Order" "o" SET "products" = jsonb_build_object('Products', (
+  SELECT COALESCE(jsonb_agg(
+    CASE WHEN "f"."old_id" IS NULL THEN "e"."item"
+    ELSE "e"."item" || jsonb_build_object(
+      'id', "f"."parent_id",
+      'variant_id', "f"."variant_id",
+      'sku', "v"."sku",
+      'color', "v"."color"
+    ) END
+    ORDER BY "e"."ord"
+  ), '[]'::jsonb)
+  FROM jsonb_array_elements("o"."products"->'Products') WITH ORDINALITY AS "e"("item", "ord")
+  LEFT JOIN "product_fold" "f" ON "f"."old_id" = "e"."item"->>'id'
+  LEFT JOIN "ProductVariant" "v" ON "v"."id" = "f"."variant_id"
+))
+WHERE jsonb_typeof("o"."products"->'Products') = 'array';
+
+--ย้ายรูปของ row ที่ถูกรวมไปที่สินค้าหลัก (ไม่เอารูปซ้ำ) และย้ายเจ้าของไฟล์ตาม
+DELETE FROM "Image" "i"
+USING "product_fold" "f"
+WHERE "f"."old_id" = "i"."product_id"
+AND "f"."old_id" <> "f"."parent_id"
+AND EXISTS (
+  SELECT 1 FROM "Image" "i2"
+  WHERE "i2"."product_id" = "f"."parent_id" AND "i2"."url" = "i"."url"
+);
+UPDATE "Image" "i" SET "product_id" = "f"."parent_id"
+FROM "product_fold" "f"
+WHERE "f"."old_id" = "i"."product_id"
+AND "f"."old_id" <> "f"."parent_id";
+UPDATE "Asset" "a" SET "owner_id" = "f"."parent_id"
+FROM "product_fold" "f"
+WHERE "a"."owner_type" = 'product'
+AND "a"."owner_id" = "f"."old_id"
+AND "f"."old_id" <> "f"."parent_id";
+
+DELETE FROM "Product" "p"
+USING "product_fold" "f"
+WHERE "f"."old_id" = "p"."id"
+AND "f"."old_id" <> "f"."parent_id";
+
+--size, สี และ stock ย้ายไปอยู่ที่ variant แล้ว
+ALTER TABLE "Product" DROP COLUMN "product_size";
+ALTER TABLE "Product" DROP COLUMN "product_color";
+ALTER TABLE "Product" DROP COLUMN "product_stock";
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+ALTER TABLE "Product" ADD COLUMN "product_category" VARCHAR;
+UPDATE "Product" "p" SET "product_category" = "c"."name"
+FROM "Category" "c"
+WHERE "c"."id" = "p"."category_id";
+ALTER TABLE "Product" ALTER COLUMN "product_category" SET NOT NULL;
+ALTER TABLE "Product" DROP COLUMN "category_id";
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_category_table ON "Category";
+DROP TABLE IF EXISTS "Category" CASCADE;
+
+COMMIT;
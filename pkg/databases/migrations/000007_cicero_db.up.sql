@@ -0,0 +1,48 @@
+BEGIN;
+
+--หมวดหมู่สินค้าแบบมีลำดับชั้น parent_id เป็น NULL คือหมวดบนสุด
+--หมวดที่ is_active = FALSE จะไม่แสดงใน tree ของหน้าร้าน (รวมหมวดย่อยข้างใต้)
+CREATE TABLE "Category" (
+  "id" SERIAL PRIMARY KEY,
+  "parent_id" INT,
+  "name" VARCHAR NOT NULL,
+  "slug" VARCHAR NOT NULL UNIQUE,
+  "sort_order" INT NOT NULL DEFAULT 0,
+  "is_active" BOOLEAN NOT NULL DEFAULT TRUE,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now(),
+  CHECK ("parent_id" <> "id")
+);
+
+ALTER TABLE "Category" ADD FOREIGN KEY ("parent_id") REFERENCES "Category" ("id") ON DELETE RESTRICT;
+CREATE INDEX category_parent_id_idx ON "Category" ("parent_id");
+CREATE TRIGGER set_updated_at_timestamp_category_table BEFORE UPDATE ON "Category" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+--สร้างหมวดจาก product_category เดิม ชื่อที่ได้ slug เดียวกัน (ต่างกันแค่ตัวพิมพ์หรือเครื่องหมาย) รวมเป็นหมวดเดียว
+CREATE TEMP TABLE "category_fold" ON COMMIT DROP AS
+SELECT
+  "name",
+  COALESCE(
+    NULLIF(TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(TRIM("name"), '[^[:alnum:]]+', '-', 'g'))), ''),
+    CONCAT('category-', SUBSTR(MD5("name"), 1, 8))
+  ) AS "slug"
+FROM (SELECT DISTINCT "product_category" AS "name" FROM "Product") AS "c";
+
+INSERT INTO "Category" ("name", "slug")
+SELECT MIN(TRIM("name")), "slug"
+FROM "category_fold"
+GROUP BY "slug"
+ORDER BY MIN(TRIM("name"));
+
+ALTER TABLE "Product" ADD COLUMN "category_id" INT;
+UPDATE "Product" "p" SET "category_id" = "c"."id"
+FROM "category_fold" "f"
+JOIN "Category" "c" ON "c"."slug" = "f"."slug"
+WHERE "f"."name" = "p"."product_category";
+
+ALTER TABLE "Product" ALTER COLUMN "category_id" SET NOT NULL;
+ALTER TABLE "Product" ADD FOREIGN KEY ("category_id") REFERENCES "Category" ("id") ON DELETE RESTRICT;
+CREATE INDEX product_category_id_idx ON "Product" ("category_id");
+ALTER TABLE "Product" DROP COLUMN "product_category";
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "product_desc_trgm_idx";
+DROP INDEX IF EXISTS "product_title_trgm_idx";
+DROP INDEX IF EXISTS "product_search_vector_idx";
+ALTER TABLE "Product" DROP COLUMN IF EXISTS "search_vector";
+
+DROP EXTENSION IF EXISTS pg_trgm;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+--search_vector ให้น้ำหนักชื่อสินค้า (A) มากกว่ารายละเอียด (B)
+--ใช้ config english เพื่อตัด stem คำภาษาอังกฤษ คำที่ไม่ใช่อังกฤษจะถูกเก็บตามเดิม
+ALTER TABLE "Product" ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('english', COALESCE("product_title", '')), 'A') ||
+  setweight(to_tsvector('english', COALESCE("product_desc", '')), 'B')
+) STORED;
+
+CREATE INDEX "product_search_vector_idx" ON "Product" USING GIN ("search_vector");
+
+--Postgres ตัดคำภาษาไทยไม่ได้ (ไม่มีช่องว่างระหว่างคำ) คำค้นภาษาไทยจึงค้นแบบ substring
+--index trigram ช่วยทั้ง LIKE และ similarity สำหรับคำที่พิมพ์ผิด
+CREATE INDEX "product_title_trgm_idx" ON "Product" USING GIN (LOWER("product_title") gin_trgm_ops);
+CREATE INDEX "product_desc_trgm_idx" ON "Product" USING GIN (LOWER("product_desc") gin_trgm_ops);
+
+COMMIT;
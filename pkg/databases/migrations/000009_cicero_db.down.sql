@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "product_status_idx";
+
+ALTER TABLE "Product" DROP COLUMN IF EXISTS "unpublish_at";
+ALTER TABLE "Product" DROP COLUMN IF EXISTS "publish_at";
+ALTER TABLE "Product" DROP COLUMN IF EXISTS "status";
+
+COMMIT;
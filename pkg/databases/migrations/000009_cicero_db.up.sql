@@ -0,0 +1,14 @@
+BEGIN;
+
+--สถานะของสินค้า draft = ยังไม่ขาย published = ขาย archived = เลิกขาย (แทนการลบ)
+--สินค้าที่มีอยู่แล้วขายอยู่จึงเป็น published
+ALTER TABLE "Product" ADD COLUMN "status" VARCHAR NOT NULL DEFAULT 'published' CHECK ("status" IN ('draft', 'published', 'archived'));
+
+--ช่วงเวลาที่ published แสดงหน้าร้าน (UTC) NULL = ไม่จำกัด
+ALTER TABLE "Product" ADD COLUMN "publish_at" TIMESTAMP;
+ALTER TABLE "Product" ADD COLUMN "unpublish_at" TIMESTAMP;
+ALTER TABLE "Product" ADD CHECK ("unpublish_at" IS NULL OR "publish_at" IS NULL OR "unpublish_at" > "publish_at");
+
+CREATE INDEX "product_status_idx" ON "Product" ("status");
+
+COMMIT;
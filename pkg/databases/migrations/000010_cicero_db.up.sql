@@ -0,0 +1,19 @@
+BEGIN;
+
+--ประวัติการแก้ไขสินค้า หนึ่ง row ต่อการเปลี่ยนแปลง
+--snapshot คือสินค้าหลังเปลี่ยน (ไม่รวม stock) diff คือ field ที่เปลี่ยน {"field": {"before": ..., "after": ...}}
+--ไม่มี foreign key ไปที่ "Product" และ "User" ประวัติต้องอยู่ต่อแม้ต้นทางถูกลบ
+CREATE TABLE "ProductRevision" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "product_id" VARCHAR NOT NULL,
+  "actor_id" VARCHAR,
+  "action" VARCHAR NOT NULL CHECK ("action" IN ('create', 'update', 'delete', 'restore')),
+  "restored_from" BIGINT,
+  "snapshot" jsonb NOT NULL,
+  "diff" jsonb NOT NULL DEFAULT '{}'::jsonb,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "product_revision_product_id_idx" ON "ProductRevision" ("product_id", "id" DESC);
+
+COMMIT;
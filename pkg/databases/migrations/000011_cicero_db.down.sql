@@ -0,0 +1,14 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS touch_product_variant_table ON "ProductVariant";
+DROP TRIGGER IF EXISTS touch_product_image_table ON "Image";
+DROP FUNCTION IF EXISTS touch_product_column();
+
+DROP TRIGGER IF EXISTS set_version_users_table ON "User";
+DROP TRIGGER IF EXISTS set_version_product_table ON "Product";
+DROP FUNCTION IF EXISTS set_version_column();
+
+ALTER TABLE "User" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "Product" DROP COLUMN IF EXISTS "version";
+
+COMMIT;
@@ -0,0 +1,35 @@
+BEGIN;
+
+--version สำหรับ optimistic concurrency (ETag / If-Match) เพิ่มขึ้นทุกครั้งที่ row ถูก update
+ALTER TABLE "Product" ADD COLUMN "version" INT NOT NULL DEFAULT 1;
+ALTER TABLE "User" ADD COLUMN "version" INT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION set_version_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER set_version_product_table BEFORE UPDATE ON "Product" FOR EACH ROW EXECUTE PROCEDURE set_version_column();
+CREATE TRIGGER set_version_users_table BEFORE UPDATE ON "User" FOR EACH ROW EXECUTE PROCEDURE set_version_column();
+
+--รูปและ variant เป็นส่วนหนึ่งของสินค้า แก้แล้วให้ version ของสินค้าเปลี่ยนด้วย (ผ่าน trigger ของ "Product")
+--stock ไม่นับ เพราะเปลี่ยนจากการขายตลอดเวลา จะทำให้ admin แก้สินค้าไม่ได้
+CREATE OR REPLACE FUNCTION touch_product_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE "Product" SET "updated_at" = now() WHERE "id" = OLD.product_id;
+        RETURN OLD;
+    END IF;
+    UPDATE "Product" SET "updated_at" = now() WHERE "id" = NEW.product_id;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER touch_product_image_table AFTER INSERT OR UPDATE OR DELETE ON "Image" FOR EACH ROW EXECUTE PROCEDURE touch_product_column();
+CREATE TRIGGER touch_product_variant_table AFTER INSERT OR DELETE OR UPDATE OF "sku", "size", "color", "price" ON "ProductVariant" FOR EACH ROW EXECUTE PROCEDURE touch_product_column();
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "StockMovement";
+
+ALTER TABLE "ProductVariant" DROP CONSTRAINT IF EXISTS "product_variant_reserved_check";
+ALTER TABLE "ProductVariant" DROP COLUMN IF EXISTS "reserved";
+
+COMMIT;
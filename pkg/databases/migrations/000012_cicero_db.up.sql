@@ -0,0 +1,41 @@
+BEGIN;
+
+--"stock" คือจำนวนที่มีอยู่จริง (on hand) "reserved" คือจำนวนที่ถูกจองโดย order ที่ยังไม่ส่ง
+--ขายได้ = "stock" - "reserved"
+ALTER TABLE "ProductVariant" ADD COLUMN "reserved" INT NOT NULL DEFAULT 0 CHECK ("reserved" >= 0);
+ALTER TABLE "ProductVariant" ADD CONSTRAINT "product_variant_reserved_check" CHECK ("reserved" <= "stock");
+
+--ทุกการเปลี่ยน stock และ reserved ของ variant หนึ่ง row ต่อการเปลี่ยน
+--"qty" คือจำนวนที่ "stock" เปลี่ยน "reserved_qty" คือจำนวนที่ "reserved" เปลี่ยน ผลรวมของทั้งสองต้องเท่ากับค่าใน "ProductVariant"
+--ไม่มี foreign key ไปที่ "ProductVariant" ประวัติต้องอยู่ต่อแม้ variant ถูกลบ
+CREATE TABLE "StockMovement" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "variant_id" VARCHAR NOT NULL,
+  "type" VARCHAR NOT NULL CHECK ("type" IN ('receipt', 'sale', 'return', 'adjustment', 'reserve', 'release')),
+  "qty" INT NOT NULL DEFAULT 0,
+  "reserved_qty" INT NOT NULL DEFAULT 0,
+  "on_hand_after" INT NOT NULL,
+  "reserved_after" INT NOT NULL,
+  "order_id" VARCHAR,
+  "user_id" VARCHAR,
+  "note" VARCHAR NOT NULL DEFAULT '',
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "stock_movement_variant_id_idx" ON "StockMovement" ("variant_id", "id" DESC);
+CREATE INDEX "stock_movement_order_id_idx" ON "StockMovement" ("order_id") WHERE "order_id" IS NOT NULL;
+
+--stock ที่มีอยู่ก่อนมี ledger เป็นยอดยกมา
+--order ที่ pending อยู่ก่อนหน้านี้ไม่ได้จอง stock จึงไม่มี reserve
+INSERT INTO "StockMovement" ("variant_id", "type", "qty", "on_hand_after", "reserved_after", "note")
+SELECT
+  "id",
+  'adjustment',
+  "stock",
+  "stock",
+  0,
+  'opening balance'
+FROM "ProductVariant"
+WHERE "stock" <> 0;
+
+COMMIT;
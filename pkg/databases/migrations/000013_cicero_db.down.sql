@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "StockSubscription";
+DROP TABLE IF EXISTS "StockAlert";
+DROP TABLE IF EXISTS "StockThreshold";
+
+COMMIT;
@@ -0,0 +1,47 @@
+BEGIN;
+
+--threshold ของสินค้า ใช้กับทุก variant ของสินค้า ไม่มี row = ใช้ INVENTORY_LOW_STOCK_THRESHOLD
+--0 = ไม่แจ้งเตือน stock ใกล้หมด แต่ยังแจ้งเมื่อหมด
+CREATE TABLE "StockThreshold" (
+  "product_id" VARCHAR PRIMARY KEY,
+  "threshold" INT NOT NULL CHECK ("threshold" >= 0),
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+--แจ้งเตือน admin เมื่อจำนวนที่ขายได้ ("stock" - "reserved") ถึง threshold หรือหมด
+--เปิดอยู่จนกว่า stock จะกลับมา ("resolved_at") variant หนึ่งมี alert ที่เปิดอยู่ได้ชนิดละหนึ่งอัน
+--ไม่มี foreign key ไปที่ "ProductVariant" alert ของ variant ที่ถูกลบถูกปิดโดยตัวเช็ค
+--restock_notified_at: แจ้งลูกค้าว่าของกลับมาแล้ว out_of_stock ที่ปิดแล้วแต่ยังเป็น null คือรอแจ้ง
+--เช่นสินค้ายังเป็น draft หรือยังไม่ถึง publish_at จะถูกแจ้งเมื่อสินค้าแสดงหน้าร้าน
+CREATE TABLE "StockAlert" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "variant_id" VARCHAR NOT NULL,
+  "type" VARCHAR NOT NULL CHECK ("type" IN ('low_stock', 'out_of_stock')),
+  "threshold" INT NOT NULL,
+  "available" INT NOT NULL,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "resolved_at" TIMESTAMP,
+  "restock_notified_at" TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "stock_alert_open_idx" ON "StockAlert" ("variant_id", "type") WHERE "resolved_at" IS NULL;
+CREATE INDEX "stock_alert_pending_restock_idx" ON "StockAlert" ("variant_id") WHERE "type" = 'out_of_stock' AND "resolved_at" IS NOT NULL AND "restock_notified_at" IS NULL;
+
+--ลูกค้าที่ขอให้แจ้งเมื่อ variant กลับมามีของ ถูกลบหลังแจ้งแล้ว (ส่วนคนที่ wishlist ไว้ได้รับแจ้งทุกครั้ง)
+CREATE TABLE "StockSubscription" (
+  "user_id" VARCHAR NOT NULL,
+  "variant_id" VARCHAR NOT NULL,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  PRIMARY KEY ("user_id", "variant_id")
+);
+
+CREATE INDEX "stock_subscription_variant_id_idx" ON "StockSubscription" ("variant_id");
+
+ALTER TABLE "StockThreshold" ADD FOREIGN KEY ("product_id") REFERENCES "Product" ("id") ON DELETE CASCADE;
+ALTER TABLE "StockSubscription" ADD FOREIGN KEY ("user_id") REFERENCES "User" ("id") ON DELETE CASCADE;
+ALTER TABLE "StockSubscription" ADD FOREIGN KEY ("variant_id") REFERENCES "ProductVariant" ("id") ON DELETE CASCADE;
+
+CREATE TRIGGER set_updated_at_timestamp_stock_threshold_table BEFORE UPDATE ON "StockThreshold" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
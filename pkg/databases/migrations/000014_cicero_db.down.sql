@@ -0,0 +1,5 @@
+BEGIN;
+
+CREATE TRIGGER touch_product_image_table AFTER INSERT OR UPDATE OR DELETE ON "Image" FOR EACH ROW EXECUTE PROCEDURE touch_product_column();
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+--trigger ต่อ row ทำให้ version ของสินค้าเพิ่มทีละหลายค่าตอนแทนรูปทั้งชุด
+--และงานเบื้องหลังที่เติมขนาดหรือรูปย่อก็ทำให้ ETag เปลี่ยนโดยที่ admin ไม่ได้แก้อะไร
+--การแก้รูป (update, restore, import) จึง update "Product" เองครั้งเดียวใน transaction เดียวกัน
+DROP TRIGGER IF EXISTS touch_product_image_table ON "Image";
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+--ผลการแจ้งลูกค้าว่าของกลับมาแยกรายคน ต่อ out_of_stock alert
+--คนที่ส่งไม่สำเร็จถูกลองใหม่ในรอบถัดไปจนครบ attempts ที่กำหนด โดยไม่ส่งซ้ำให้คนที่ได้รับแล้ว
+--alert ถูก mark restock_notified_at เมื่อทุกคนได้รับแล้วหรือลองครบแล้ว
+CREATE TABLE "RestockDelivery" (
+  "alert_id" BIGINT NOT NULL,
+  "user_id" VARCHAR NOT NULL,
+  "attempts" INT NOT NULL DEFAULT 0,
+  "delivered_at" TIMESTAMP,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now(),
+  PRIMARY KEY ("alert_id", "user_id")
+);
+
+ALTER TABLE "RestockDelivery" ADD FOREIGN KEY ("alert_id") REFERENCES "StockAlert" ("id") ON DELETE CASCADE;
+ALTER TABLE "RestockDelivery" ADD FOREIGN KEY ("user_id") REFERENCES "User" ("id") ON DELETE CASCADE;
+
+CREATE TRIGGER set_updated_at_timestamp_restock_delivery_table BEFORE UPDATE ON "RestockDelivery" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
@@ -0,0 +1,157 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	_ "golang.org/x/image/webp"
+)
+
+// format ที่รับ ตรงกับชื่อที่ image.DecodeConfig คืนมา
+const (
+	Jpeg = "jpeg"
+	Png  = "png"
+	Webp = "webp"
+)
+
+var (
+	ErrUnsupported = errors.New("file must be a png, jpeg or webp image")
+	ErrInvalid     = errors.New("file is not a valid image")
+)
+
+// FormatOf คืน format ที่รับจาก content type เช่น image/jpeg -> jpeg
+func FormatOf(contentType string) (string, bool) {
+	switch contentType {
+	case "image/jpeg":
+		return Jpeg, true
+	case "image/png":
+		return Png, true
+	case "image/webp":
+		return Webp, true
+	}
+	return "", false
+}
+
+// Limits กันรูปที่ไฟล์เล็กแต่ decode แล้วใช้ memory มหาศาล (decompression bomb)
+type Limits struct {
+	MaxDimension int // ความกว้างหรือสูงสูงสุด
+	MaxPixels    int // กว้าง*สูง สูงสุด
+}
+
+type Image struct {
+	Format string
+	Width  int
+	Height int
+	Data   []byte // ไฟล์ที่จะ upload
+	img    image.Image
+}
+
+func (i *Image) Ext() string {
+	return Ext(i.Format)
+}
+
+func Ext(format string) string {
+	if format == Jpeg {
+		return "jpg"
+	}
+	return format
+}
+
+func (i *Image) ContentType() string {
+	return "image/" + i.Format
+}
+
+// Decode ตรวจไฟล์จากเนื้อหาจริงแทนนามสกุล:
+// magic bytes -> header (ขนาดรูป) -> decode ทั้งรูป
+func Decode(data []byte, limits *Limits) (*Image, error) {
+	format := sniff(data)
+	if format == "" {
+		return nil, ErrUnsupported
+	}
+
+	// อ่านแค่ header ก่อน เพื่อเช็คขนาดโดยยังไม่ต้องจอง memory ทั้งรูป
+	cfg, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || name != format {
+		return nil, ErrInvalid
+	}
+	if err := checkLimits(cfg, limits); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return &Image{
+		Format: format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Data:   data,
+		img:    img,
+	}, nil
+}
+
+func checkLimits(cfg image.Config, limits *Limits) error {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return ErrInvalid
+	}
+	if cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension {
+		return fmt.Errorf("image must not be larger than %dx%d pixels", limits.MaxDimension, limits.MaxDimension)
+	}
+	if cfg.Width*cfg.Height > limits.MaxPixels {
+		return fmt.Errorf("image must not have more than %d pixels", limits.MaxPixels)
+	}
+	return nil
+}
+
+func sniff(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return Jpeg
+	case "image/png":
+		return Png
+	case "image/webp":
+		return Webp
+	}
+	return ""
+}
+
+// StripMetadata encode รูปใหม่จาก pixel อย่างเดียว ทำให้ EXIF (เช่นพิกัด GPS) และ metadata อื่นหายไป
+// รูป jpeg จะถูกหมุนตาม EXIF orientation ก่อน เพื่อไม่ให้รูปกลับหัวหลังลบ EXIF
+// webp ไม่มี encoder ใน standard library จึงแปลงเป็น png แทน
+func StripMetadata(i *Image) (*Image, error) {
+	img := i.img
+	format := i.Format
+	if format == Jpeg {
+		img = applyOrientation(img, orientation(i.Data))
+	}
+	if format == Webp {
+		format = Png
+	}
+
+	buf := new(bytes.Buffer)
+	switch format {
+	case Jpeg:
+		if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, fmt.Errorf("encode jpeg failed: %v", err)
+		}
+	default:
+		if err := png.Encode(buf, img); err != nil {
+			return nil, fmt.Errorf("encode png failed: %v", err)
+		}
+	}
+
+	b := img.Bounds()
+	return &Image{
+		Format: format,
+		Width:  b.Dx(),
+		Height: b.Dy(),
+		Data:   buf.Bytes(),
+		img:    img,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+// VariantQuality คือคุณภาพ jpeg ของรูปย่อ
+const VariantQuality = 80
+
+// Resize ย่อรูปให้ด้านที่ยาวที่สุดไม่เกิน maxEdge แล้ว encode เป็น jpeg
+// ไม่ขยายรูปที่เล็กกว่า maxEdge แค่ encode ใหม่ให้ไฟล์เล็กลง
+// ใช้ jpeg เพราะยังไม่มี webp encoder ที่เป็น pure Go พื้นที่โปร่งใสจะกลายเป็นสีขาว
+func Resize(i *Image, maxEdge int) (*Image, error) {
+	w, h := i.Width, i.Height
+	if w > maxEdge || h > maxEdge {
+		if w >= h {
+			w, h = maxEdge, max(1, h*maxEdge/w)
+		} else {
+			w, h = max(1, w*maxEdge/h), maxEdge
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), i.img, i.img.Bounds(), draw.Over, nil)
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, dst, &jpeg.Options{Quality: VariantQuality}); err != nil {
+		return nil, fmt.Errorf("encode jpeg failed: %v", err)
+	}
+	return &Image{
+		Format: Jpeg,
+		Width:  w,
+		Height: h,
+		Data:   buf.Bytes(),
+		img:    dst,
+	}, nil
+}
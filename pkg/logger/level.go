@@ -0,0 +1,49 @@
+package logger
+
+import "sync/atomic"
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var level atomic.Int32
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// SetLevel ตั้งระดับ log จาก APP_LOG_LEVEL ค่าที่ไม่รู้จักใช้ info
+func SetLevel(name string) {
+	l := LevelInfo
+	switch name {
+	case "debug":
+		l = LevelDebug
+	case "warn":
+		l = LevelWarn
+	case "error":
+		l = LevelError
+	}
+	level.Store(int32(l))
+}
+
+// Enabled บอกว่า log ระดับ l ถูกเปิดอยู่หรือไม่
+func Enabled(l Level) bool {
+	return int32(l) >= level.Load()
+}
+
+// StatusLevel ระดับ log ของ request ตาม status code: 5xx error, 4xx warn นอกนั้น info
+func StatusLevel(status int) Level {
+	switch {
+	case status >= 500:
+		return LevelError
+	case status >= 400:
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
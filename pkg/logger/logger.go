@@ -38,9 +38,11 @@ func InitRiLogger(c *fiber.Ctx, res any) IRiLogger {
 	return log
 }
 
-// เพื่อ print log ออกทาง console
+// เพื่อ print log ออกทาง console มี response ทั้งก้อนจึง print เฉพาะระดับ debug
 func (l *RiLogger) Print() IRiLogger {
-	utils.Debug(l)
+	if Enabled(LevelDebug) {
+		utils.Debug(l)
+	}
 	return l
 
 }
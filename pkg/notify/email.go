@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+)
+
+// smtpTimeout ใช้เมื่อ ctx ไม่มี deadline กัน smtp server ที่ไม่ตอบทำให้ worker ค้าง
+const smtpTimeout = 30 * time.Second
+
+// emailNotifier ส่ง email ผ่าน smtp ทีละผู้รับ
+type emailNotifier struct {
+	host string
+	addr string // host:port
+	auth smtp.Auth
+	from string
+}
+
+func newEmailNotifier(cfg config.INotifyConfig) INotifier {
+	n := &emailNotifier{
+		host: cfg.SmtpHost(),
+		addr: net.JoinHostPort(cfg.SmtpHost(), strconv.Itoa(cfg.SmtpPort())),
+		from: cfg.SmtpFrom(),
+	}
+	if cfg.SmtpUsername() != "" {
+		n.auth = smtp.PlainAuth("", cfg.SmtpUsername(), cfg.SmtpPassword(), cfg.SmtpHost())
+	}
+	return n
+}
+
+// Notify ส่งให้ครบทุกคนแม้บางคนส่งไม่สำเร็จ แล้วคืน error ของทุกคนที่ไม่สำเร็จ
+func (n *emailNotifier) Notify(ctx context.Context, msg *Message) error {
+	errs := make([]error, 0)
+	for _, to := range msg.To {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := n.send(ctx, to, n.build(to, msg)); err != nil {
+			errs = append(errs, fmt.Errorf("send email to %s failed: %v", to, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send ทำแบบเดียวกับ smtp.SendMail แต่ dial และทุกคำสั่งมี deadline จาก ctx
+// และปิด connection ทันทีถ้า ctx ถูก cancel
+func (n *emailNotifier) send(ctx context.Context, to string, body []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		if err := c.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n *emailNotifier) build(to string, msg *Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func (n *emailNotifier) Close() error { return nil }
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+)
+
+// fileNotifier เขียนแจ้งเตือนต่อท้ายไฟล์ บรรทัดละหนึ่งข้อความแบบ JSON ให้ระบบอื่นมาอ่านไปส่งต่อ
+type fileNotifier struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// fileEntry หนึ่งบรรทัดในไฟล์
+type fileEntry struct {
+	Time string `json:"time"`
+	*Message
+}
+
+func newFileNotifier(cfg config.INotifyConfig) (INotifier, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.File()), 0755); err != nil {
+		return nil, fmt.Errorf("create notify dir failed: %v", err)
+	}
+	file, err := os.OpenFile(cfg.File(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open notify file failed: %v", err)
+	}
+	return &fileNotifier{file: file}, nil
+}
+
+func (n *fileNotifier) Notify(ctx context.Context, msg *Message) error {
+	line, err := json.Marshal(&fileEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Message: msg,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal notification failed: %v", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := n.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write notification failed: %v", err)
+	}
+	return nil
+}
+
+func (n *fileNotifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.file.Close()
+}
@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// logNotifier เขียนแจ้งเตือนลง log สำหรับ dev ที่ไม่มี smtp
+type logNotifier struct{}
+
+func newLogNotifier() INotifier {
+	return &logNotifier{}
+}
+
+func (n *logNotifier) Notify(ctx context.Context, msg *Message) error {
+	log.Printf("notify to=%s subject=%q: %s", strings.Join(msg.To, ","), msg.Subject, msg.Body)
+	return nil
+}
+
+func (n *logNotifier) Close() error { return nil }
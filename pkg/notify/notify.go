@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+)
+
+// INotifier คือช่องทางส่งแจ้งเตือนถึงผู้ใช้และ admin
+type INotifier interface {
+	// ส่งถึงผู้รับแต่ละคนแยกกัน ผู้รับไม่เห็นกัน
+	Notify(ctx context.Context, msg *Message) error
+	Close() error
+}
+
+// Message แจ้งเตือนหนึ่งข้อความ To คือ email ของผู้รับ
+type Message struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body"`
+}
+
+// สร้าง notifier ตาม NOTIFY_BACKEND
+func NewNotifier(cfg config.INotifyConfig) (INotifier, error) {
+	switch cfg.Backend() {
+	case "log":
+		return newLogNotifier(), nil
+	case "file":
+		return newFileNotifier(cfg)
+	case "email":
+		return newEmailNotifier(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown notify backend: %s", cfg.Backend())
+	}
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // เวลาที่เหลือก่อน window ปัจจุบันจะหมด
+	RetryAfter time.Duration // ใช้เมื่อ Allowed = false
+}
+
+// IStore เก็บตัวนับของแต่ละ key ใช้ memory store สำหรับ instance เดียว
+// ถ้ามีหลาย instance ให้ implement interface นี้ด้วย store ที่แชร์กันได้ เช่น redis
+type IStore interface {
+	Take(ctx context.Context, key string, limit int, window time.Duration) (*Result, error)
+}
+
+// sliding window counter: นับ request ของ window ปัจจุบันรวมกับ window ก่อนหน้าแบบถ่วงน้ำหนัก
+// ตามเวลาที่ยังซ้อนทับกันอยู่ ใช้หน่วยความจำแค่ 2 ตัวเลขต่อ key
+type counter struct {
+	window time.Duration
+	start  time.Time // เวลาเริ่มของ window ปัจจุบัน
+	prev   int
+	curr   int
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() IStore {
+	return &memoryStore{
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	c, ok := s.counters[key]
+	if !ok {
+		c = &counter{window: window, start: now.Truncate(window)}
+		s.counters[key] = c
+	}
+	c.roll(now)
+
+	elapsed := now.Sub(c.start)
+	weight := float64(window-elapsed) / float64(window)
+	used := int(math.Floor(float64(c.prev)*weight)) + c.curr
+
+	res := &Result{
+		Limit:      limit,
+		ResetAfter: window - elapsed,
+	}
+	if used >= limit {
+		res.RetryAfter = c.retryAfter(now, limit)
+		return res, nil
+	}
+
+	c.curr++
+	res.Allowed = true
+	res.Remaining = limit - used - 1
+	return res, nil
+}
+
+// เลื่อน window เมื่อเวลาผ่านไป
+func (c *counter) roll(now time.Time) {
+	start := now.Truncate(c.window)
+	switch {
+	case start.Equal(c.start):
+	case start.Sub(c.start) == c.window:
+		c.prev, c.curr = c.curr, 0
+		c.start = start
+	default:
+		c.prev, c.curr = 0, 0
+		c.start = start
+	}
+}
+
+// เวลาที่ต้องรอจนกว่าจะมี quota ว่าง 1 request
+func (c *counter) retryAfter(now time.Time, limit int) time.Duration {
+	if c.curr >= limit || c.prev == 0 {
+		return c.start.Add(c.window).Sub(now)
+	}
+	// prev*(window-t)/window + curr < limit  =>  t > window*(1-(limit-curr)/prev)
+	need := float64(c.window) * (1 - float64(limit-c.curr)/float64(c.prev))
+	wait := time.Duration(need) - now.Sub(c.start)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// ลบ key ที่ไม่ได้ใช้งานนานเกิน 2 window ทำอย่างมากนาทีละครั้ง
+func (s *memoryStore) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Minute {
+		return
+	}
+	s.lastPrune = now
+	for k, c := range s.counters {
+		if now.Sub(c.start) >= 2*c.window {
+			delete(s.counters, k)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package sqlbuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Builder เก็บ args ของ query และแทน ? ด้วย $n ตามลำดับที่ bind
+// ต้อง bind ตามลำดับที่ข้อความปรากฏใน query ($1 อยู่ก่อน $2 เสมอ)
+// ? ที่อยู่ใน '...' หรือ "..." ไม่ถูกแทน ส่วน ?? คือ ? จริง (เช่น operator ของ jsonb)
+type Builder struct {
+	args  []any
+	where []string
+	sets  []string
+}
+
+func New() *Builder {
+	return &Builder{
+		args:  make([]any, 0),
+		where: make([]string, 0),
+		sets:  make([]string, 0),
+	}
+}
+
+// Bind แทน ? ใน fragment ด้วย placeholder ของ args ตามลำดับ
+// จำนวน ? ต้องเท่ากับจำนวน args ไม่งั้นเป็นความผิดของโค้ดที่เรียก
+func (b *Builder) Bind(fragment string, args ...any) string {
+	var sb strings.Builder
+	used := 0
+	var quote byte
+
+	for i := 0; i < len(fragment); i++ {
+		ch := fragment[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?' && i+1 < len(fragment) && fragment[i+1] == '?':
+			sb.WriteByte('?')
+			i++
+			continue
+		case ch == '?':
+			if used == len(args) {
+				panic(fmt.Sprintf("sqlbuilder: more placeholders than args in %q", fragment))
+			}
+			sb.WriteString(b.Arg(args[used]))
+			used++
+			continue
+		}
+		sb.WriteByte(ch)
+	}
+
+	if used != len(args) {
+		panic(fmt.Sprintf("sqlbuilder: %d args for %d placeholders in %q", len(args), used, fragment))
+	}
+	return sb.String()
+}
+
+// Arg เพิ่ม arg หนึ่งตัวแล้วคืน placeholder ของมัน
+func (b *Builder) Arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *Builder) Args() []any {
+	return b.args
+}
+
+func (b *Builder) Len() int {
+	return len(b.args)
+}
+
+// Where เพิ่มเงื่อนไขที่ต่อกันด้วย AND
+func (b *Builder) Where(fragment string, args ...any) *Builder {
+	b.where = append(b.where, b.Bind(fragment, args...))
+	return b
+}
+
+// WhereExpr เพิ่มเงื่อนไขที่ bind แล้ว
+func (b *Builder) WhereExpr(expr string) *Builder {
+	if expr != "" {
+		b.where = append(b.where, expr)
+	}
+	return b
+}
+
+// Conditions เงื่อนไขทั้งหมดเป็น AND ... ต่อท้าย WHERE 1 = 1
+func (b *Builder) Conditions() string {
+	var sb strings.Builder
+	for _, w := range b.where {
+		sb.WriteString("\n\tAND ")
+		sb.WriteString(w)
+	}
+	return sb.String()
+}
+
+// WhereClause เงื่อนไขทั้งหมดเป็น WHERE ... คืนค่าว่างถ้าไม่มีเงื่อนไข
+func (b *Builder) WhereClause() string {
+	if len(b.where) == 0 {
+		return ""
+	}
+	return "\n\tWHERE " + strings.Join(b.where, "\n\tAND ")
+}
+
+// Set เพิ่ม "column" = $n สำหรับ UPDATE
+func (b *Builder) Set(column string, value any) *Builder {
+	return b.SetExpr(column, b.Arg(value))
+}
+
+// SetExpr เพิ่ม "column" = expr ที่ bind แล้ว
+func (b *Builder) SetExpr(column, expr string) *Builder {
+	b.sets = append(b.sets, Ident(column)+" = "+expr)
+	return b
+}
+
+func (b *Builder) HasSet() bool {
+	return len(b.sets) > 0
+}
+
+func (b *Builder) SetClause() string {
+	return "\n\t\t" + strings.Join(b.sets, ",\n\t\t")
+}
+
+// Paginate แบ่งหน้าแบบ OFFSET เริ่มที่หน้า 1
+func (b *Builder) Paginate(page, limit int) string {
+	if page < 1 {
+		page = 1
+	}
+	return fmt.Sprintf("\n\tOFFSET %s LIMIT %s", b.Arg((page-1)*limit), b.Arg(limit))
+}
+
+func (b *Builder) Limit(limit int) string {
+	return "\n\tLIMIT " + b.Arg(limit)
+}
+
+// Ident ครอบชื่อ column หรือ table ด้วย "..." ใช้กับชื่อที่มาจากโค้ดเท่านั้น
+func Ident(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// SortColumns ชื่อ sort ที่ client ส่งมาได้ -> expression ใน query
+// ชื่อที่ไม่อยู่ใน map จะไม่ถูกนำไปต่อใน query
+type SortColumns map[string]string
+
+// Resolve คืน expression ของ key หรือของ fallback ถ้า key ไม่อยู่ใน whitelist
+func (s SortColumns) Resolve(key, fallback string) string {
+	if expr, ok := s[strings.ToLower(key)]; ok {
+		return expr
+	}
+	return s[fallback]
+}
+
+// Direction ASC หรือ DESC ค่าอื่นเป็น fallback
+func Direction(dir, fallback string) string {
+	switch strings.ToUpper(dir) {
+	case "ASC":
+		return "ASC"
+	case "DESC":
+		return "DESC"
+	}
+	return fallback
+}
@@ -0,0 +1,271 @@
+package sqlbuilder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBindNumbering(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *Builder) string
+		want  string
+		args  []any
+	}{
+		{
+			name: "single bind",
+			build: func(b *Builder) string {
+				return b.Bind(`"a" = ? AND "b" = ?`, 1, "x")
+			},
+			want: `"a" = $1 AND "b" = $2`,
+			args: []any{1, "x"},
+		},
+		{
+			name: "several binds on one builder",
+			build: func(b *Builder) string {
+				first := b.Bind(`"a" = ?`, 1)
+				second := b.Bind(`"b" IN (?, ?)`, 2, 3)
+				third := b.Bind(`"c" = ?`, 4)
+				return first + " " + second + " " + third
+			},
+			want: `"a" = $1 "b" IN ($2, $3) "c" = $4`,
+			args: []any{1, 2, 3, 4},
+		},
+		{
+			name: "where, arg and paginate",
+			build: func(b *Builder) string {
+				b.Where(`"id" = ?`, "P000001")
+				b.Where(`"title" ILIKE ? OR "desc" ILIKE ?`, "%shirt%", "%shirt%")
+				order := " ORDER BY " + b.Arg("title")
+				return b.Conditions() + order + b.Paginate(3, 20)
+			},
+			want: "\n\tAND \"id\" = $1" +
+				"\n\tAND \"title\" ILIKE $2 OR \"desc\" ILIKE $3" +
+				" ORDER BY $4" +
+				"\n\tOFFSET $5 LIMIT $6",
+			args: []any{"P000001", "%shirt%", "%shirt%", "title", 40, 20},
+		},
+		{
+			name: "paginate clamps page below 1",
+			build: func(b *Builder) string {
+				return b.Paginate(0, 10)
+			},
+			want: "\n\tOFFSET $1 LIMIT $2",
+			args: []any{0, 10},
+		},
+		{
+			name: "where clause and limit",
+			build: func(b *Builder) string {
+				b.Where(`"a" = ?`, 1).Where(`"b" = ?`, 2)
+				return b.WhereClause() + b.Limit(5)
+			},
+			want: "\n\tWHERE \"a\" = $1\n\tAND \"b\" = $2\n\tLIMIT $3",
+			args: []any{1, 2, 5},
+		},
+		{
+			name: "no where clause",
+			build: func(b *Builder) string {
+				return b.WhereClause() + b.Conditions()
+			},
+			want: "",
+			args: []any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			if got := tt.build(b); got != tt.want {
+				t.Errorf("query = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(b.Args(), tt.args) {
+				t.Errorf("args = %v, want %v", b.Args(), tt.args)
+			}
+			if b.Len() != len(tt.args) {
+				t.Errorf("len = %d, want %d", b.Len(), len(tt.args))
+			}
+		})
+	}
+}
+
+func TestBindEscaping(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		args     []any
+		want     string
+	}{
+		{
+			name:     "double question mark is a literal",
+			fragment: `"tags" ?? ? AND "id" = ?`,
+			args:     []any{"sale", 1},
+			want:     `"tags" ? $1 AND "id" = $2`,
+		},
+		{
+			name:     "question mark in single quotes",
+			fragment: `"title" = 'why?' AND "id" = ?`,
+			args:     []any{1},
+			want:     `"title" = 'why?' AND "id" = $1`,
+		},
+		{
+			name:     "question mark in double quotes",
+			fragment: `"odd?col" = ?`,
+			args:     []any{1},
+			want:     `"odd?col" = $1`,
+		},
+		{
+			name:     "other quote inside a literal",
+			fragment: `'it"s ?' = ?`,
+			args:     []any{1},
+			want:     `'it"s ?' = $1`,
+		},
+		{
+			name:     "no placeholders",
+			fragment: `"deleted_at" IS NULL`,
+			want:     `"deleted_at" IS NULL`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New().Bind(tt.fragment, tt.args...); got != tt.want {
+				t.Errorf("Bind(%q) = %q, want %q", tt.fragment, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindArgCountMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		args     []any
+	}{
+		{name: "more placeholders than args", fragment: `"a" = ? AND "b" = ?`, args: []any{1}},
+		{name: "more args than placeholders", fragment: `"a" = ?`, args: []any{1, 2}},
+		{name: "escaped placeholder is not counted", fragment: `"a" ?? 'x'`, args: []any{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Bind(%q) with %d args did not panic", tt.fragment, len(tt.args))
+				}
+			}()
+			New().Bind(tt.fragment, tt.args...)
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *Builder) string
+		want  string
+		args  []any
+	}{
+		{
+			name: "set only",
+			build: func(b *Builder) string {
+				b.Set("fname", "Ann").Set("lname", "Lee")
+				return b.SetClause() + " WHERE \"id\" = " + b.Arg("U000001")
+			},
+			want: "\n\t\t\"fname\" = $1,\n\t\t\"lname\" = $2 WHERE \"id\" = $3",
+			args: []any{"Ann", "Lee", "U000001"},
+		},
+		{
+			name: "set after existing args",
+			build: func(b *Builder) string {
+				cte := b.Bind(`WITH "c" AS (SELECT "id" FROM "Category" WHERE "slug" = ?)`, "shirts")
+				b.Set("product_title", "Tee")
+				b.SetExpr("category_id", `(SELECT "id" FROM "c")`)
+				b.Set("product_price", 990.0)
+				return cte + b.SetClause()
+			},
+			want: `WITH "c" AS (SELECT "id" FROM "Category" WHERE "slug" = $1)` +
+				"\n\t\t\"product_title\" = $2,\n\t\t\"category_id\" = (SELECT \"id\" FROM \"c\"),\n\t\t\"product_price\" = $3",
+			args: []any{"shirts", "Tee", 990.0},
+		},
+		{
+			name: "column names are quoted",
+			build: func(b *Builder) string {
+				b.Set(`we"ird`, 1)
+				return b.SetClause()
+			},
+			want: "\n\t\t\"we\"\"ird\" = $1",
+			args: []any{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			if b.HasSet() {
+				t.Fatal("new builder has set clauses")
+			}
+			if got := tt.build(b); got != tt.want {
+				t.Errorf("query = %q, want %q", got, tt.want)
+			}
+			if !b.HasSet() {
+				t.Error("HasSet() = false after Set")
+			}
+			if !reflect.DeepEqual(b.Args(), tt.args) {
+				t.Errorf("args = %v, want %v", b.Args(), tt.args)
+			}
+		})
+	}
+}
+
+func TestSortColumnsResolve(t *testing.T) {
+	columns := SortColumns{
+		"id":    `"p"."id"`,
+		"price": `"p"."product_price"`,
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		fallback string
+		want     string
+	}{
+		{name: "whitelisted", key: "price", fallback: "id", want: `"p"."product_price"`},
+		{name: "case insensitive", key: "PRICE", fallback: "id", want: `"p"."product_price"`},
+		{name: "unknown column", key: "product_desc", fallback: "id", want: `"p"."id"`},
+		{name: "raw expression", key: `"p"."id"`, fallback: "id", want: `"p"."id"`},
+		{name: "injection attempt", key: "price; DROP TABLE \"Product\"", fallback: "id", want: `"p"."id"`},
+		{name: "empty", key: "", fallback: "price", want: `"p"."product_price"`},
+		{name: "unknown fallback", key: "nope", fallback: "nope", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := columns.Resolve(tt.key, tt.fallback); got != tt.want {
+				t.Errorf("Resolve(%q, %q) = %q, want %q", tt.key, tt.fallback, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirection(t *testing.T) {
+	tests := []struct {
+		dir      string
+		fallback string
+		want     string
+	}{
+		{dir: "ASC", fallback: "DESC", want: "ASC"},
+		{dir: "desc", fallback: "ASC", want: "DESC"},
+		{dir: "Asc", fallback: "DESC", want: "ASC"},
+		{dir: "", fallback: "DESC", want: "DESC"},
+		{dir: "sideways", fallback: "ASC", want: "ASC"},
+		{dir: "DESC; DROP TABLE \"Product\"", fallback: "ASC", want: "ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			if got := Direction(tt.dir, tt.fallback); got != tt.want {
+				t.Errorf("Direction(%q, %q) = %q, want %q", tt.dir, tt.fallback, got, tt.want)
+			}
+		})
+	}
+}
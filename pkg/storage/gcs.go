@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+)
+
+type gcsStorage struct {
+	client *storage.Client
+	bucket string
+}
+
+func newGcsStorage(ctx context.Context, cfg config.IStorageConfig) (IObjectStorage, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage.NewClient: %w", err)
+	}
+	return &gcsStorage{
+		client: client,
+		bucket: cfg.Bucket(),
+	}, nil
+}
+
+func (s *gcsStorage) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	// Upload an object with storage.Writer.
+	wc := s.client.Bucket(s.bucket).Object(key).NewWriter(ctx)
+	wc.ContentType = contentType
+
+	if _, err := io.Copy(wc, body); err != nil {
+		wc.Close()
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+	// Data can continue to be added to the file until the writer is closed.
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("Writer.Close: %w", err)
+	}
+
+	acl := s.client.Bucket(s.bucket).Object(key).ACL()
+	if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return fmt.Errorf("ACLHandle.Set: %w", err)
+	}
+	return nil
+}
+
+func (s *gcsStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := s.client.Bucket(s.bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Object(%q).NewReader: %v", key, err)
+	}
+	return rc, nil
+}
+
+func (s *gcsStorage) Delete(ctx context.Context, key string) error {
+	o := s.client.Bucket(s.bucket).Object(key)
+
+	// Optional: set a generation-match precondition to avoid potential race
+	// conditions and data corruptions. The request to delete the file is aborted
+	// if the object's generation number does not match your precondition.
+	attrs, err := o.Attrs(ctx)
+	if err != nil {
+		return fmt.Errorf("object.Attrs: %v", err)
+	}
+	o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
+
+	if err := o.Delete(ctx); err != nil {
+		return fmt.Errorf("Object(%q).Delete: %v", key, err)
+	}
+	return nil
+}
+
+func (s *gcsStorage) PublicUrl(key string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucket, key)
+}
+
+func (s *gcsStorage) Key(url string) (string, bool) {
+	prefix := fmt.Sprintf("https://storage.googleapis.com/%s/", s.bucket)
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, prefix), true
+}
+
+func (s *gcsStorage) SignedUrl(_ context.Context, key string, opts *SignOptions) (*SignedUrl, error) {
+	res := &SignedUrl{
+		Method:    opts.Method,
+		Headers:   make(map[string]string),
+		ExpiresAt: time.Now().Add(opts.Expires),
+	}
+	headers := make([]string, 0)
+	if opts.ContentType != "" {
+		res.Headers["Content-Type"] = opts.ContentType
+	}
+	// GCS ปฏิเสธ upload ที่ขนาดไม่อยู่ในช่วงนี้ให้เอง
+	if opts.MaxSize > 0 {
+		res.Headers["x-goog-content-length-range"] = fmt.Sprintf("0,%d", opts.MaxSize)
+		headers = append(headers, fmt.Sprintf("x-goog-content-length-range:0,%d", opts.MaxSize))
+	}
+
+	url, err := s.client.Bucket(s.bucket).SignedURL(key, &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      opts.Method,
+		Expires:     res.ExpiresAt,
+		ContentType: opts.ContentType,
+		Headers:     headers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Bucket(%q).SignedURL: %v", s.bucket, err)
+	}
+	res.Url = url
+	return res, nil
+}
+
+func (s *gcsStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(key).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("object.Attrs: %v", err)
+	}
+	return &ObjectInfo{
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+	}, nil
+}
+
+func (s *gcsStorage) Close() error {
+	return s.client.Close()
+}
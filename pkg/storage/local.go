@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+)
+
+// LocalStaticPrefix คือ route ที่ server ใช้เสิร์ฟไฟล์ของ local storage
+const LocalStaticPrefix = "/static"
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signed url has expired")
+	ErrTooLarge         = errors.New("file is larger than the signed size")
+)
+
+// ISignedUploadReceiver คือ backend ที่ไม่มี server รับไฟล์เอง (local)
+// server ต้องส่ง PUT ที่มาตาม signed url เข้ามาที่นี่
+type ISignedUploadReceiver interface {
+	ReceiveSignedUpload(ctx context.Context, key, contentType string, query url.Values, body io.Reader, size int64) error
+}
+
+// localStorage เก็บไฟล์ลง disk สำหรับ dev และ test ที่ไม่มี credentials ของ cloud
+type localStorage struct {
+	dir        string
+	publicUrl  string
+	signingKey []byte
+}
+
+func newLocalStorage(cfg config.IStorageConfig) (IObjectStorage, error) {
+	if err := os.MkdirAll(cfg.LocalDir(), 0755); err != nil {
+		return nil, fmt.Errorf("create storage dir failed: %v", err)
+	}
+	return &localStorage{
+		dir:        cfg.LocalDir(),
+		publicUrl:  cfg.PublicUrl(),
+		signingKey: cfg.SigningKey(),
+	}, nil
+}
+
+// ป้องกัน key ที่พาออกไปนอก dir เช่น "../../etc/passwd"
+func (s *localStorage) path(key string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(s.dir, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return p, nil
+}
+
+func (s *localStorage) Put(_ context.Context, key string, body io.Reader, _ string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("create dir failed: %v", err)
+	}
+
+	// เขียนลงไฟล์ชั่วคราวก่อนแล้วค่อย rename เพื่อไม่ให้มีไฟล์ที่เขียนไม่เสร็จ
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create file failed: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close file failed: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("chmod file failed: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("rename file failed: %v", err)
+	}
+	return nil
+}
+
+func (s *localStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("open %q failed: %v", key, err)
+	}
+	return f, nil
+}
+
+func (s *localStorage) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		return fmt.Errorf("delete %q failed: %v", key, err)
+	}
+	return nil
+}
+
+func (s *localStorage) PublicUrl(key string) string {
+	return fmt.Sprintf("%s/%s", s.publicUrl, key)
+}
+
+func (s *localStorage) Key(url string) (string, bool) {
+	if !strings.HasPrefix(url, s.publicUrl+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(url, s.publicUrl+"/"), true
+}
+
+// url ชั่วคราวที่เซ็นด้วย HMAC ของ method, key, content type, ขนาดสูงสุด และเวลาหมดอายุ
+// สำหรับ PUT server ต้องเปิด route ที่เรียก ReceiveSignedUpload ไว้ด้วย
+func (s *localStorage) SignedUrl(_ context.Context, key string, opts *SignOptions) (*SignedUrl, error) {
+	expiresAt := time.Now().Add(opts.Expires)
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	if opts.MaxSize > 0 {
+		q.Set("max_size", strconv.FormatInt(opts.MaxSize, 10))
+	}
+	q.Set("signature", s.sign(opts.Method, key, opts.ContentType, opts.MaxSize, expiresAt.Unix()))
+
+	res := &SignedUrl{
+		Url:       fmt.Sprintf("%s?%s", s.PublicUrl(key), q.Encode()),
+		Method:    opts.Method,
+		Headers:   make(map[string]string),
+		ExpiresAt: expiresAt,
+	}
+	if opts.ContentType != "" {
+		res.Headers["Content-Type"] = opts.ContentType
+	}
+	return res, nil
+}
+
+func (s *localStorage) sign(method, key, contentType string, maxSize, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%d", strings.ToUpper(method), key, contentType, maxSize, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReceiveSignedUpload ตรวจ signed url ที่ได้จาก SignedUrl แล้วบันทึกไฟล์
+func (s *localStorage) ReceiveSignedUpload(ctx context.Context, key, contentType string, query url.Values, body io.Reader, size int64) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	var maxSize int64
+	if v := query.Get("max_size"); v != "" {
+		if maxSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return ErrInvalidSignature
+		}
+	}
+
+	expected := s.sign("PUT", key, contentType, maxSize, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrSignatureExpired
+	}
+	if maxSize > 0 && size > maxSize {
+		return ErrTooLarge
+	}
+	return s.Put(ctx, key, body, contentType)
+}
+
+func (s *localStorage) Stat(_ context.Context, key string) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat %q failed: %v", key, err)
+	}
+	// local ไม่ได้เก็บ content type ไว้ ใช้ตามนามสกุลแทน
+	return &ObjectInfo{
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(p)),
+	}, nil
+}
+
+func (s *localStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Storage ใช้ได้กับ AWS S3 และ service ที่รองรับ S3 API เช่น MinIO
+type s3Storage struct {
+	client    *minio.Client
+	bucket    string
+	publicUrl string
+}
+
+func newS3Storage(cfg config.IStorageConfig) (IObjectStorage, error) {
+	client, err := minio.New(cfg.S3Endpoint(), &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey(), cfg.S3SecretKey(), ""),
+		Secure: cfg.S3UseSSL(),
+		Region: cfg.S3Region(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("minio.New: %w", err)
+	}
+
+	publicUrl := cfg.PublicUrl()
+	if publicUrl == "" {
+		publicUrl = strings.TrimSuffix(client.EndpointURL().String(), "/") + "/" + cfg.Bucket()
+	}
+	return &s3Storage{
+		client:    client,
+		bucket:    cfg.Bucket(),
+		publicUrl: publicUrl,
+	}, nil
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	// size -1 ให้ client แบ่ง multipart upload เอง
+	if _, err := s.client.PutObject(ctx, s.bucket, key, body, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+	}); err != nil {
+		return fmt.Errorf("PutObject(%q): %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("GetObject(%q): %v", key, err)
+	}
+	// GetObject ยังไม่ได้ยิง request จริง ใช้ Stat เช็คว่ามีไฟล์อยู่
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("GetObject(%q): %v", key, err)
+	}
+	return obj, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("RemoveObject(%q): %v", key, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) PublicUrl(key string) string {
+	return fmt.Sprintf("%s/%s", s.publicUrl, key)
+}
+
+func (s *s3Storage) Key(url string) (string, bool) {
+	if !strings.HasPrefix(url, s.publicUrl+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(url, s.publicUrl+"/"), true
+}
+
+// presigned PUT ของ S3 บังคับขนาดไฟล์ไม่ได้ ต้องเช็คด้วย Stat หลัง upload
+func (s *s3Storage) SignedUrl(ctx context.Context, key string, opts *SignOptions) (*SignedUrl, error) {
+	res := &SignedUrl{
+		Method:    opts.Method,
+		Headers:   make(map[string]string),
+		ExpiresAt: time.Now().Add(opts.Expires),
+	}
+	headers := make(http.Header)
+	if opts.ContentType != "" {
+		headers.Set("Content-Type", opts.ContentType)
+		res.Headers["Content-Type"] = opts.ContentType
+	}
+	// s3 presign ไม่มี content-length-range จึง sign ขนาดที่แน่นอนแทน ไฟล์ต้องมีขนาดเท่ากับ MaxSize พอดี
+	if opts.MaxSize > 0 {
+		size := strconv.FormatInt(opts.MaxSize, 10)
+		headers.Set("Content-Length", size)
+		res.Headers["Content-Length"] = size
+	}
+	u, err := s.client.PresignHeader(ctx, opts.Method, s.bucket, key, opts.Expires, nil, headers)
+	if err != nil {
+		return nil, fmt.Errorf("PresignHeader(%q): %v", key, err)
+	}
+	res.Url = u.String()
+	return res, nil
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("StatObject(%q): %v", key, err)
+	}
+	return &ObjectInfo{
+		Size:        info.Size,
+		ContentType: info.ContentType,
+	}, nil
+}
+
+func (s *s3Storage) Close() error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/config"
+)
+
+// IObjectStorage คือที่เก็บไฟล์ที่ upload ขึ้นมา โดย key คือ path ของไฟล์ภายใน bucket เช่น "P000001/abc_123.png"
+type IObjectStorage interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// url ที่ใครก็เปิดได้
+	PublicUrl(key string) string
+	// แปลง url ที่ได้จาก PublicUrl กลับเป็น key, false ถ้าไม่ใช่ url ของ storage นี้
+	Key(url string) (string, bool)
+	// url ที่ใช้ได้ชั่วคราว สำหรับ GET หรือ PUT ไฟล์โดยตรง
+	SignedUrl(ctx context.Context, key string, opts *SignOptions) (*SignedUrl, error)
+	// ขนาดและชนิดของไฟล์ที่อยู่ใน storage แล้ว คืน ErrNotFound ถ้าไม่มีไฟล์
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Close() error
+}
+
+var ErrNotFound = errors.New("object not found")
+
+type SignOptions struct {
+	Method      string // GET or PUT
+	Expires     time.Duration
+	ContentType string // PUT only, client ต้องส่ง Content-Type ตรงกับค่านี้
+	// PUT only, 0 คือไม่จำกัด gcs และ local รับไฟล์ที่ไม่เกินขนาดนี้
+	// s3 sign เป็น Content-Length ไฟล์ต้องมีขนาดเท่านี้พอดี
+	MaxSize int64
+}
+
+type SignedUrl struct {
+	Url       string
+	Method    string
+	Headers   map[string]string // header ที่ client ต้องส่งมาพร้อม request
+	ExpiresAt time.Time
+}
+
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// สร้าง storage ตาม STORAGE_BACKEND
+func NewObjectStorage(ctx context.Context, cfg config.IStorageConfig) (IObjectStorage, error) {
+	switch cfg.Backend() {
+	case "gcs":
+		return newGcsStorage(ctx, cfg)
+	case "local":
+		return newLocalStorage(cfg)
+	case "s3":
+		return newS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Backend())
+	}
+}
@@ -0,0 +1,169 @@
+package suggest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Entry คำที่เติมให้ได้หนึ่งคำ เช่น ชื่อสินค้าหรือชื่อหมวด
+type Entry struct {
+	Type       string `json:"type"`  // title, category
+	Value      string `json:"value"` // ข้อความที่แสดง
+	Ref        string `json:"ref"`   // id สินค้าหรือ slug ของหมวด
+	Popularity int    `json:"-"`
+}
+
+// IIndex index สำหรับ typeahead ใน memory ค้นด้วย prefix ของข้อความทั้งหมดหรือของคำใดคำหนึ่ง
+// Replace สร้าง index ใหม่ทั้งก้อนแล้วค่อยสลับ ระหว่างนั้น Search ยังใช้ index เดิมได้
+type IIndex interface {
+	Search(q string, limit int) []*Entry
+	Replace(entries []*Entry)
+	Len() int
+}
+
+// key คือข้อความตั้งแต่ต้นคำหนึ่งไปจนจบ เรียงไว้เพื่อหา prefix ด้วย binary search
+type key struct {
+	text  string
+	entry int
+	word  int // 0 = prefix ของข้อความทั้งหมด
+}
+
+type index struct {
+	mu      sync.RWMutex
+	entries []*Entry
+	keys    []key
+}
+
+func NewIndex() IIndex {
+	return &index{
+		entries: make([]*Entry, 0),
+		keys:    make([]key, 0),
+	}
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+func (x *index) Replace(entries []*Entry) {
+	// ข้อความซ้ำกันแสดงครั้งเดียว เก็บตัวที่นิยมกว่าไว้
+	unique := make([]*Entry, 0, len(entries))
+	seen := make(map[string]int)
+	for _, e := range entries {
+		dup := e.Type + "\x00" + normalize(e.Value)
+		if j, ok := seen[dup]; ok {
+			if better(true, e, true, unique[j]) {
+				unique[j] = e
+			}
+			continue
+		}
+		seen[dup] = len(unique)
+		unique = append(unique, e)
+	}
+
+	keys := make([]key, 0, len(unique))
+	for i, e := range unique {
+		text := normalize(e.Value)
+		if text == "" {
+			continue
+		}
+
+		keys = append(keys, key{text: text, entry: i})
+		for word, pos := 1, strings.IndexByte(text, ' '); pos != -1; word++ {
+			text = text[pos+1:]
+			keys = append(keys, key{text: text, entry: i, word: word})
+			pos = strings.IndexByte(text, ' ')
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].text < keys[j].text })
+
+	x.mu.Lock()
+	x.entries = unique
+	x.keys = keys
+	x.mu.Unlock()
+}
+
+func (x *index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+type candidate struct {
+	entry  int
+	prefix bool
+}
+
+// Search เรียงตาม prefix ของข้อความทั้งหมดก่อน prefix ของคำ แล้วตามความนิยม
+// เก็บไว้แค่ limit อันดับแรกระหว่างไล่ key จึงไม่ต้อง sort ผลทั้งหมด
+func (x *index) Search(q string, limit int) []*Entry {
+	q = normalize(q)
+	result := make([]*Entry, 0)
+	if q == "" || limit < 1 {
+		return result
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	top := make([]candidate, 0, limit+1)
+	less := func(a, b candidate) bool {
+		return better(a.prefix, x.entries[a.entry], b.prefix, x.entries[b.entry])
+	}
+
+	for i := sort.Search(len(x.keys), func(i int) bool { return x.keys[i].text >= q }); i < len(x.keys); i++ {
+		k := x.keys[i]
+		if !strings.HasPrefix(k.text, q) {
+			break
+		}
+		c := candidate{entry: k.entry, prefix: k.word == 0}
+		if len(top) == limit && !less(c, top[len(top)-1]) {
+			continue
+		}
+
+		// entry เดียวกันอาจ match หลายคำ เก็บแบบที่ดีที่สุด
+		pos := -1
+		for j := range top {
+			if top[j].entry == c.entry {
+				pos = j
+				break
+			}
+		}
+		if pos != -1 {
+			if !less(c, top[pos]) {
+				continue
+			}
+			top = append(top[:pos], top[pos+1:]...)
+		}
+
+		j := sort.Search(len(top), func(j int) bool { return less(c, top[j]) })
+		top = append(top, candidate{})
+		copy(top[j+1:], top[j:])
+		top[j] = c
+		if len(top) > limit {
+			top = top[:limit]
+		}
+	}
+
+	for _, c := range top {
+		result = append(result, x.entries[c.entry])
+	}
+	return result
+}
+
+func better(aPrefix bool, a *Entry, bPrefix bool, b *Entry) bool {
+	if aPrefix != bPrefix {
+		return aPrefix
+	}
+	if a.Popularity != b.Popularity {
+		return a.Popularity > b.Popularity
+	}
+	if len(a.Value) != len(b.Value) {
+		return len(a.Value) < len(b.Value)
+	}
+	if a.Value != b.Value {
+		return a.Value < b.Value
+	}
+	return a.Ref < b.Ref
+}
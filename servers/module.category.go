@@ -0,0 +1,48 @@
+package servers
+
+import (
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category/categoryHandler"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category/categoryRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/category/categoryUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
+)
+
+type ICategoryModule interface {
+	Init()
+	Repository() categoryRepository.ICategoryRepository
+	Usecase() categoryUsecase.ICategoryUsecase
+	Handler() categoryHandler.ICategoryHandler
+}
+
+type categoryModule struct {
+	*moduleFactory
+	repository categoryRepository.ICategoryRepository
+	usecase    categoryUsecase.ICategoryUsecase
+	handler    categoryHandler.ICategoryHandler
+}
+
+func (m *moduleFactory) CategoryModule() ICategoryModule {
+	repository := categoryRepository.CategoryRepository(m.s.db)
+	usecase := categoryUsecase.CategoryUsecase(repository)
+	handler := categoryHandler.CategoryHandler(usecase)
+	return &categoryModule{
+		moduleFactory: m,
+		repository:    repository,
+		usecase:       usecase,
+		handler:       handler,
+	}
+}
+
+func (m *categoryModule) Init() {
+	router := m.r.Group("/category", m.mid.Cors(middlewares.CorsCatalog))
+
+	router.Get("/tree", m.handler.GetCategoryTree)
+	router.Get("/", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindCategories)
+	router.Post("/", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.AddCategory)
+	router.Put("/:category_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.UpdateCategory)
+	router.Delete("/:category_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.DeleteCategory)
+}
+
+func (m *categoryModule) Repository() categoryRepository.ICategoryRepository { return m.repository }
+func (m *categoryModule) Usecase() categoryUsecase.ICategoryUsecase          { return m.usecase }
+func (m *categoryModule) Handler() categoryHandler.ICategoryHandler          { return m.handler }
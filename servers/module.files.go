@@ -1,39 +1,102 @@
 package servers
 
 import (
+	"context"
+	"log"
+	"time"
+
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesHandler"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/storage"
 )
 
 type IFilesModule interface {
 	Init()
+	Repository() filesRepository.IFilesRepository
 	Usecase() filesUsecase.IFilesUsecase
 	Handler() filesHandler.IFileHandler
 }
 
 type filesModule struct {
 	*moduleFactory
-	usecase filesUsecase.IFilesUsecase
-	handler filesHandler.IFileHandler
+	repository filesRepository.IFilesRepository
+	usecase    filesUsecase.IFilesUsecase
+	handler    filesHandler.IFileHandler
 }
 
 func (m *moduleFactory) FilesModule() IFilesModule {
-	usecase := filesUsecase.FilesUsecase(m.s.cfg)
+	repository := filesRepository.FilesRepository(m.s.db)
+	usecase := filesUsecase.FilesUsecase(m.s.cfg, repository, m.s.storage)
 	handler := filesHandler.FileHandler(m.s.cfg, usecase)
 
 	return &filesModule{
 		moduleFactory: m,
+		repository:    repository,
 		usecase:       usecase,
 		handler:       handler,
 	}
 }
 
 func (f *filesModule) Init() {
-	router := f.r.Group("/files")
+	router := f.r.Group("/files", f.mid.Cors(middlewares.CorsAdmin))
 
 	router.Post("/upload", f.mid.JwtAuth(), f.mid.Authorize(2), f.handler.UploadFiles)
 	router.Patch("/delete", f.mid.JwtAuth(), f.mid.Authorize(2), f.handler.DeleteFile)
+
+	// upload ตรงเข้า storage ลูกค้าใช้ upload avatar ได้ด้วย
+	uploads := f.r.Group("/uploads", f.mid.Cors(middlewares.CorsPublic))
+	uploads.Post("/url", f.mid.JwtAuth(), f.handler.CreateUploadUrl)
+	uploads.Post("/confirm", f.mid.JwtAuth(), f.handler.ConfirmUpload)
+
+	if interval := f.s.cfg.Storage().SweepInterval(); interval > 0 {
+		f.s.RegisterWorker("asset-sweeper", f.sweepAssets(interval))
+	}
+
+	// local storage ไม่มี server รับไฟล์เอง ต้องรับ PUT ตาม signed url ที่นี่
+	// browser ส่ง preflight OPTIONS ก่อน PUT ข้าม origin จึงต้องมี route ให้ cors ตอบด้วย
+	if _, ok := f.s.storage.(storage.ISignedUploadReceiver); ok {
+		cors := f.mid.Cors(middlewares.CorsPublic)
+		f.s.app.Options(storage.LocalStaticPrefix+"/*", cors)
+		f.s.app.Put(storage.LocalStaticPrefix+"/*", cors, f.handler.ReceiveSignedUpload)
+	}
+}
+
+// ลบไฟล์ที่ไม่มีใครใช้แล้วเป็นระยะ
+func (f *filesModule) sweepAssets(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := f.usecase.SweepAssets(ctx, f.s.cfg.Storage().SweepGracePeriod(), f.s.cfg.Storage().SweepDryRun())
+				if err != nil {
+					log.Printf("asset sweep failed: %v", err)
+				}
+				if report == nil {
+					continue
+				}
+				if report.DryRun {
+					for _, a := range report.Assets {
+						log.Printf("asset sweep dry-run: would delete %s", a.Key)
+					}
+					continue
+				}
+				if len(report.Assets) > 0 {
+					log.Printf("asset sweep: deleted %d of %d files, %d failed", report.Deleted, len(report.Assets), len(report.Failed))
+				}
+				for key, msg := range report.Failed {
+					log.Printf("asset sweep: delete %s failed: %s", key, msg)
+				}
+			}
+		}
+	}
 }
 
-func (f *filesModule) Usecase() filesUsecase.IFilesUsecase { return f.usecase }
-func (f *filesModule) Handler() filesHandler.IFileHandler  { return f.handler }
+func (f *filesModule) Repository() filesRepository.IFilesRepository { return f.repository }
+func (f *filesModule) Usecase() filesUsecase.IFilesUsecase          { return f.usecase }
+func (f *filesModule) Handler() filesHandler.IFileHandler           { return f.handler }
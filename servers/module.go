@@ -1,10 +1,12 @@
 package servers
 
 import (
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares/middlewareHandler"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares/middlewareRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares/middlewareUsecase"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/monitor/monitorHandlers"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/ratelimit"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -14,6 +16,8 @@ type IModuleFactory interface {
 	FilesModule() IFilesModule
 	ProductModule() IProductModule
 	OrderModule() IOrderModule
+	CategoryModule() ICategoryModule
+	InventoryModule() IInventoryModule
 }
 
 type moduleFactory struct {
@@ -32,11 +36,11 @@ func NewModule(r fiber.Router, s *server, mid middlewareHandler.IMiddlewaresHand
 
 func (m *moduleFactory) MonitorModule() {
 	monitorHandler := monitorHandlers.MonitorHandler(m.s.cfg)
-	m.r.Get("/", monitorHandler.HealthCheck)
+	m.r.Get("/", m.mid.Cors(middlewares.CorsPublic), monitorHandler.HealthCheck)
 }
 
 func InitMiddlewares(s *server) middlewareHandler.IMiddlewaresHandler {
 	repository := middlewareRepository.MiddlewaresRepository(s.db)
 	usecase := middlewareUsecase.MiddlewaresUsecase(repository)
-	return middlewareHandler.MiddlewaresHandler(s.cfg, usecase)
+	return middlewareHandler.MiddlewaresHandler(s.cfg, usecase, ratelimit.NewMemoryStore())
 }
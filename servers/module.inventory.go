@@ -0,0 +1,86 @@
+package servers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryHandler"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryRepository"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/inventory/inventoryUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
+)
+
+type IInventoryModule interface {
+	Init()
+	Repository() inventoryRepository.IInventoryRepository
+	Usecase() inventoryUsecase.IInventoryUsecase
+	Handler() inventoryHandler.IInventoryHandler
+}
+
+type inventoryModule struct {
+	*moduleFactory
+	repository inventoryRepository.IInventoryRepository
+	usecase    inventoryUsecase.IInventoryUsecase
+	handler    inventoryHandler.IInventoryHandler
+}
+
+func (m *moduleFactory) InventoryModule() IInventoryModule {
+	repository := inventoryRepository.InventoryRepository(m.s.db, m.s.cfg)
+	usecase := inventoryUsecase.InventoryUsecase(repository, m.s.notifier)
+	handler := inventoryHandler.InventoryHandler(usecase)
+	return &inventoryModule{
+		moduleFactory: m,
+		repository:    repository,
+		usecase:       usecase,
+		handler:       handler,
+	}
+}
+
+func (m *inventoryModule) Init() {
+	router := m.r.Group("/inventory", m.mid.Cors(middlewares.CorsAdmin))
+
+	router.Get("/variant/:variant_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindStockLevel)
+	router.Get("/movements", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindMovements)
+	router.Get("/reconciliation", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.Reconcile)
+	router.Post("/receive", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.Receive)
+	router.Post("/adjust", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.Adjust)
+	router.Get("/threshold/:product_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindThreshold)
+	router.Put("/threshold/:product_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.SetThreshold)
+	router.Get("/alerts", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindAlerts)
+	router.Post("/check", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.CheckStock)
+
+	if interval := m.s.cfg.Inventory().CheckInterval(); interval > 0 {
+		m.s.RegisterWorker("stock-checker", m.checkStock(interval))
+	}
+}
+
+// เช็ค stock ใกล้หมดและ stock ที่กลับมาเป็นระยะ
+func (m *inventoryModule) checkStock(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := m.usecase.CheckStock(ctx)
+				if err != nil {
+					log.Printf("stock check failed: %v", err)
+					continue
+				}
+				if len(report.Raised) > 0 || len(report.Resolved) > 0 || report.Notified > 0 {
+					log.Printf("stock check: %d alerts raised, %d resolved, %d customers notified of restock", len(report.Raised), len(report.Resolved), report.Notified)
+				}
+				for _, e := range report.Errors {
+					log.Printf("stock check: %s", e)
+				}
+			}
+		}
+	}
+}
+
+func (m *inventoryModule) Repository() inventoryRepository.IInventoryRepository { return m.repository }
+func (m *inventoryModule) Usecase() inventoryUsecase.IInventoryUsecase          { return m.usecase }
+func (m *inventoryModule) Handler() inventoryHandler.IInventoryHandler          { return m.handler }
@@ -1,6 +1,9 @@
 package servers
 
 import (
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/order/orderHandler"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/order/orderRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/order/orderUsecase"
@@ -35,11 +38,15 @@ func (m *moduleFactory) OrderModule() IOrderModule {
 }
 
 func (m *orderModule) Init() {
-	router := m.r.Group("/order")
+	router := m.r.Group("/order", m.mid.Cors(middlewares.CorsPublic))
+
+	addOrderLimit := &middlewares.RateLimitPolicy{Name: "order-add", Limit: 10, Window: time.Minute, KeyBy: middlewares.RateLimitByUser}
 
-	router.Post("/", m.mid.JwtAuth(), m.mid.Authorize(1), m.handler.AddOrder)
+	router.Post("/", m.mid.JwtAuth(), m.mid.Authorize(1), m.mid.RateLimit(addOrderLimit), m.handler.AddOrder)
+	router.Get("/", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindOrders)
 	router.Get("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.mid.Authorize(1), m.handler.GetOrderByUserId)
 	router.Get("/find/:order_id", m.mid.JwtAuth(), m.mid.Authorize(1, 2), m.handler.GetOneOrderById)
+	router.Put("/:order_id/status", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.UpdateStatus)
 
 }
 
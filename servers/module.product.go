@@ -1,7 +1,13 @@
 package servers
 
 import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productHandler"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/product/productUsecase"
@@ -22,29 +28,71 @@ type productModule struct {
 }
 
 func (m *moduleFactory) ProductModule() IProductModule {
-	fileUsecase := filesUsecase.FilesUsecase(m.s.cfg)
+	fileUsecase := filesUsecase.FilesUsecase(m.s.cfg, filesRepository.FilesRepository(m.s.db), m.s.storage)
 	repo := productRepository.ProductRepository(m.s.db)
 	usecase := productUsecase.ProductUsecase(repo, m.s.cfg)
 	handler := productHandler.ProductHandler(usecase, fileUsecase, m.s.cfg)
 
 	return &productModule{
 		moduleFactory: m,
+		repo:          repo,
 		usecase:       usecase,
 		handler:       handler,
 	}
 }
 
 func (m *productModule) Init() {
-	router := m.r.Group("/product")
+	router := m.r.Group("/product", m.mid.Cors(middlewares.CorsCatalog))
+
+	// admin ที่ login เห็นสินค้าที่เป็น draft, archived หรือยังไม่ถึงเวลาขึ้นหน้าร้านด้วย
+	router.Get("/all", m.mid.OptionalJwtAuth(), m.handler.GetAllProduct)
+	searchLimit := &middlewares.RateLimitPolicy{Name: "product-search", Limit: 60, Window: time.Minute, KeyBy: middlewares.RateLimitByIp}
 
-	router.Get("/all", m.handler.GetAllProduct)
-	router.Get("/search", m.handler.FindProduct)
-	router.Get("/:product_id", m.handler.FindOneProduct)
+	router.Get("/search", m.mid.RateLimit(searchLimit), m.mid.OptionalJwtAuth(), m.handler.FindProduct)
+	suggestLimit := &middlewares.RateLimitPolicy{Name: "product-suggest", Limit: 600, Window: time.Minute, KeyBy: middlewares.RateLimitByIp}
+	router.Get("/suggest", m.mid.RateLimit(suggestLimit), m.handler.Suggest)
+	router.Post("/import", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.ImportProducts)
+	router.Get("/export", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.ExportProducts)
+	router.Get("/:product_id", m.mid.OptionalJwtAuth(), m.handler.FindOneProduct)
 	router.Post("/", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.AddProduct)
 	router.Delete("/:product_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.DeleteProduct)
 	router.Put("/", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.UpdateProduct)
+	router.Put("/:product_id/status", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.UpdateProductStatus)
+	router.Get("/:product_id/revisions", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindRevisions)
+	router.Get("/:product_id/revisions/:revision_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindRevision)
+	router.Post("/:product_id/revisions/:revision_id/restore", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.RestoreRevision)
 	router.Get("/image/:product_id", m.handler.FindImageByProductId)
+	router.Post("/:product_id/variant", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.AddVariant)
+	router.Put("/variant/:variant_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.UpdateVariant)
+	router.Delete("/variant/:variant_id", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.DeleteVariant)
+
+	m.s.RegisterWorker("product-suggest", m.refreshSuggest(m.s.cfg.App().SuggestRefresh()))
+}
 
+// สร้าง index ของ autocomplete ตอนเริ่ม เมื่อสินค้าเปลี่ยน และทุก interval
+// (หมวดที่เปลี่ยนชื่อและยอดขายจะเข้ามาตอนครบ interval)
+func (m *productModule) refreshSuggest(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			if err := m.usecase.RefreshSuggestIndex(); err != nil {
+				log.Printf("refresh product suggest index failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+			case <-m.usecase.SuggestIndexStale():
+			}
+		}
+	}
 }
 
 func (f *productModule) Repository() productRepository.IProductRepository { return f.repo }
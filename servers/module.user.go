@@ -1,7 +1,11 @@
 package servers
 
 import (
+	"time"
+
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesRepository"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/files/filesUsecase"
+	"github.com/deeptech-kmitl/Cicero-Backend/modules/middlewares"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users/usersHandlers"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users/usersRepositories"
 	"github.com/deeptech-kmitl/Cicero-Backend/modules/users/usersUsecases"
@@ -22,7 +26,7 @@ type userModule struct {
 }
 
 func (m *moduleFactory) UserModule() IUserModule {
-	fileUsecase := filesUsecase.FilesUsecase(m.s.cfg)
+	fileUsecase := filesUsecase.FilesUsecase(m.s.cfg, filesRepository.FilesRepository(m.s.db), m.s.storage)
 	userRepository := usersRepositories.UsersRepository(m.s.db)
 	userUsecase := usersUsecases.UserUsecase(userRepository, m.s.cfg)
 	userHandler := usersHandlers.UsersHandler(m.s.cfg, userUsecase, fileUsecase)
@@ -35,17 +39,23 @@ func (m *moduleFactory) UserModule() IUserModule {
 }
 
 func (m *userModule) Init() {
-	router := m.r.Group("/users")
+	router := m.r.Group("/users", m.mid.Cors(middlewares.CorsPublic))
+
+	signUpLimit := &middlewares.RateLimitPolicy{Name: "users-signup", Limit: 10, Window: time.Hour, KeyBy: middlewares.RateLimitByIp}
+	signInLimit := &middlewares.RateLimitPolicy{Name: "users-signin", Limit: 5, Window: time.Minute, KeyBy: middlewares.RateLimitByIp}
+	cartLimit := &middlewares.RateLimitPolicy{Name: "users-cart", Limit: 60, Window: time.Minute, KeyBy: middlewares.RateLimitByUser}
 
-	router.Post("/signup", m.handler.SignUpCustomer)
+	router.Post("/signup", m.mid.RateLimit(signUpLimit), m.handler.SignUpCustomer)
 	router.Post("/signup-admin", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.SignUpAdmin)
-	router.Post("/signin", m.handler.SignIn)
+	router.Post("/signin", m.mid.RateLimit(signInLimit), m.handler.SignIn)
 	router.Post("/signout", m.mid.JwtAuth(), m.handler.SignOut)
+	router.Get("/", m.mid.JwtAuth(), m.mid.Authorize(2), m.handler.FindUsers)
 	router.Get("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.GetUserProfile)
 	router.Put("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.UpdateUserProfile)
-	router.Post("/:user_id/wishlist/:product_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.Wishlist)
+	router.Post("/:user_id/wishlist/:variant_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.Wishlist)
 	router.Get("/wishlist/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.GetWishlist)
-	router.Post("/cart/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.AddCart)
+	router.Post("/:user_id/stock-subscriptions/:variant_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.StockSubscription)
+	router.Post("/cart/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.mid.RateLimit(cartLimit), m.handler.AddCart)
 	router.Delete("/cart/:user_id/:cart_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.RemoveCart)
 	router.Get("/cart/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.GetCart)
 	router.Patch("/cart/qtyPlus/:user_id/:cart_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), m.handler.IncreaseQtyCart)
@@ -1,48 +1,103 @@
 package servers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/deeptech-kmitl/Cicero-Backend/config"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/notify"
+	"github.com/deeptech-kmitl/Cicero-Backend/pkg/storage"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 )
 
 type IServer interface {
 	GetServer() *server
-	Start()
+	Start() error
 }
 
 type server struct {
-	app *fiber.App
-	cfg config.IConfig
-	db  *sqlx.DB
+	app      *fiber.App
+	cfg      config.IConfig
+	db       *sqlx.DB
+	storage  storage.IObjectStorage
+	notifier notify.INotifier
+	workers  []*worker
 }
 
-func NewServer(cfg config.IConfig, db *sqlx.DB) IServer {
+// worker คืองานที่รันอยู่เบื้องหลังตลอดอายุของ server และจะถูกหยุดเมื่อ ctx ถูก cancel
+type worker struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+func NewServer(cfg config.IConfig, db *sqlx.DB, storage storage.IObjectStorage, notifier notify.INotifier) IServer {
 	return &server{
-		db:  db,
-		cfg: cfg,
+		db:       db,
+		cfg:      cfg,
+		storage:  storage,
+		notifier: notifier,
 		app: fiber.New(fiber.Config{
-			AppName:      cfg.App().Name(),
-			BodyLimit:    cfg.App().BodyLimit(),
-			ReadTimeout:  cfg.App().ReadTimeout(),
-			WriteTimeout: cfg.App().WriteTimeout(),
-			JSONEncoder:  json.Marshal,
-			JSONDecoder:  json.Unmarshal,
+			AppName:        cfg.App().Name(),
+			BodyLimit:      cfg.App().BodyLimit(),
+			ReadTimeout:    cfg.App().ReadTimeout(),
+			WriteTimeout:   cfg.App().WriteTimeout(),
+			IdleTimeout:    cfg.App().IdleTimeout(),
+			ReadBufferSize: cfg.App().HeaderLimit(), // also the max size of request headers
+			JSONEncoder:    json.Marshal,
+			JSONDecoder:    json.Unmarshal,
+			// only trust the proxy header when it comes from our load balancer,
+			// otherwise clients could spoof c.IP()
+			EnableTrustedProxyCheck: len(cfg.App().TrustedProxies()) > 0,
+			TrustedProxies:          cfg.App().TrustedProxies(),
+			ProxyHeader: func() string {
+				if len(cfg.App().TrustedProxies()) > 0 {
+					return cfg.App().ProxyHeader()
+				}
+				return ""
+			}(),
+			EnableIPValidation: true,
 		}),
+		workers: make([]*worker, 0),
 	}
 
 }
 
-func (s *server) Start() {
+// ลงทะเบียนงานเบื้องหลัง ต้องเรียกก่อน Start
+func (s *server) RegisterWorker(name string, run func(ctx context.Context)) {
+	s.workers = append(s.workers, &worker{
+		name: name,
+		run:  run,
+	})
+}
+
+func (s *server) Start() error {
+	// ctx ของทุก request (c.UserContext) ถูก cancel ตอนปิด server เมื่อรอ request ที่ค้างอยู่ไม่ทัน
+	// งานยาว ๆ เช่น stream export จึงหยุด query ก่อนปิด db pool
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	// Middleware
 	mid := InitMiddlewares(s)
+	s.app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(requestCtx)
+		return c.Next()
+	})
+	s.app.Use(mid.Recover())
+	s.app.Use(mid.Security())
 	s.app.Use(mid.Logger())
-	s.app.Use(mid.Cors())
+
+	// Files of the local storage backend
+	if s.cfg.Storage().Backend() == "local" {
+		s.app.Static(storage.LocalStaticPrefix, s.cfg.Storage().LocalDir())
+	}
 
 	// Module
 	api := s.app.Group("/api")
@@ -53,23 +108,92 @@ func (s *server) Start() {
 	modules.FilesModule().Init()
 	modules.ProductModule().Init()
 	modules.OrderModule().Init()
+	modules.CategoryModule().Init()
+	modules.InventoryModule().Init()
 
 	// if route not found
 	s.app.Use(mid.RouterCheck())
 
-	//Graceful shutdown
+	// Background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			log.Printf("worker %s started", w.name)
+			w.run(workerCtx)
+			log.Printf("worker %s stopped", w.name)
+		}(w)
+	}
+
+	//Listen to host:port
+	listenErr := make(chan error, 1)
+	go func() {
+		log.Printf("server is running at %v", s.cfg.App().Url())
+		listenErr <- s.app.Listen(s.cfg.App().Url())
+	}()
+
+	//Graceful shutdown on Ctrl+C (SIGINT) or SIGTERM from Cloud Run / Kubernetes
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(c)
+
+	var err error
+	select {
+	case sig := <-c:
+		log.Printf("received %v, server is shutting down...", sig)
+	case err = <-listenErr:
+		if err != nil {
+			err = fmt.Errorf("listen failed: %v", err)
+		}
+	}
+
+	s.shutdown(cancelRequests, stopWorkers, &wg)
+	return err
+}
+
+// ปิด server ตามลำดับ: หยุดรับ request และรอ request ที่ค้างอยู่ -> หยุด workers -> ปิด storage -> ปิด notifier -> ปิด db pool
+func (s *server) shutdown(cancelRequests, stopWorkers context.CancelFunc, wg *sync.WaitGroup) {
+	timeout := s.cfg.App().ShutdownTimeout()
+	deadline := time.Now().Add(timeout)
+
+	// 1. HTTP
+	if err := s.app.ShutdownWithTimeout(timeout); err != nil {
+		log.Printf("http shutdown failed: %v", err)
+	}
+	cancelRequests()
+
+	// 2. Background workers, share the remaining drain time
+	stopWorkers()
+	done := make(chan struct{})
 	go func() {
-		<-c
-		log.Println("server is shutting down...")
-		_ = s.app.Shutdown()
+		wg.Wait()
+		close(done)
 	}()
+	select {
+	case <-done:
+	case <-time.After(time.Until(deadline)):
+		log.Printf("workers did not stop within %v", timeout)
+	}
 
-	//Listen to host:port
-	log.Printf("server is running at %v", s.cfg.App().Url())
-	s.app.Listen(s.cfg.App().Url())
+	// 3. Object storage client
+	if err := s.storage.Close(); err != nil {
+		log.Printf("close storage failed: %v", err)
+	}
 
+	// 4. Notifier
+	if err := s.notifier.Close(); err != nil {
+		log.Printf("close notifier failed: %v", err)
+	}
+
+	// 5. Database pool
+	if err := s.db.Close(); err != nil {
+		log.Printf("close db failed: %v", err)
+	}
+	log.Println("server stopped")
 }
 
 func (s *server) GetServer() *server {